@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"application_profiling/internal/dockerizer"
+	"application_profiling/internal/profiler"
+
+	"github.com/charmbracelet/log"
+)
+
+// ComposeOptions represents the options for the Compose command
+type ComposeOptions struct {
+	RulesFile          string
+	OutputDirectory    string
+	ComposePath        string
+	ProfileDirectories []string
+}
+
+// RunCompose handles the "compose" command logic
+func RunCompose(arguments []string) {
+	// Parse command-line arguments
+	options := parseComposeArguments(arguments)
+
+	// Generate the Compose file
+	executeCompose(options)
+}
+
+// parseComposeArguments generates ComposeOptions using the provided flags and profile directories
+func parseComposeArguments(arguments []string) ComposeOptions {
+	// Initialize a flag set and define the compose flags
+	flagSet := flag.NewFlagSet("compose", flag.ExitOnError)
+	rulesFile := flagSet.String("rules", "", "YAML file with filter rules added to the built-in defaults")
+	outputDirectory := flagSet.String("output", "output/compose", "Directory to write docker-compose.yml and the env files to")
+	flagSet.Parse(arguments)
+
+	if flagSet.NArg() < 1 {
+		log.Fatalf("No profile directories given for the Compose file.")
+	}
+
+	return ComposeOptions{
+		RulesFile:          *rulesFile,
+		OutputDirectory:    *outputDirectory,
+		ComposePath:        filepath.Join(*outputDirectory, "docker-compose.yml"),
+		ProfileDirectories: flagSet.Args(),
+	}
+}
+
+// executeCompose loads every profiled application and writes the Compose file
+func executeCompose(options ComposeOptions) {
+	// 1. Load the profiled applications
+	log.Info("Loading profiled applications...")
+	var applications []dockerizer.ComposeApplication
+	for _, profileDirectory := range options.ProfileDirectories {
+		applications = append(applications, loadComposeApplication(options, profileDirectory))
+	}
+
+	// 2. Generate the Compose file
+	log.Info("Generating Compose file...")
+	if err := os.MkdirAll(options.OutputDirectory, 0o755); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+	dependencies, err := dockerizer.GenerateCompose(applications, options.ComposePath)
+	if err != nil {
+		log.Fatalf("Failed to generate Compose file: %v", err)
+	}
+
+	for _, dependency := range dependencies {
+		log.Info("Detected service dependency", "service", dependency.Service, "dependson", dependency.DependsOn, "via", dependency.Via)
+	}
+	log.Info("Compose file written", "path", options.ComposePath)
+}
+
+// loadComposeApplication loads the process information and state directories of a profile directory
+// ("output/<pid>/profile", or "output/<pid>") and points the service to its dockerize directory
+func loadComposeApplication(options ComposeOptions, profileDirectory string) dockerizer.ComposeApplication {
+	if _, err := os.Stat(filepath.Join(profileDirectory, "process_info.yaml")); err != nil {
+		profileDirectory = filepath.Join(profileDirectory, "profile")
+	}
+	processInfo := profiler.LoadFromYAML(filepath.Join(profileDirectory, "process_info.yaml"))
+
+	// The Dockerfile of the application is written by the dockerize command
+	dockerizeDirectory := filepath.Join(filepath.Dir(profileDirectory), "dockerize")
+	if _, err := os.Stat(filepath.Join(dockerizeDirectory, "Dockerfile")); err != nil {
+		log.Warn("No Dockerfile found, run the dockerize command first", "directory", dockerizeDirectory)
+	}
+	buildContext, err := filepath.Rel(options.OutputDirectory, dockerizeDirectory)
+	if err != nil {
+		buildContext, _ = filepath.Abs(dockerizeDirectory)
+	}
+
+	return dockerizer.ComposeApplication{
+		ProcessInfo:  processInfo,
+		BuildContext: buildContext,
+		Volumes:      loadStateDirectories(filepath.Join(profileDirectory, "access_merged.yaml"), options.RulesFile, processInfo.DistributionIDs()),
+	}
+}
+
+// loadStateDirectories detects the state directories in an access profile like the dockerize command does
+func loadStateDirectories(accessFile, rulesFile string, distributions []string) []string {
+	accessProfile, err := profiler.LoadAccessProfile(accessFile)
+	if err != nil {
+		log.Warn("No access profile found, skipping volume detection", "file", accessFile, "error", err)
+		return nil
+	}
+	rules, err := profiler.LoadFilterRules(rulesFile, distributions)
+	if err != nil {
+		log.Fatalf("Failed to load filter rules: %v", err)
+	}
+	return dockerizer.DetectStateDirectories(accessProfile, rules).Volumes
+}
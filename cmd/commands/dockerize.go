@@ -1,10 +1,12 @@
 package commands
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"application_profiling/internal/adapter"
 	"application_profiling/internal/dockerizer"
 	"application_profiling/internal/profiler"
 
@@ -15,35 +17,111 @@ import (
 type DockerizeOptions struct {
 	ProcessInfoFile  string
 	TraceLogFile     string
+	AccessFile       string
+	StateReportPath  string
 	DockerfilePath   string
 	ProfileDirectory string
-	TarArchivePath   string
+	ContextDirectory string
+	LayerReport      string
+	LayerRulesFile   string
+	RulesFile        string
+	AdaptersFile     string
+	PackageReport    string
+	ConfigDriftPath  string
+	LibraryReport    string
+	UsePackages      bool
+	BaseImage        string
+	ImageFormat      string
+	LayoutDirectory  string
+	ImageArchivePath string
+	ImageReference   string
+	BaseRootfs       string
+	BaseDiffReport   string
 }
 
 // RunDockerize handles the "dockerize" command logic
 func RunDockerize(arguments []string) {
 	// Parse command-line arguments
-	options := parseDockerizeArguments(arguments[0])
+	options := parseDockerizeArguments(arguments)
 
 	// Execute the Dockerization process
 	executeDockerization(options)
 }
 
-// parseDockerizeArguments generates DockerizeOptions using the provided PID
-func parseDockerizeArguments(pid string) DockerizeOptions {
+// parseDockerizeArguments generates DockerizeOptions using the provided flags and PID
+func parseDockerizeArguments(arguments []string) DockerizeOptions {
+	// Initialize a flag set and define the dockerize flags
+	flagSet := flag.NewFlagSet("dockerize", flag.ExitOnError)
+	rulesFile := flagSet.String("rules", "", "YAML file with filter rules added to the built-in defaults")
+	adaptersFile := flagSet.String("adapters", "", "YAML file with application adapters added to the built-in ones")
+	usePackages := flagSet.Bool("packages", false, "Install package-owned files with the package manager and only archive unowned files")
+	baseImage := flagSet.String("base", "", "Base image of the Dockerfile, or \"scratch\" for a self-contained root filesystem")
+	baseRootfs := flagSet.String("base-rootfs", "", "Root filesystem of the base image (exported tarball or OCI layout) to drop identical files against")
+	layerRulesFile := flagSet.String("layer-rules", "", "YAML file with image layers replacing the built-in ones")
+	imageFormat := flagSet.String("image", "", "Also write the image without Docker: \"oci\" (image layout) or \"docker-archive\" (docker load tarball)")
+	flagSet.Parse(arguments)
+	if *baseImage == dockerizer.ScratchImage && *usePackages {
+		log.Fatalf("The -packages mode needs a package manager and cannot be used with -base scratch.")
+	}
+	if *baseImage == dockerizer.ScratchImage && *baseRootfs != "" {
+		log.Fatalf("An image without a base OS has no base root filesystem to compare with (-base-rootfs).")
+	}
+	switch *imageFormat {
+	case "":
+	case dockerizer.ImageFormatOCI, dockerizer.ImageFormatDockerArchive:
+		// The layers of a base image cannot be fetched without a registry client
+		if *baseImage != dockerizer.ScratchImage {
+			log.Fatalf("Writing an image without Docker needs a self-contained root filesystem (-base scratch).")
+		}
+	default:
+		log.Fatalf("Unknown image format %q, expected %q or %q.", *imageFormat, dockerizer.ImageFormatOCI, dockerizer.ImageFormatDockerArchive)
+	}
+
+	// Retrieve the main application PID
+	if flagSet.NArg() < 1 {
+		log.Fatalf("No PID given for dockerization.")
+	}
+	pid := flagSet.Arg(0)
+
 	// Define file paths
 	processInfoFile := fmt.Sprintf("output/%s/profile/process_info.yaml", pid)
 	traceLogFile := fmt.Sprintf("output/%s/profile/strace_merged.log", pid)
+	accessFile := fmt.Sprintf("output/%s/profile/access_merged.yaml", pid)
+	stateReportPath := fmt.Sprintf("output/%s/dockerize/state_report.yaml", pid)
 	dockerfilePath := fmt.Sprintf("output/%s/dockerize/Dockerfile", pid)
 	profileDirectory := fmt.Sprintf("output/%s/dockerize/profile", pid)
-	tarArchivePath := fmt.Sprintf("output/%s/dockerize/profile.tar.gz", pid)
+	contextDirectory := fmt.Sprintf("output/%s/dockerize", pid)
+	layerReport := fmt.Sprintf("output/%s/dockerize/layers.yaml", pid)
+	packageReport := fmt.Sprintf("output/%s/dockerize/packages.yaml", pid)
+	configDriftPath := fmt.Sprintf("output/%s/dockerize/config_drift.yaml", pid)
+	libraryReport := fmt.Sprintf("output/%s/dockerize/libraries.yaml", pid)
+	layoutDirectory := fmt.Sprintf("output/%s/dockerize/oci", pid)
+	imageArchivePath := fmt.Sprintf("output/%s/dockerize/image.tar", pid)
+	baseDiffReport := fmt.Sprintf("output/%s/dockerize/base_diff.yaml", pid)
 
 	return DockerizeOptions{
 		ProcessInfoFile:  processInfoFile,
 		TraceLogFile:     traceLogFile,
+		AccessFile:       accessFile,
+		StateReportPath:  stateReportPath,
 		DockerfilePath:   dockerfilePath,
 		ProfileDirectory: profileDirectory,
-		TarArchivePath:   tarArchivePath,
+		ContextDirectory: contextDirectory,
+		LayerReport:      layerReport,
+		LayerRulesFile:   *layerRulesFile,
+		RulesFile:        *rulesFile,
+		AdaptersFile:     *adaptersFile,
+		PackageReport:    packageReport,
+		ConfigDriftPath:  configDriftPath,
+		LibraryReport:    libraryReport,
+		UsePackages:      *usePackages,
+		BaseImage:        *baseImage,
+		ImageFormat:      *imageFormat,
+		LayoutDirectory:  layoutDirectory,
+		ImageArchivePath: imageArchivePath,
+		ImageReference:   fmt.Sprintf("vm2container/%s:latest", pid),
+		BaseRootfs:       *baseRootfs,
+		BaseDiffReport:   baseDiffReport,
 	}
 }
 
@@ -53,6 +131,16 @@ func executeDockerization(options DockerizeOptions) {
 	log.Info("Loading static process information...")
 	processInfo := profiler.LoadFromYAML(options.ProcessInfoFile)
 
+	// Load the application adapters up front, so an invalid adapters file fails early
+	adapters, err := adapter.LoadRegistry(options.AdaptersFile)
+	if err != nil {
+		log.Fatalf("Failed to load application adapters: %v", err)
+	}
+	layerRules, err := dockerizer.LoadLayerRules(options.LayerRulesFile)
+	if err != nil {
+		log.Fatalf("Failed to load layer rules: %v", err)
+	}
+
 	// 2. Load file paths from trace log
 	log.Info("Loading runtime data from trace log...")
 	filePaths, err := dockerizer.LoadFilePaths(options.TraceLogFile)
@@ -60,26 +148,229 @@ func executeDockerization(options DockerizeOptions) {
 		log.Fatalf("Failed to load file paths from trace log: %v", err)
 	}
 
-	// 3. Prepare the profile directory
+	// 3. Add the shared libraries the trace missed
+	log.Info("Resolving shared library dependencies...")
+	if options.BaseImage == dockerizer.ScratchImage {
+		filePaths = append(filePaths, dockerizer.ScratchFilePaths(processInfo)...)
+	}
+	filePaths = append(filePaths, resolveSharedLibraries(options, processInfo, filePaths)...)
+
+	// 4. Detect application state directories from the access profile
+	log.Info("Detecting application state directories...")
+	volumes := detectVolumes(options, processInfo)
+
+	// Load the root filesystem of the base image, which the packages and files are compared with
+	var base *dockerizer.BaseRootfs
+	if options.BaseRootfs != "" {
+		log.Info("Loading the base image root filesystem...")
+		base, err = dockerizer.LoadBaseRootfs(options.BaseRootfs)
+		if err != nil {
+			log.Fatalf("Failed to load base image root filesystem: %v", err)
+		}
+	}
+
+	// 5. Replace package-owned files with package installs, if requested.
+	// The profile files that must replace files of the base image or of the packages are collected as overrides.
+	installCommand := ""
+	var overridePaths []string
+	if options.UsePackages {
+		log.Info("Attributing files to installed packages...")
+		filePaths, installCommand, overridePaths = attributePackages(options, processInfo, filePaths, base)
+	}
+
+	// 6. Prepare the profile directory
 	log.Info("Copying files to minimal profile filesystem...")
 	if err := os.RemoveAll(options.ProfileDirectory); err != nil {
 		log.Fatalf("Failed to clean up profile directory: %v", err)
 	}
-	if err := dockerizer.CopyFilesToProfile(filePaths, options.ProfileDirectory); err != nil {
+	if options.BaseImage == dockerizer.ScratchImage {
+		if err := dockerizer.CreateScratchLayout(options.ProfileDirectory); err != nil {
+			log.Fatalf("Failed to create root filesystem layout: %v", err)
+		}
+	}
+	if err := dockerizer.CopyFilesToProfile(filePaths, options.ProfileDirectory, volumes); err != nil {
 		log.Fatalf("Failed to copy files to profile directory: %v", err)
 	}
+	if options.BaseImage == dockerizer.ScratchImage {
+		log.Info("Completing the root filesystem for an image without a base OS...")
+		if err := dockerizer.PrepareScratchRootfs(processInfo, options.ProfileDirectory); err != nil {
+			log.Fatalf("Failed to prepare root filesystem: %v", err)
+		}
+	}
 
-	// 4. Create a tar archive of the profile directory
-	log.Info("Creating tar archive of profile directory...")
-	if err := dockerizer.CreateTarArchive(options.TarArchivePath, options.ProfileDirectory); err != nil {
-		log.Fatalf("Failed to create tar archive: %v", err)
+	// 7. Drop the files the base image already has
+	if base != nil {
+		log.Info("Comparing profile with the base image root filesystem...")
+		overridePaths = append(overridePaths, removeBaseFiles(options, base)...)
 	}
 
-	// 5. Generate the Dockerfile
+	// 8. Split the profile directory into layer archives
+	log.Info("Creating layer archives of profile directory...")
+	layers := createLayerArchives(options, layerRules, overridePaths)
+
+	// 9. Generate the Dockerfile
 	log.Info("Generating Dockerfile...")
-	if err := dockerizer.GenerateDockerfile(processInfo, options.DockerfilePath, filepath.Base(options.TarArchivePath), filepath.Base(options.ProfileDirectory)); err != nil {
+	dockerfileData, err := dockerizer.GenerateDockerfile(processInfo, options.DockerfilePath, layers, filepath.Base(options.ProfileDirectory), volumes, adapters, installCommand, options.BaseImage)
+	if err != nil {
 		log.Fatalf("Failed to generate Dockerfile: %v", err)
 	}
 
+	// 10. Generate the Podman Quadlet and systemd units
+	log.Info("Generating Podman units...")
+	unitPaths, err := dockerizer.GeneratePodmanUnits(processInfo, dockerfileData, "localhost/"+options.ImageReference, options.ContextDirectory)
+	if err != nil {
+		log.Error("Failed to generate Podman units", "error", err)
+	}
+	for _, unitPath := range unitPaths {
+		log.Info("Podman unit written", "path", unitPath)
+	}
+
+	// 11. Write the image without Docker, if requested
+	if options.ImageFormat != "" {
+		log.Info("Writing container image...", "format", options.ImageFormat)
+		writeImage(options, dockerfileData)
+	}
+
 	log.Info("Dockerization complete.")
 }
+
+// createLayerArchives archives the profile directory as one tar archive per layer and saves the layer report.
+// The override paths go into a last layer that replaces the files of the base image.
+func createLayerArchives(options DockerizeOptions, rules *dockerizer.LayerRules, overridePaths []string) []dockerizer.LayerArchive {
+	layers, err := dockerizer.CreateLayerArchives(options.ProfileDirectory, options.ContextDirectory, rules, overridePaths)
+	if err != nil {
+		log.Fatalf("Failed to create layer archives: %v", err)
+	}
+	if err := dockerizer.SaveLayerReport(layers, options.LayerReport); err != nil {
+		log.Error("Failed to save layer report", "error", err)
+	}
+
+	for _, layer := range layers {
+		log.Info("Created layer archive", "layer", layer.Name, "entries", layer.Entries, "size", layer.Size)
+	}
+	return layers
+}
+
+// removeBaseFiles drops profile files identical to those of the base image, saves the comparison report
+// and returns the paths of the files that differ from the base image
+func removeBaseFiles(options DockerizeOptions, base *dockerizer.BaseRootfs) []string {
+	// The Dockerfile copies the user and group files from the profile
+	report, err := dockerizer.RemoveBaseFiles(options.ProfileDirectory, base, []string{"/etc/passwd", "/etc/group"})
+	if err != nil {
+		log.Fatalf("Failed to compare profile with base image: %v", err)
+	}
+	report.Base = options.BaseRootfs
+	if err := dockerizer.SaveBaseDiffReport(report, options.BaseDiffReport); err != nil {
+		log.Error("Failed to save base image comparison", "error", err)
+	}
+
+	for _, difference := range report.Differing {
+		log.Warn("Profiled file differs from the base image", "path", difference.Path, "reason", difference.Reason)
+	}
+	log.Info("Dropped files present in the base image", "identical", report.Identical, "differing", len(report.Differing))
+	return report.DifferingPaths()
+}
+
+// writeImage writes the profile as an OCI image layout, validates it, and packs it for "docker load" if requested
+func writeImage(options DockerizeOptions, dockerfileData dockerizer.DockerfileData) {
+	if err := os.RemoveAll(options.LayoutDirectory); err != nil {
+		log.Fatalf("Failed to clean up image layout directory: %v", err)
+	}
+	if err := dockerizer.WriteOCIImage(dockerfileData, options.ContextDirectory, options.LayoutDirectory, options.ImageReference); err != nil {
+		log.Fatalf("Failed to write OCI image: %v", err)
+	}
+	if err := dockerizer.ValidateOCILayout(options.LayoutDirectory); err != nil {
+		log.Fatalf("Invalid OCI image layout: %v", err)
+	}
+	log.Info("OCI image layout written", "path", options.LayoutDirectory, "reference", options.ImageReference)
+
+	if options.ImageFormat == dockerizer.ImageFormatDockerArchive {
+		if err := dockerizer.WriteDockerArchive(options.LayoutDirectory, options.ImageArchivePath); err != nil {
+			log.Fatalf("Failed to write image archive: %v", err)
+		}
+		log.Info("Image archive written, load it with \"docker load -i\"", "path", options.ImageArchivePath)
+	}
+}
+
+// resolveSharedLibraries analyzes the ELF files among the file paths, saves the library report
+// and returns the libraries they need that are not part of the file paths
+func resolveSharedLibraries(options DockerizeOptions, processInfo *profiler.ProcessInfo, filePaths []string) []string {
+	report := dockerizer.ResolveSharedLibraries(filePaths, processInfo.EnvironmentVariables)
+	if err := os.MkdirAll(filepath.Dir(options.LibraryReport), 0o755); err != nil {
+		log.Error("Failed to create output directory", "error", err)
+	} else if err := dockerizer.SaveLibraryReport(report, options.LibraryReport); err != nil {
+		log.Error("Failed to save library report", "error", err)
+	}
+
+	for _, library := range report.Added {
+		log.Info("Added shared library", "path", library.Path, "neededby", library.NeededBy)
+	}
+	for _, library := range report.Unresolved {
+		log.Warn("Shared library not found", "name", library.Name, "neededby", library.NeededBy)
+	}
+	return report.AddedPaths()
+}
+
+// attributePackages maps the file paths to their owning packages, saves the package and configuration
+// drift reports and returns the paths left to copy together with the command installing the packages
+// and the modified package files, which must replace the versions of the base image and the packages.
+// Packages the base image provides, if its root filesystem is given, are not installed.
+func attributePackages(options DockerizeOptions, processInfo *profiler.ProcessInfo, filePaths []string, base *dockerizer.BaseRootfs) ([]string, string, []string) {
+	database, err := dockerizer.NewPackageDatabase(processInfo.DistributionIDs())
+	if err != nil {
+		log.Fatalf("Failed to load package database: %v", err)
+	}
+
+	report := dockerizer.AttributePackages(filePaths, database)
+	if err := os.MkdirAll(filepath.Dir(options.PackageReport), 0o755); err != nil {
+		log.Error("Failed to create output directory", "error", err)
+	} else if err := dockerizer.SavePackageReport(report, options.PackageReport); err != nil {
+		log.Error("Failed to save package report", "error", err)
+	} else if err := dockerizer.SaveConfigDrift(report.ConfigDrift, options.ConfigDriftPath); err != nil {
+		log.Error("Failed to save configuration drift report", "error", err)
+	}
+	for _, configFile := range report.ConfigDrift.Modified {
+		log.Info("Detected modified configuration file", "path", configFile.Path, "package", configFile.Package)
+	}
+
+	var basePackages map[string]string
+	if base != nil {
+		basePackages, err = base.InstalledPackages(database)
+		if err != nil {
+			log.Warn("Failed to read the packages of the base image, installing all packages", "error", err)
+		}
+	} else {
+		log.Warn("Without -base-rootfs, packages the base image provides are also pinned to the host's version")
+	}
+	packages := report.InstallablePackages(basePackages)
+	log.Info("Attributed files to packages", "packages", len(report.Packages), "installed", len(packages), "modified", len(report.ModifiedPaths), "unowned", len(report.UnownedPaths))
+	if len(packages) == 0 {
+		return report.CopyPaths(), "", report.ModifiedPaths
+	}
+	return report.CopyPaths(), database.InstallCommand(packages), report.ModifiedPaths
+}
+
+// detectVolumes classifies the paths written at runtime, saves the state report and returns the volume directories
+func detectVolumes(options DockerizeOptions, processInfo *profiler.ProcessInfo) []string {
+	accessProfile, err := profiler.LoadAccessProfile(options.AccessFile)
+	if err != nil {
+		log.Warn("No access profile found, skipping volume detection", "error", err)
+		return nil
+	}
+	rules, err := profiler.LoadFilterRules(options.RulesFile, processInfo.DistributionIDs())
+	if err != nil {
+		log.Fatalf("Failed to load filter rules: %v", err)
+	}
+
+	report := dockerizer.DetectStateDirectories(accessProfile, rules)
+	if err := os.MkdirAll(filepath.Dir(options.StateReportPath), 0o755); err != nil {
+		log.Error("Failed to create output directory", "error", err)
+	} else if err := dockerizer.SaveStateReport(report, options.StateReportPath); err != nil {
+		log.Error("Failed to save state report", "error", err)
+	}
+
+	for _, volume := range report.Volumes {
+		log.Info("Detected state directory", "volume", volume)
+	}
+	return report.Volumes
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"application_profiling/internal/adapter"
+	"application_profiling/internal/dockerizer"
+	"application_profiling/internal/profiler"
+
+	"github.com/charmbracelet/log"
+)
+
+// KubernetesOptions represents the options for the Kubernetes command
+type KubernetesOptions struct {
+	ProcessInfoFile string
+	AccessFile      string
+	ManifestPath    string
+	RulesFile       string
+	AdaptersFile    string
+	Manifests       dockerizer.KubernetesOptions
+}
+
+// RunKubernetes handles the "kubernetes" command logic
+func RunKubernetes(arguments []string) {
+	// Parse command-line arguments
+	options := parseKubernetesArguments(arguments)
+
+	// Generate the Kubernetes manifests
+	executeKubernetes(options)
+}
+
+// parseKubernetesArguments generates KubernetesOptions using the provided flags and PID
+func parseKubernetesArguments(arguments []string) KubernetesOptions {
+	// Initialize a flag set and define the kubernetes flags
+	flagSet := flag.NewFlagSet("kubernetes", flag.ExitOnError)
+	rulesFile := flagSet.String("rules", "", "YAML file with filter rules added to the built-in defaults")
+	adaptersFile := flagSet.String("adapters", "", "YAML file with application adapters added to the built-in ones")
+	image := flagSet.String("image-name", "", "Image of the container (default: vm2container/<pid>:latest)")
+	headroom := flagSet.Float64("headroom", 1.5, "Factor applied to the observed CPU and memory usage for the resource requests")
+	limitFactor := flagSet.Float64("limit-factor", 2, "Factor applied to the resource requests for the resource limits")
+	volumeSize := flagSet.String("volume-size", "1Gi", "Storage requested for every state directory")
+	configDirectories := flagSet.String("config-dirs", "", "Comma-separated configuration directories to turn into ConfigMaps")
+	flagSet.Parse(arguments)
+	if *headroom < 1 || *limitFactor < 1 {
+		log.Fatalf("The -headroom and -limit-factor must be at least 1.")
+	}
+
+	// Retrieve the main application PID
+	if flagSet.NArg() < 1 {
+		log.Fatalf("No PID given for the Kubernetes manifests.")
+	}
+	pid := flagSet.Arg(0)
+	if *image == "" {
+		*image = fmt.Sprintf("vm2container/%s:latest", pid)
+	}
+
+	var directories []string
+	for _, directory := range strings.Split(*configDirectories, ",") {
+		if directory = strings.TrimSpace(directory); directory != "" {
+			directories = append(directories, filepath.Clean(directory))
+		}
+	}
+
+	return KubernetesOptions{
+		ProcessInfoFile: fmt.Sprintf("output/%s/profile/process_info.yaml", pid),
+		AccessFile:      fmt.Sprintf("output/%s/profile/access_merged.yaml", pid),
+		ManifestPath:    fmt.Sprintf("output/%s/kubernetes/manifests.yaml", pid),
+		RulesFile:       *rulesFile,
+		AdaptersFile:    *adaptersFile,
+		Manifests: dockerizer.KubernetesOptions{
+			Image:             *image,
+			Headroom:          *headroom,
+			LimitFactor:       *limitFactor,
+			VolumeSize:        *volumeSize,
+			ConfigDirectories: directories,
+		},
+	}
+}
+
+// executeKubernetes loads the profile and writes the Kubernetes manifests
+func executeKubernetes(options KubernetesOptions) {
+	// 1. Load process information and the application adapters
+	log.Info("Loading static process information...")
+	processInfo := profiler.LoadFromYAML(options.ProcessInfoFile)
+	adapters, err := adapter.LoadRegistry(options.AdaptersFile)
+	if err != nil {
+		log.Fatalf("Failed to load application adapters: %v", err)
+	}
+
+	// 2. Detect application state directories from the access profile
+	log.Info("Detecting application state directories...")
+	volumes := loadStateDirectories(options.AccessFile, options.RulesFile, processInfo.DistributionIDs())
+
+	// 3. Generate the manifests
+	log.Info("Generating Kubernetes manifests...")
+	if err := os.MkdirAll(filepath.Dir(options.ManifestPath), 0o755); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+	objects, err := dockerizer.GenerateKubernetesManifests(processInfo, volumes, adapters, options.Manifests, options.ManifestPath)
+	if err != nil {
+		log.Fatalf("Failed to generate Kubernetes manifests: %v", err)
+	}
+
+	for _, object := range objects {
+		log.Info("Generated Kubernetes object", "object", object)
+	}
+	log.Info("Kubernetes manifests written", "path", options.ManifestPath)
+}
@@ -2,12 +2,17 @@ package commands
 
 import (
 	"flag"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"application_profiling/internal/adapter"
 	"application_profiling/internal/profiler"
 	"application_profiling/internal/util"
+	"application_profiling/internal/workload"
 
 	"github.com/charmbracelet/log"
 )
@@ -15,6 +20,16 @@ import (
 // ProfileOptions represents the options for the Profile command
 type ProfileOptions struct {
 	TraceWaitDuration time.Duration
+	StopTimeout       time.Duration
+	ReadyTimeout      time.Duration
+	SampleInterval    time.Duration
+	Attach            bool
+	NoRestore         bool
+	TracerBackend     string
+	RulesFile         string
+	AdaptersFile      string
+	SystemdRoot       string
+	Workloads         []workload.Driver
 	ProcessIDs        []int
 }
 
@@ -23,24 +38,57 @@ func RunProfile(arguments []string) {
 	// Parse command line arguments
 	options := parseProfileArguments(arguments)
 
-	// Profile each process
+	// Load the application adapters, which know the configuration files worth parsing
+	adapters, err := adapter.LoadRegistry(options.AdaptersFile)
+	if err != nil {
+		log.Fatalf("Failed to load application adapters: %v", err)
+	}
+
+	// Profile each process, keeping the filter rules to apply to the paths found in configuration files
+	// and the executables the configuration parsers query for their built-in defaults
+	var rules *profiler.FilterRules
+	var executablePaths []string
 	for _, processID := range options.ProcessIDs {
-		profileProcess(processID, options.TraceWaitDuration)
+		var processInfo *profiler.ProcessInfo
+		processInfo, rules = profileProcess(processID, options)
+		executablePaths = append(executablePaths, processInfo.ExecutablePath)
 	}
 
 	// Merge filtered logs from all processes
 	log.Info("Merging filtered logs...")
-	util.MergeFilteredLogs(options.ProcessIDs)
+	util.MergeFilteredLogs(options.ProcessIDs, executablePaths, adapters.ConfigFiles(), rules)
+	util.MergeAccessProfiles(options.ProcessIDs)
 	log.Info("Data collection complete.")
 }
 
 // parseProfileArguments parses command line arguments for the profile command
 func parseProfileArguments(arguments []string) ProfileOptions {
-	// Initialize a flag set and define the trace-wait flag
+	// Initialize a flag set and define the profile flags
 	flagSet := flag.NewFlagSet("profile", flag.ExitOnError)
 	traceWait := flagSet.Int("trace-wait", 5, "Duration (in seconds) to wait while the tracer captures data")
+	stopTimeout := flagSet.Int("stop-timeout", 10, "Seconds to wait for the process to exit after SIGTERM before sending SIGKILL")
+	readyTimeout := flagSet.Int("ready-timeout", 60, "Seconds to wait for the restarted process to listen on its ports and sockets")
+	sampleInterval := flagSet.Int("sample-interval", 500, "Milliseconds between two resource samples of the process tree while tracing (0 disables sampling)")
+	attach := flagSet.Bool("attach", false, "Trace the running process instead of restarting it")
+	noRestore := flagSet.Bool("no-restore", false, "Leave the application running as started by the tracer instead of restoring it")
+	tracerBackend := flagSet.String("tracer", "auto", "Tracer backend: strace, ptrace or auto")
+	rulesFile := flagSet.String("rules", "", "YAML file with filter rules added to the built-in defaults")
+	adaptersFile := flagSet.String("adapters", "", "YAML file with application adapters added to the built-in ones")
+	systemdRoot := flagSet.String("systemd-root", "/", "Root directory to load systemd unit files from")
+	workloadSelection := flagSet.String("workload", "auto", "Comma-separated workload drivers: http, tcp, unix, script, requests, auto or none")
+	workloadScript := flagSet.String("workload-script", "", "Script run by the script workload driver")
+	workloadRequests := flagSet.String("workload-requests", "", "Request list replayed by the requests workload driver")
 	flagSet.Parse(arguments)
 
+	// Create the workload drivers
+	workloads, err := workload.NewDrivers(*workloadSelection, workload.Options{
+		ScriptPath:   *workloadScript,
+		RequestsPath: *workloadRequests,
+	})
+	if err != nil {
+		log.Fatalf("Invalid workload: %v", err)
+	}
+
 	// Convert traceWait to a duration
 	traceWaitDuration := time.Duration(*traceWait) * time.Second
 
@@ -49,6 +97,16 @@ func parseProfileArguments(arguments []string) ProfileOptions {
 
 	return ProfileOptions{
 		TraceWaitDuration: traceWaitDuration,
+		StopTimeout:       time.Duration(*stopTimeout) * time.Second,
+		ReadyTimeout:      time.Duration(*readyTimeout) * time.Second,
+		SampleInterval:    time.Duration(*sampleInterval) * time.Millisecond,
+		Attach:            *attach,
+		NoRestore:         *noRestore,
+		TracerBackend:     *tracerBackend,
+		RulesFile:         *rulesFile,
+		AdaptersFile:      *adaptersFile,
+		SystemdRoot:       *systemdRoot,
+		Workloads:         workloads,
 		ProcessIDs:        processIDs,
 	}
 }
@@ -76,24 +134,93 @@ func getProcessIDs(arguments []string) []int {
 	return processIDs
 }
 
-// profileProcess profiles a single process by ID
-func profileProcess(processID int, traceWaitDuration time.Duration) {
+// profileProcess profiles a single process by ID and returns its information and the filter
+// rules used for its paths
+func profileProcess(processID int, options ProfileOptions) (*profiler.ProcessInfo, *profiler.FilterRules) {
 	// 1. Retrieve process information
 	log.Info("Collecting static process information...")
-	processInfo := profiler.GetProcessInfo(processID)
+	processInfo := profiler.GetProcessInfo(processID, options.SystemdRoot)
 
 	// 2. Log debug information
 	util.LogProcessDetails(processInfo)
 
+	// Load the filter rules for the host distribution before tracing, so invalid rules fail early
+	rules, err := profiler.LoadFilterRules(options.RulesFile, processInfo.DistributionIDs())
+	if err != nil {
+		log.Fatalf("Failed to load filter rules: %v", err)
+	}
+
 	// 3. Save process information to a YAML file
 	log.Info("Saving process metadata as YAML...")
 	processInfo.SaveAsYAML()
 	log.Info("Static analysis complete.")
 
-	// 4. Restart the process with strace monitoring
-	profiler.RestartProcess(processInfo, traceWaitDuration)
+	// 4. Trace the process: attach to it as-is, or restart it under the tracer
+	traceOptions := profiler.TraceOptions{
+		Duration:       options.TraceWaitDuration,
+		Backend:        options.TracerBackend,
+		Workloads:      options.Workloads,
+		StopTimeout:    options.StopTimeout,
+		ReadyTimeout:   options.ReadyTimeout,
+		SampleInterval: options.SampleInterval,
+	}
+	var traceResult profiler.TraceResult
+	if options.Attach {
+		traceResult = profiler.AttachProcess(processInfo, traceOptions)
+	} else {
+		// Make sure the application is restored, even if profiling fails or is interrupted
+		var restorer *profiler.Restorer
+		if !options.NoRestore {
+			restorer = profiler.NewRestorer(processInfo, traceOptions)
+			traceOptions.Restarting = restorer.MarkRestarted
+			stopRestoreOnInterrupt := restoreOnInterrupt(restorer)
+			defer stopRestoreOnInterrupt()
+		}
+
+		traceResult = profiler.RestartProcess(processInfo, traceOptions)
+
+		// Restore the original process
+		if restorer != nil {
+			if err := restorer.Restore(); err != nil {
+				log.Error("Failed to restore the original process", "error", err)
+			}
+		}
+	}
+
+	// 5. Persist the structured trace events and the resource samples
+	profiler.SaveEventsAsJSONL(processInfo, traceResult.Events)
+	profiler.SaveResourceSamplesAsJSONL(processInfo, traceResult.ResourceSamples)
+
+	// Update the process metadata with the measured startup time and the sampled resource usage
+	processInfo.SaveAsYAML()
 
-	// 5. Filter the strace log file to remove duplicates and invalid paths
-	log.Info("Filtering raw strace log...")
-	profiler.FilterStraceLog(processInfo)
+	// 6. Filter the trace events to remove duplicates and invalid paths
+	log.Info("Filtering trace events...")
+	profiler.FilterTraceEvents(processInfo, traceResult, rules)
+	return processInfo, rules
+}
+
+// restoreOnInterrupt restores the application when profiling is interrupted (Ctrl-C or SIGTERM)
+// and exits. It returns a function that removes the handler.
+func restoreOnInterrupt(restorer *profiler.Restorer) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case receivedSignal := <-signals:
+			log.Warn("Profiling interrupted, restoring the original process...", "signal", receivedSignal)
+			if err := restorer.Restore(); err != nil {
+				log.Error("Failed to restore the original process", "error", err)
+			}
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
 }
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"application_profiling/internal/profiler"
+
+	"github.com/charmbracelet/log"
+)
+
+// RulesOptions represents the options for the Rules command
+type RulesOptions struct {
+	RulesFile    string
+	Distribution string
+	Paths        []string
+}
+
+// RunRules handles the "rules" command logic
+func RunRules(arguments []string) {
+	if len(arguments) < 1 || arguments[0] != "test" {
+		log.Fatalf("Unknown rules subcommand, expected: rules test [-rules file] [-distro name] <path>...")
+	}
+
+	// Parse command-line arguments
+	options := parseRulesArguments(arguments[1:])
+
+	// Show which rule decides each path
+	testRules(options)
+}
+
+// parseRulesArguments parses command line arguments for the rules test command
+func parseRulesArguments(arguments []string) RulesOptions {
+	// Initialize a flag set and define the rules flags
+	flagSet := flag.NewFlagSet("rules test", flag.ExitOnError)
+	rulesFile := flagSet.String("rules", "", "YAML file with filter rules added to the built-in defaults")
+	distribution := flagSet.String("distro", "", "Distribution ID of the rule set to apply, e.g. rhel (default: the host distribution)")
+	flagSet.Parse(arguments)
+
+	if flagSet.NArg() == 0 {
+		log.Fatalf("No paths given to test.")
+	}
+
+	return RulesOptions{
+		RulesFile:    *rulesFile,
+		Distribution: *distribution,
+		Paths:        flagSet.Args(),
+	}
+}
+
+// testRules prints the verdict, the matching rule and the collapse target of each path
+func testRules(options RulesOptions) {
+	distributions := []string{options.Distribution}
+	if options.Distribution == "" {
+		distributions = profiler.GetDistributionIDs()
+	}
+
+	rules, err := profiler.LoadFilterRules(options.RulesFile, distributions)
+	if err != nil {
+		log.Fatalf("Failed to load filter rules: %v", err)
+	}
+
+	fmt.Printf("Distribution: %s\n", strings.Join(distributions, " "))
+	for _, path := range options.Paths {
+		match := rules.Match(path)
+		rule := match.Rule
+		if rule == "" {
+			rule = "(no rule matched)"
+		}
+
+		fmt.Printf("\n%s\n", path)
+		fmt.Printf("  verdict:   %s\n", match.Verdict)
+		fmt.Printf("  rule:      %s\n", rule)
+		if match.Verdict != profiler.VerdictGeneric && match.Verdict != profiler.VerdictExcluded {
+			fmt.Printf("  collapses: %s\n", rules.CollapseTarget(path))
+		}
+	}
+}
@@ -27,8 +27,14 @@ func main() {
 		printUsageAndExit()
 	case "dockerize":
 		commands.RunDockerize(arguments)
+	case "compose":
+		commands.RunCompose(arguments)
+	case "kubernetes":
+		commands.RunKubernetes(arguments)
 	case "profile":
 		commands.RunProfile(arguments)
+	case "rules":
+		commands.RunRules(arguments)
 	default:
 		printUsageAndExit()
 	}
@@ -46,16 +52,164 @@ Commands:
 
   dockerize   Generate container artifacts for the profiled application.
               Requires the main application PID of the profiled processes.
+              Also writes a Podman Quadlet file and a systemd unit for the image.
+
+  compose     Generate a docker-compose.yml for one or more profiled applications.
+              Requires their profile directories (output/<pid>/profile), each
+              dockerized first. Services depend on the services whose ports or
+              Unix sockets their application was connected to.
+
+  kubernetes  Generate Kubernetes manifests for the profiled application: a
+              Deployment (a StatefulSet if it has state directories), a Service
+              per listening port, ConfigMaps for its configuration directories
+              and resource requests and limits from the observed usage.
+              Requires the main application PID of the profiled processes.
+
+  rules test  Show which filter rule matches each of the given paths, and the
+              directory the path collapses to.
 
 Flags:
   -trace-wait <seconds>    (profile only) Duration to wait while capturing
                            runtime data. Default: 5 seconds.
 
+  -stop-timeout <seconds>  (profile only) Time to wait for the process to exit
+                           after SIGTERM before sending SIGKILL. Default: 10.
+
+  -ready-timeout <seconds> (profile only) Time to wait for the restarted process
+                           to listen on its recorded ports and sockets before
+                           sending traffic. The measured startup time is saved
+                           in process_info.yaml. Default: 60.
+
+  -sample-interval <ms>    (profile only) Time between two resource samples of
+                           the process tree while tracing. The min/avg/p95/max
+                           are saved in process_info.yaml. 0 disables sampling.
+                           Default: 500.
+
+  -attach                  (profile only) Attach to the running process
+                           instead of restarting it. Files opened before
+                           tracing are recovered from /proc/<pid>/maps and fd.
+
+  -no-restore              (profile only) Leave the application running as
+                           started by the tracer. By default, the original
+                           process is relaunched after profiling (also on
+                           Ctrl-C or errors) with its recorded command, user,
+                           working directory and environment, and its ports
+                           are verified to be listening again.
+
+  -systemd-root <dir>      (profile only) Root directory to load systemd unit
+                           files from, e.g. a fixture tree. Processes owned by
+                           a systemd service are restarted through the unit
+                           manager with a temporary drop-in that runs ExecStart
+                           under strace. Default: /.
+
+  -tracer <backend>        (profile only) Tracer backend: strace, ptrace (native
+                           Go tracer, no strace needed, run as root) or auto.
+                           Default: auto.
+
+  -workload <drivers>      (profile only) Comma-separated workload drivers run
+                           during the whole trace window: http (GET on every
+                           listening TCP port, HTTPS or HTTP), tcp (connect and
+                           read banner), unix (connect to Unix sockets), script,
+                           requests, auto (http,unix) or none. Default: auto.
+
+  -workload-script <file>  (profile only) Shell script for the script driver.
+                           Receives WORKLOAD_PID, WORKLOAD_TCP_PORTS and
+                           WORKLOAD_UNIX_SOCKETS in its environment.
+
+  -workload-requests <file>
+                           (profile only) Request list for the requests driver,
+                           one "<METHOD> <url> [body]", "tcp <host:port> [payload]"
+                           or "unix <socket> [payload]" per line.
+
+  -rules <file>            (profile, dockerize, compose, kubernetes, rules test) YAML filter rules
+                           added to the built-in defaults: generic paths,
+                           include/exclude prefixes, globs and regexes,
+                           collapse boundaries and per-distro rule sets.
+
+  -adapters <file>         (profile, dockerize, kubernetes) YAML file with application
+                           adapters added to the built-in ones (nginx, mysqld,
+                           redis, apache2/httpd, postgres, php-fpm, haproxy,
+                           memcached). Adapters force foreground mode, set the
+                           stop signal and healthcheck and name the configuration
+                           files of the application. Files of the nginx and mysql
+                           parsers are parsed for paths the trace missed.
+
+  -base <image>            (dockerize only) Base image of the Dockerfile.
+                           Default: the image of the host OS. "scratch"
+                           builds a self-contained root filesystem with only
+                           the profiled files, the dynamic loader, required
+                           libraries and minimal passwd, group and
+                           nsswitch.conf files.
+
+  -base-rootfs <path>      (dockerize only) Root filesystem of the base image,
+                           as an exported tarball ("docker export") or an OCI
+                           image layout directory. Profiled files the base
+                           image has with the same content, mode and owner
+                           are left out of the archive; files that differ
+                           are listed in base_diff.yaml and replace the base
+                           image's version through the overrides layer.
+
+  -layer-rules <file>      (dockerize only) YAML file with image layers replacing
+                           the built-in ones (system libraries, application
+                           binaries, application config, static content).
+                           Each layer is a separate archive and Dockerfile
+                           instruction; sizes are saved in layers.yaml.
+
+  -image <format>          (dockerize only) Also write the image without Docker,
+                           with -base scratch: "oci" writes an OCI image
+                           layout directory (oci/), "docker-archive" also a
+                           tarball for "docker load" (image.tar). The layout is
+                           validated against the OCI image specification.
+
+  -packages                (dockerize only) Install files owned by dpkg or apk
+                           packages with the package manager, pinned to the
+                           installed version. Packages of the base image given
+                           with -base-rootfs keep its version and are not
+                           installed. Only unowned files and package
+                           files whose checksum differs from the packaged one
+                           are archived. The attribution is saved in
+                           packages.yaml, changed configuration files in
+                           config_drift.yaml.
+
+  -output <dir>            (compose only) Directory to write docker-compose.yml
+                           and one env file per service to.
+                           Default: output/compose.
+
+  -image-name <name>       (kubernetes only) Image of the container.
+                           Default: vm2container/<pid>:latest.
+
+  -headroom <factor>       (kubernetes only) Factor applied to the observed CPU
+                           and memory usage for the resource requests.
+                           Default: 1.5.
+
+  -limit-factor <factor>   (kubernetes only) Factor applied to the resource
+                           requests for the resource limits. Default: 2.
+
+  -volume-size <size>      (kubernetes only) Storage requested for every state
+                           directory of a StatefulSet. Default: 1Gi.
+
+  -config-dirs <dirs>      (kubernetes only) Comma-separated configuration
+                           directories to turn into ConfigMaps, next to those
+                           of the application adapter (e.g. /etc/nginx).
+
+  -distro <id>             (rules test only) Distribution ID of the rule set to
+                           apply, e.g. rhel. Default: the os-release ID of the
+                           host, then its ID_LIKE IDs.
+
   -h, --help               Display this help message.
 
 Examples:
   vm2container profile -trace-wait 10 1234,5678
+  vm2container profile -attach 5678
+  vm2container profile -workload tcp,requests -workload-requests reqs.txt 5678
   vm2container dockerize 5678
+  vm2container dockerize -packages 5678
+  vm2container dockerize -base scratch 5678
+  vm2container dockerize -layer-rules my-layers.yaml 5678
+  vm2container dockerize -base scratch -image docker-archive 5678
+  vm2container compose output/1234/profile output/5678/profile
+  vm2container kubernetes -headroom 2 -config-dirs /etc/myapp 5678
+  vm2container rules test -rules my-rules.yaml /etc/nginx/conf.d/default.conf
 
 For detailed documentation, see the README.
     `)
@@ -0,0 +1,314 @@
+package adapter
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"application_profiling/internal/profiler"
+
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed adapters/default.yaml
+var defaultAdaptersData []byte
+
+// Adapter holds the knowledge about one application.
+type Adapter struct {
+	Name        string       `yaml:"name"`
+	Executables []string     `yaml:"executables"`
+	Foreground  Foreground   `yaml:"foreground"`
+	Configs     []ConfigSet  `yaml:"configs"`
+	StopSignal  string       `yaml:"stopsignal"`
+	Healthcheck *Healthcheck `yaml:"healthcheck"`
+}
+
+// Foreground describes the argument changes that keep an application in the foreground.
+type Foreground struct {
+	Remove  []string          `yaml:"remove"`
+	Replace map[string]string `yaml:"replace"`
+	Append  []string          `yaml:"append"`
+	Present []string          `yaml:"present"`
+	Merge   bool              `yaml:"merge"` // Join the appended option's value into an existing occurrence of the option
+}
+
+// ConfigSet lists configuration files and the parser that reads them, if any.
+type ConfigSet struct {
+	Parser string   `yaml:"parser"`
+	Files  []string `yaml:"files"`
+}
+
+// Healthcheck describes a HEALTHCHECK instruction.
+type Healthcheck struct {
+	Command     string `yaml:"command"`
+	Interval    string `yaml:"interval"`
+	Timeout     string `yaml:"timeout"`
+	StartPeriod string `yaml:"startperiod"`
+	Retries     int    `yaml:"retries"`
+}
+
+// adaptersFile is the layout of an adapters YAML file.
+type adaptersFile struct {
+	Adapters []Adapter `yaml:"adapters"`
+}
+
+// Registry finds the adapter of an application by its executable.
+type Registry struct {
+	adapters []Adapter
+}
+
+// genericAdapter is used for executables without an adapter
+var genericAdapter = Adapter{
+	Name: "generic",
+	Foreground: Foreground{
+		Replace: map[string]string{"daemon on": "daemon off"},
+	},
+}
+
+// LoadRegistry loads the built-in adapters and the adapters of the user file, if given.
+// A user adapter replaces the built-in adapter with the same name.
+func LoadRegistry(userAdaptersPath string) (*Registry, error) {
+	registry := &Registry{}
+	if err := registry.addAdaptersData(defaultAdaptersData); err != nil {
+		return nil, fmt.Errorf("invalid default adapters: %w", err)
+	}
+
+	if userAdaptersPath != "" {
+		data, err := os.ReadFile(userAdaptersPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.addAdaptersData(data); err != nil {
+			return nil, fmt.Errorf("invalid adapters file %s: %w", userAdaptersPath, err)
+		}
+	}
+
+	return registry, nil
+}
+
+// addAdaptersData parses an adapters file and adds its adapters ahead of the known ones
+func (registry *Registry) addAdaptersData(data []byte) error {
+	var file adaptersFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return err
+	}
+
+	for _, adapter := range file.Adapters {
+		if adapter.Name == "" || len(adapter.Executables) == 0 {
+			return fmt.Errorf("adapter needs a name and executables")
+		}
+		for _, pattern := range adapter.Executables {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("adapter %s: invalid executable pattern %q", adapter.Name, pattern)
+			}
+		}
+		for _, configSet := range adapter.Configs {
+			if configSet.Parser != "" && !profiler.HasConfigParser(configSet.Parser) {
+				return fmt.Errorf("adapter %s: unknown config parser %q", adapter.Name, configSet.Parser)
+			}
+		}
+	}
+
+	// Later files take precedence: drop replaced adapters and check the new ones first
+	kept := file.Adapters
+	for _, known := range registry.adapters {
+		if !containsAdapter(file.Adapters, known.Name) {
+			kept = append(kept, known)
+		}
+	}
+	registry.adapters = kept
+	return nil
+}
+
+// containsAdapter checks if an adapter with the given name is in the list
+func containsAdapter(adapters []Adapter, name string) bool {
+	for _, adapter := range adapters {
+		if adapter.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the adapter of the executable, or the generic adapter if none matches
+func (registry *Registry) Find(executablePath string) Adapter {
+	executable := path.Base(executablePath)
+	for _, adapter := range registry.adapters {
+		for _, pattern := range adapter.Executables {
+			if matched, _ := path.Match(pattern, executable); matched {
+				return adapter
+			}
+		}
+	}
+	return genericAdapter
+}
+
+// ForegroundArguments applies the foreground rules to the arguments of a command.
+// The first argument is the executable and is kept as-is.
+func (adapter Adapter) ForegroundArguments(arguments []string) []string {
+	if len(arguments) == 0 {
+		return arguments
+	}
+	foreground := adapter.Foreground
+	result := []string{arguments[0]}
+	remaining := arguments[1:]
+
+	// 1. Drop daemonizing arguments
+	for len(remaining) > 0 {
+		if length := matchRemoval(foreground.Remove, remaining); length > 0 {
+			remaining = remaining[length:]
+			continue
+		}
+		result = append(result, remaining[0])
+		remaining = remaining[1:]
+	}
+
+	// 2. Rewrite arguments that switch daemon mode on
+	for i := 1; i < len(result); i++ {
+		for from, to := range foreground.Replace {
+			result[i] = strings.ReplaceAll(result[i], from, to)
+		}
+	}
+
+	// 3. Add the foreground arguments unless foreground mode is already set
+	if len(foreground.Append) > 0 && !containsMarker(result[1:], foreground.Present) {
+		if !foreground.Merge || !mergeOption(result, foreground.Append) {
+			result = append(result, foreground.Append...)
+		}
+	}
+	return result
+}
+
+// mergeOption joins the value of an "<option> <value>" pair into the value of the option's
+// first occurrence, e.g. for applications that reject an option given twice.
+// It reports whether the option was found.
+func mergeOption(arguments, option []string) bool {
+	if len(option) != 2 {
+		return false
+	}
+	for i := 1; i+1 < len(arguments); i++ {
+		if arguments[i] == option[0] {
+			arguments[i+1] = strings.TrimSpace(arguments[i+1]) + " " + option[1]
+			return true
+		}
+	}
+	return false
+}
+
+// matchRemoval returns the number of leading arguments matched by one of the removal entries
+func matchRemoval(removals, arguments []string) int {
+	for _, removal := range removals {
+		words := strings.Fields(removal)
+		if len(words) == 0 || len(words) > len(arguments) {
+			continue
+		}
+		matched := true
+		for i, word := range words {
+			if arguments[i] != word {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return len(words)
+		}
+	}
+	return 0
+}
+
+// containsMarker checks if any argument contains one of the markers
+func containsMarker(arguments, markers []string) bool {
+	for _, argument := range arguments {
+		for _, marker := range markers {
+			if strings.Contains(argument, marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HealthcheckInstruction renders the arguments of a HEALTHCHECK instruction for the given TCP ports.
+// It returns an empty string if the adapter has no healthcheck or it needs a port the application does not have.
+func (adapter Adapter) HealthcheckInstruction(tcpPorts []int) string {
+	command := adapter.HealthcheckCommand(tcpPorts)
+	if command == "" {
+		return ""
+	}
+
+	healthcheck := adapter.Healthcheck
+	var options []string
+	if healthcheck.Interval != "" {
+		options = append(options, "--interval="+healthcheck.Interval)
+	}
+	if healthcheck.Timeout != "" {
+		options = append(options, "--timeout="+healthcheck.Timeout)
+	}
+	if healthcheck.StartPeriod != "" {
+		options = append(options, "--start-period="+healthcheck.StartPeriod)
+	}
+	if healthcheck.Retries > 0 {
+		options = append(options, fmt.Sprintf("--retries=%d", healthcheck.Retries))
+	}
+	return strings.Join(append(options, "CMD", command), " ")
+}
+
+// HealthcheckCommand returns the shell command of the healthcheck for the given TCP ports, or an
+// empty string if the adapter has no healthcheck or it needs a port the application does not have
+func (adapter Adapter) HealthcheckCommand(tcpPorts []int) string {
+	healthcheck := adapter.Healthcheck
+	if healthcheck == nil || healthcheck.Command == "" {
+		return ""
+	}
+
+	command := healthcheck.Command
+	if strings.Contains(command, "{{port}}") {
+		if len(tcpPorts) == 0 {
+			return ""
+		}
+		command = strings.ReplaceAll(command, "{{port}}", fmt.Sprint(tcpPorts[0]))
+	}
+	return command
+}
+
+// ConfigFiles returns the parsed configuration files of all adapters that exist on this host,
+// mapped to the name of the parser that reads them
+func (registry *Registry) ConfigFiles() map[string]string {
+	configFiles := make(map[string]string)
+	for _, adapter := range registry.adapters {
+		for _, configSet := range adapter.Configs {
+			if configSet.Parser == "" {
+				continue
+			}
+			for _, pattern := range configSet.Files {
+				matches, _ := filepath.Glob(pattern)
+				for _, match := range matches {
+					configFiles[match] = configSet.Parser
+				}
+			}
+		}
+	}
+	return configFiles
+}
+
+// ConfigDirectories returns the directories holding the configuration files of the adapter
+// that exist on this host, leaving out top-level directories such as /etc
+func (adapter Adapter) ConfigDirectories() []string {
+	var directories []string
+	for _, configSet := range adapter.Configs {
+		for _, pattern := range configSet.Files {
+			matches, _ := filepath.Glob(pattern)
+			for _, match := range matches {
+				directory := filepath.Dir(match)
+				if filepath.Dir(directory) != "/" && !slices.Contains(directories, directory) {
+					directories = append(directories, directory)
+				}
+			}
+		}
+	}
+	return directories
+}
@@ -0,0 +1,122 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadRegistryConfigParsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "known parser",
+			data: "adapters:\n  - name: web\n    executables: [web]\n    configs:\n      - parser: nginx\n        files: [/etc/web/nginx.conf]\n",
+		},
+		{
+			name: "config files without a parser",
+			data: "adapters:\n  - name: cache\n    executables: [cache]\n    configs:\n      - files: [/etc/cache/cache.conf]\n",
+		},
+		{
+			name:    "unknown parser",
+			data:    "adapters:\n  - name: redis\n    executables: [redis-server]\n    configs:\n      - parser: redis\n        files: [/etc/redis/redis.conf]\n",
+			wantErr: `adapter redis: unknown config parser "redis"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adaptersPath := filepath.Join(t.TempDir(), "adapters.yaml")
+			if err := os.WriteFile(adaptersPath, []byte(test.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadRegistry(adaptersPath)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Errorf("LoadRegistry() failed: %v", err)
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Errorf("LoadRegistry() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigFilesOnlyListsParsedFiles(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"web.conf", "cache.conf"} {
+		if err := os.WriteFile(filepath.Join(directory, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := "adapters:\n" +
+		"  - name: web\n    executables: [web]\n    configs:\n      - parser: nginx\n        files: [" + filepath.Join(directory, "web.conf") + "]\n" +
+		"  - name: cache\n    executables: [cache]\n    configs:\n      - files: [" + filepath.Join(directory, "cache.conf") + "]\n"
+	adaptersPath := filepath.Join(directory, "adapters.yaml")
+	if err := os.WriteFile(adaptersPath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := LoadRegistry(adaptersPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFiles := registry.ConfigFiles()
+	if configFiles[filepath.Join(directory, "web.conf")] != "nginx" {
+		t.Errorf("ConfigFiles() = %v, want the nginx file", configFiles)
+	}
+	if _, found := configFiles[filepath.Join(directory, "cache.conf")]; found {
+		t.Errorf("ConfigFiles() = %v, want no file without a parser", configFiles)
+	}
+	if directories := registry.Find("cache").ConfigDirectories(); len(directories) != 1 || directories[0] != directory {
+		t.Errorf("ConfigDirectories() = %v, want [%s]", directories, directory)
+	}
+}
+
+func TestNginxForegroundArguments(t *testing.T) {
+	registry, err := LoadRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nginx := registry.Find("/usr/sbin/nginx")
+
+	tests := []struct {
+		name      string
+		arguments []string
+		want      []string
+	}{
+		{
+			name:      "no directives",
+			arguments: []string{"/usr/sbin/nginx"},
+			want:      []string{"/usr/sbin/nginx", "-g", "daemon off;"},
+		},
+		{
+			name:      "directives merged into the existing -g",
+			arguments: []string{"/usr/sbin/nginx", "-c", "/etc/nginx/nginx.conf", "-g", "pid /run/nginx.pid;"},
+			want:      []string{"/usr/sbin/nginx", "-c", "/etc/nginx/nginx.conf", "-g", "pid /run/nginx.pid; daemon off;"},
+		},
+		{
+			name:      "daemon on rewritten",
+			arguments: []string{"/usr/sbin/nginx", "-g", "daemon on; master_process on;"},
+			want:      []string{"/usr/sbin/nginx", "-g", "daemon off; master_process on;"},
+		},
+		{
+			name:      "daemon off kept",
+			arguments: []string{"/usr/sbin/nginx", "-g", "daemon off;"},
+			want:      []string{"/usr/sbin/nginx", "-g", "daemon off;"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := nginx.ForegroundArguments(test.arguments); !slices.Equal(got, test.want) {
+				t.Errorf("ForegroundArguments(%q) = %q, want %q", test.arguments, got, test.want)
+			}
+		})
+	}
+}
@@ -3,35 +3,155 @@ package dockerizer
 import (
 	"archive/tar"
 	"compress/gzip"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+
+	"gopkg.in/yaml.v2"
 )
 
-// CreateTarArchive creates a tar.gz archive from the specified source directory.
-func CreateTarArchive(tarFilePath, sourceDirectory string) error {
+// overrideLayerName is the layer of the profile files that replace files of the base image
+const overrideLayerName = "overrides"
+
+// LayerArchive is a layer of the profile, written as a tar.gz archive.
+type LayerArchive struct {
+	Name             string `yaml:"name"`
+	File             string `yaml:"file"`             // Archive file name, next to the Dockerfile
+	Entries          int    `yaml:"entries"`          // Files, symlinks and empty directories of the layer
+	Size             int64  `yaml:"size"`             // Compressed size in bytes
+	UncompressedSize int64  `yaml:"uncompressedsize"` // Size of the tar stream in bytes
+	Overwrite        bool   `yaml:"overwrite"`        // Whether the files replace those of the base image
+}
+
+// CreateLayerArchives splits the profile directory into ordered layers by the layer rules and
+// writes one tar.gz archive per non-empty layer to the output directory. Every archive holds
+// the parent directories of its entries, with the permissions and ownership of the profile.
+// The override paths (image paths, e.g. files that differ from the base image) go into a last
+// layer that is extracted over the files of the base image.
+func CreateLayerArchives(profileDirectory, outputDirectory string, rules *LayerRules, overridePaths []string) ([]LayerArchive, error) {
+	// Remove the archives of an earlier run, which may have had other layers
+	staleArchives, _ := filepath.Glob(filepath.Join(outputDirectory, "layer-*.tar.gz"))
+	for _, staleArchive := range staleArchives {
+		if err := os.Remove(staleArchive); err != nil {
+			return nil, err
+		}
+	}
+
+	// Assign files, symlinks and empty directories to layers, parents before children
+	entriesByLayer := make([][]string, len(rules.Names()))
+	var overrideEntries []string
+	err := filepath.Walk(profileDirectory, func(currentPath string, fileInfo os.FileInfo, walkError error) error {
+		if walkError != nil || currentPath == profileDirectory {
+			return walkError
+		}
+		if fileInfo.IsDir() {
+			if entries, err := os.ReadDir(currentPath); err != nil || len(entries) > 0 {
+				return err
+			}
+		}
+		relativePath, err := filepath.Rel(profileDirectory, currentPath)
+		if err != nil {
+			return err
+		}
+		imagePath := "/" + filepath.ToSlash(relativePath)
+		if containsString(overridePaths, imagePath) {
+			overrideEntries = append(overrideEntries, currentPath)
+			return nil
+		}
+		layer := rules.Layer(imagePath)
+		entriesByLayer[layer] = append(entriesByLayer[layer], currentPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []LayerArchive
+	for layer, entries := range entriesByLayer {
+		if len(entries) == 0 {
+			continue
+		}
+		archive := LayerArchive{
+			Name:    rules.Names()[layer],
+			File:    fmt.Sprintf("layer-%d-%s.tar.gz", len(archives)+1, rules.Names()[layer]),
+			Entries: len(entries),
+		}
+		if err := writeLayerArchive(&archive, filepath.Join(outputDirectory, archive.File), profileDirectory, entries); err != nil {
+			return nil, fmt.Errorf("failed to write layer %s: %w", archive.Name, err)
+		}
+		archives = append(archives, archive)
+	}
+
+	if len(overrideEntries) > 0 {
+		archive := LayerArchive{
+			Name:      overrideLayerName,
+			File:      fmt.Sprintf("layer-%d-%s.tar.gz", len(archives)+1, overrideLayerName),
+			Entries:   len(overrideEntries),
+			Overwrite: true,
+		}
+		if err := writeLayerArchive(&archive, filepath.Join(outputDirectory, archive.File), profileDirectory, overrideEntries); err != nil {
+			return nil, fmt.Errorf("failed to write layer %s: %w", archive.Name, err)
+		}
+		archives = append(archives, archive)
+	}
+	return archives, nil
+}
+
+// writeLayerArchive writes the entries with their parent directories to a tar.gz archive and records its sizes
+func writeLayerArchive(archive *LayerArchive, archivePath, profileDirectory string, entries []string) error {
 	// Create the tar file on disk.
-	tarFile, err := os.Create(tarFilePath)
+	tarFile, err := os.Create(archivePath)
 	if err != nil {
 		return err
 	}
 	defer tarFile.Close()
 
-	// Wrap the file in a gzip writer and tar writer.
-	gzipWriter := gzip.NewWriter(tarFile)
-	defer gzipWriter.Close()
-
-	tarWriter := tar.NewWriter(gzipWriter)
-	defer tarWriter.Close()
+	// Count the compressed and uncompressed bytes around the gzip writer.
+	compressedCounter := &countingWriter{writer: tarFile}
+	gzipWriter := gzip.NewWriter(compressedCounter)
+	uncompressedCounter := &countingWriter{writer: gzipWriter}
+	tarWriter := tar.NewWriter(uncompressedCounter)
 
-	// Walk through the source directory and add files to the tar archive.
-	return filepath.Walk(sourceDirectory, func(currentPath string, fileInfo os.FileInfo, walkError error) error {
-		if walkError != nil {
-			return walkError
+	addedDirectories := make(map[string]bool)
+	for _, entry := range entries {
+		// Add the parent directories first, from the top
+		var parents []string
+		for parent := filepath.Dir(entry); parent != profileDirectory && !addedDirectories[parent]; parent = filepath.Dir(parent) {
+			parents = append([]string{parent}, parents...)
+			addedDirectories[parent] = true
 		}
+		for _, currentPath := range append(parents, entry) {
+			fileInfo, err := os.Lstat(currentPath)
+			if err != nil {
+				return err
+			}
+			if err := addToTarArchive(tarWriter, profileDirectory, currentPath, fileInfo); err != nil {
+				return err
+			}
+		}
+	}
 
-		return addToTarArchive(tarWriter, sourceDirectory, currentPath, fileInfo)
-	})
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	archive.Size = compressedCounter.count
+	archive.UncompressedSize = uncompressedCounter.count
+	return nil
+}
+
+// SaveLayerReport writes the layers and their sizes to a YAML file.
+func SaveLayerReport(archives []LayerArchive, reportPath string) error {
+	data, err := yaml.Marshal(struct {
+		Layers []LayerArchive `yaml:"layers"`
+	}{archives})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(reportPath, data, 0o644)
 }
 
 // addToTarArchive adds a file or directory to the tar archive.
@@ -0,0 +1,104 @@
+package dockerizer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// archiveEntries lists the entry names of a tar.gz archive
+func archiveEntries(t *testing.T, archivePath string) []string {
+	t.Helper()
+	file, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+}
+
+func TestCreateLayerArchivesOverrides(t *testing.T) {
+	profileDirectory, contextDirectory := t.TempDir(), t.TempDir()
+	for _, name := range []string{"etc/ssl/openssl.cnf", "etc/app/app.conf", "usr/bin/app"} {
+		filePath := filepath.Join(profileDirectory, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules, err := LoadLayerRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archives, err := CreateLayerArchives(profileDirectory, contextDirectory, rules, []string{"/etc/ssl/openssl.cnf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The override is only part of the last layer, which is the only one to overwrite
+	last := archives[len(archives)-1]
+	if last.Name != overrideLayerName || !last.Overwrite || last.Entries != 1 {
+		t.Fatalf("last layer = %+v, want the override layer with one entry", last)
+	}
+	if entries := archiveEntries(t, filepath.Join(contextDirectory, last.File)); !slices.Equal(entries, []string{"etc", "etc/ssl", "etc/ssl/openssl.cnf"}) {
+		t.Errorf("override layer entries = %q", entries)
+	}
+	for _, archive := range archives[:len(archives)-1] {
+		if archive.Overwrite {
+			t.Errorf("layer %s overwrites the base image", archive.Name)
+		}
+		if entries := archiveEntries(t, filepath.Join(contextDirectory, archive.File)); slices.Contains(entries, "etc/ssl/openssl.cnf") {
+			t.Errorf("layer %s holds the override", archive.Name)
+		}
+	}
+
+	// Only the override layer is extracted over the files of the base image
+	dockerfilePath := filepath.Join(contextDirectory, "Dockerfile")
+	if err := writeDockerfile(DockerfileData{Layers: archives, BaseImage: "debian:12"}, dockerfilePath); err != nil {
+		t.Fatal(err)
+	}
+	dockerfile, err := os.ReadFile(dockerfilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, archive := range archives {
+		want := "tar --skip-old-files -xzf /tmp/" + archive.File
+		if archive.Overwrite {
+			want = "tar --no-overwrite-dir -xzf /tmp/" + archive.File
+		}
+		want = fmt.Sprintf("COPY %s /tmp/%s\nRUN %s -C / && rm /tmp/%s", archive.File, archive.File, want, archive.File)
+		if !strings.Contains(string(dockerfile), want) {
+			t.Errorf("Dockerfile does not extract %s with %q:\n%s", archive.File, want, dockerfile)
+		}
+	}
+
+	// The Dockerfile builds without BuildKit
+	if strings.Contains(string(dockerfile), "--mount") {
+		t.Errorf("Dockerfile uses a BuildKit mount:\n%s", dockerfile)
+	}
+}
@@ -0,0 +1,376 @@
+package dockerizer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Whiteout markers of OCI layers: ".wh.<name>" deletes a path of a lower layer,
+// ".wh..wh..opq" hides the whole content a directory has in lower layers
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// Manifest media types that can be read from an OCI image layout
+const (
+	dockerManifestMediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// baseEntry is a file of the base image root filesystem
+type baseEntry struct {
+	typeflag   byte
+	checksum   string // SHA-256 of the content of regular files
+	linkTarget string // Target of symbolic links
+	mode       int64  // Permission bits, with the setuid, setgid and sticky bits
+	uid, gid   int
+}
+
+// permissionBits masks the permission, setuid, setgid and sticky bits of a tar header mode
+const permissionBits = 0o7777
+
+// packageDatabaseFiles are the base image files whose content is kept, to find the packages the base image provides
+var packageDatabaseFiles = []string{dpkgStatusFile, apkInstalledFile}
+
+// BaseRootfs is the file index of a base image root filesystem.
+type BaseRootfs struct {
+	entries  map[string]baseEntry
+	contents map[string][]byte // Content of the package database files
+}
+
+// BaseDifference is a profiled file that also exists in the base image, with other content.
+type BaseDifference struct {
+	Path   string `yaml:"path"`
+	Reason string `yaml:"reason"`
+}
+
+// BaseDiffReport summarizes the comparison of the profile with the base image.
+type BaseDiffReport struct {
+	Base      string           `yaml:"base"`
+	Identical int              `yaml:"identical"` // Files dropped from the profile, as the base image has them
+	Differing []BaseDifference `yaml:"differing"` // Files extracted over the base image's version; likely version skew between host and base image
+}
+
+// DifferingPaths returns the paths of the profile files that differ from the base image
+func (report BaseDiffReport) DifferingPaths() []string {
+	paths := make([]string, 0, len(report.Differing))
+	for _, difference := range report.Differing {
+		paths = append(paths, difference.Path)
+	}
+	return paths
+}
+
+// LoadBaseRootfs indexes the root filesystem of a base image, given as an exported
+// tarball (e.g. "docker export", optionally gzip-compressed) or as an OCI image layout directory.
+func LoadBaseRootfs(basePath string) (*BaseRootfs, error) {
+	base := &BaseRootfs{entries: make(map[string]baseEntry), contents: make(map[string][]byte)}
+	fileInfo, err := os.Stat(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fileInfo.IsDir() {
+		return base, base.addTarFile(basePath, false)
+	}
+
+	layers, err := imageLayers(basePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range layers {
+		if !digestPattern.MatchString(layer.Digest) {
+			return nil, fmt.Errorf("invalid layer digest %q", layer.Digest)
+		}
+		if strings.Contains(layer.MediaType, "zstd") {
+			return nil, fmt.Errorf("layer %s: zstd compression is not supported", layer.Digest)
+		}
+		if err := base.addTarFile(filepath.Join(basePath, blobPath(layer.Digest)), true); err != nil {
+			return nil, fmt.Errorf("layer %s: %w", layer.Digest, err)
+		}
+	}
+	return base, nil
+}
+
+// imageLayers returns the layers of the image in an OCI layout, lowest first.
+// A multi-platform index is resolved to the manifest of this host's architecture.
+func imageLayers(layoutDirectory string) ([]ociDescriptor, error) {
+	var index ociIndex
+	if err := readJSONFile(filepath.Join(layoutDirectory, ociIndexFile), &index); err != nil {
+		return nil, err
+	}
+
+	for {
+		descriptor, err := selectManifest(index.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		switch descriptor.MediaType {
+		case ociIndexMediaType, dockerManifestListMediaType:
+			if err := readBlob(layoutDirectory, descriptor, &index); err != nil {
+				return nil, err
+			}
+		case ociManifestMediaType, dockerManifestMediaType:
+			var manifest ociManifest
+			if err := readBlob(layoutDirectory, descriptor, &manifest); err != nil {
+				return nil, err
+			}
+			return manifest.Layers, nil
+		default:
+			return nil, fmt.Errorf("manifest %s: unsupported mediaType %q", descriptor.Digest, descriptor.MediaType)
+		}
+	}
+}
+
+// selectManifest picks the manifest for this host's platform, or the only one of the index
+func selectManifest(manifests []ociDescriptor) (ociDescriptor, error) {
+	if len(manifests) == 1 {
+		return manifests[0], nil
+	}
+	for _, descriptor := range manifests {
+		if descriptor.Platform != nil && descriptor.Platform.OS == "linux" && descriptor.Platform.Architecture == runtime.GOARCH {
+			return descriptor, nil
+		}
+	}
+	return ociDescriptor{}, fmt.Errorf("no manifest for linux/%s among %d manifests", runtime.GOARCH, len(manifests))
+}
+
+// addTarFile adds the entries of a tarball, which may be gzip-compressed. For image layers,
+// whiteout entries remove the paths they hide instead of being added.
+func (base *BaseRootfs) addTarFile(tarPath string, applyWhiteouts bool) error {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(file, magic); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	} else if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entryPath := path.Clean("/" + header.Name)
+		name := path.Base(entryPath)
+		if applyWhiteouts && name == whiteoutOpaque {
+			base.removeBelow(path.Dir(entryPath))
+			continue
+		}
+		if applyWhiteouts && strings.HasPrefix(name, whiteoutPrefix) {
+			hidden := path.Join(path.Dir(entryPath), strings.TrimPrefix(name, whiteoutPrefix))
+			delete(base.entries, hidden)
+			base.removeBelow(hidden)
+			continue
+		}
+
+		entry := baseEntry{typeflag: header.Typeflag, linkTarget: header.Linkname, mode: header.Mode & permissionBits, uid: header.Uid, gid: header.Gid}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			digest := sha256.New()
+			keepContent := containsString(packageDatabaseFiles, entryPath)
+			var content io.Writer = digest
+			var buffer bytes.Buffer
+			if keepContent {
+				content = io.MultiWriter(digest, &buffer)
+			}
+			if _, err := io.Copy(content, tarReader); err != nil {
+				return err
+			}
+			entry.checksum = hex.EncodeToString(digest.Sum(nil))
+			if keepContent {
+				base.contents[entryPath] = buffer.Bytes()
+			}
+		case tar.TypeLink:
+			// Hard links share the content of the entry they link to
+			linked := base.entries[path.Clean("/"+header.Linkname)]
+			entry = baseEntry{typeflag: tar.TypeReg, checksum: linked.checksum, mode: linked.mode, uid: linked.uid, gid: linked.gid}
+		}
+		base.entries[entryPath] = entry
+	}
+}
+
+// InstalledPackages returns the names and versions of the packages installed in the base image,
+// read from its database of the given package manager
+func (base *BaseRootfs) InstalledPackages(database PackageDatabase) (map[string]string, error) {
+	databaseFile := database.DatabaseFile()
+	content, found := base.contents[databaseFile]
+	if _, exists := base.entries[databaseFile]; !found || !exists {
+		return nil, fmt.Errorf("the base image has no %s database %s", database.Name(), databaseFile)
+	}
+	return database.ReadInstalledPackages(bytes.NewReader(content))
+}
+
+// removeBelow removes the entries below a directory
+func (base *BaseRootfs) removeBelow(directory string) {
+	prefix := strings.TrimSuffix(directory, "/") + "/"
+	for entryPath := range base.entries {
+		if strings.HasPrefix(entryPath, prefix) {
+			delete(base.entries, entryPath)
+		}
+	}
+}
+
+// lookup finds a path in the base image, following symbolic links of its parent
+// directories (e.g. /lib -> usr/lib on merged-/usr images)
+func (base *BaseRootfs) lookup(filePath string) (baseEntry, bool) {
+	for hops := 0; hops < 16; hops++ {
+		if entry, found := base.entries[filePath]; found {
+			return entry, true
+		}
+
+		resolved := false
+		for parent := path.Dir(filePath); parent != "/"; parent = path.Dir(parent) {
+			entry, found := base.entries[parent]
+			if !found || entry.typeflag != tar.TypeSymlink {
+				continue
+			}
+			target := entry.linkTarget
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(parent), target)
+			}
+			filePath = path.Join(target, strings.TrimPrefix(filePath, parent))
+			resolved = true
+			break
+		}
+		if !resolved {
+			return baseEntry{}, false
+		}
+	}
+	return baseEntry{}, false
+}
+
+// RemoveBaseFiles drops the regular files and symlinks of the profile directory that the base image
+// has with the same content or target, and reports the files the base image has with other content,
+// which must replace the base image's files (see CreateLayerArchives).
+// The kept paths are never dropped, e.g. the user and group files the Dockerfile copies explicitly.
+func RemoveBaseFiles(profileDirectory string, base *BaseRootfs, keptPaths []string) (BaseDiffReport, error) {
+	var report BaseDiffReport
+	err := filepath.WalkDir(profileDirectory, func(currentPath string, entry fs.DirEntry, walkError error) error {
+		if walkError != nil || entry.IsDir() {
+			return walkError
+		}
+		relativePath, err := filepath.Rel(profileDirectory, currentPath)
+		if err != nil {
+			return err
+		}
+		imagePath := "/" + filepath.ToSlash(relativePath)
+		if containsString(keptPaths, imagePath) {
+			return nil
+		}
+		baseFile, found := base.lookup(imagePath)
+		if !found {
+			return nil
+		}
+
+		difference := compareWithBase(currentPath, entry, baseFile)
+		if difference != "" {
+			report.Differing = append(report.Differing, BaseDifference{Path: imagePath, Reason: difference})
+			return nil
+		}
+		report.Identical++
+		return os.Remove(currentPath)
+	})
+
+	sort.Slice(report.Differing, func(i, j int) bool { return report.Differing[i].Path < report.Differing[j].Path })
+	return report, err
+}
+
+// compareWithBase returns why a profile file differs from the base image file, or an empty string if they are identical
+func compareWithBase(filePath string, entry fs.DirEntry, baseFile baseEntry) string {
+	switch {
+	case entry.Type()&fs.ModeSymlink != 0:
+		if baseFile.typeflag != tar.TypeSymlink {
+			return "symlink in the profile, not in the base image"
+		}
+		linkTarget, err := os.Readlink(filePath)
+		if err != nil {
+			return err.Error()
+		}
+		if linkTarget != baseFile.linkTarget {
+			return fmt.Sprintf("symlink target %s, base image %s", linkTarget, baseFile.linkTarget)
+		}
+	case entry.Type().IsRegular():
+		if baseFile.typeflag != tar.TypeReg {
+			return "regular file in the profile, not in the base image"
+		}
+		checksum, err := fileChecksum(filePath, sha256.New())
+		if err != nil {
+			return err.Error()
+		}
+		if hex.EncodeToString(checksum) != baseFile.checksum {
+			return "content differs"
+		}
+		return compareMetadataWithBase(entry, baseFile)
+	default:
+		return "special file"
+	}
+	return ""
+}
+
+// compareMetadataWithBase returns why the mode or owner of a profile file differs from the base image file,
+// or an empty string if they are the same. They are compared as the layer archive records them.
+func compareMetadataWithBase(entry fs.DirEntry, baseFile baseEntry) string {
+	fileInfo, err := entry.Info()
+	if err != nil {
+		return err.Error()
+	}
+	header, err := tar.FileInfoHeader(fileInfo, "")
+	if err != nil {
+		return err.Error()
+	}
+	uid, gid, err := getUIDGIDFromFileInfo(fileInfo)
+	if err != nil {
+		return err.Error()
+	}
+
+	if mode := header.Mode & permissionBits; mode != baseFile.mode {
+		return fmt.Sprintf("mode %04o, base image %04o", mode, baseFile.mode)
+	}
+	if uid != baseFile.uid || gid != baseFile.gid {
+		return fmt.Sprintf("owner %d:%d, base image %d:%d", uid, gid, baseFile.uid, baseFile.gid)
+	}
+	return ""
+}
+
+// SaveBaseDiffReport writes the comparison with the base image to a YAML file.
+func SaveBaseDiffReport(report BaseDiffReport, reportPath string) error {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(reportPath, data, 0o644)
+}
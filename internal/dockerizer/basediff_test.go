@@ -0,0 +1,116 @@
+package dockerizer
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRemoveBaseFiles(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+
+	// Profile files, all with the same owner as the base image files unless stated otherwise
+	profileDirectory := t.TempDir()
+	profileFiles := []struct {
+		path    string
+		content string
+		mode    os.FileMode
+	}{
+		{"etc/app/same.conf", "same", 0o644},
+		{"etc/app/content.conf", "changed", 0o644},
+		{"etc/app/mode.conf", "same", 0o600},
+		{"etc/app/owner.conf", "same", 0o644},
+		{"etc/app/setuid", "same", 0o755 | os.ModeSetuid},
+		{"etc/app/unknown.conf", "only in the profile", 0o644},
+	}
+	for _, file := range profileFiles {
+		filePath := filepath.Join(profileDirectory, file.path)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(file.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(filePath, file.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("same.conf", filepath.Join(profileDirectory, "etc/app/link.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	baseFile := func(name string, mode int64, uid, gid int) tarballEntry {
+		return tarballEntry{header: tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: mode, Uid: uid, Gid: gid}, content: "same"}
+	}
+	base, err := LoadBaseRootfs(writeTarball(t, []tarballEntry{
+		{header: tar.Header{Name: "etc/app/", Typeflag: tar.TypeDir, Mode: 0o755}},
+		baseFile("etc/app/same.conf", 0o644, uid, gid),
+		baseFile("etc/app/content.conf", 0o644, uid, gid),
+		baseFile("etc/app/mode.conf", 0o644, uid, gid),
+		baseFile("etc/app/owner.conf", 0o644, uid+1, gid),
+		baseFile("etc/app/setuid", 0o755, uid, gid),
+		{header: tar.Header{Name: "etc/app/link.conf", Typeflag: tar.TypeSymlink, Linkname: "same.conf", Mode: 0o777}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := RemoveBaseFiles(profileDirectory, base, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantDiffering := []BaseDifference{
+		{Path: "/etc/app/content.conf", Reason: "content differs"},
+		{Path: "/etc/app/mode.conf", Reason: "mode 0600, base image 0644"},
+		{Path: "/etc/app/owner.conf", Reason: fmt.Sprintf("owner %d:%d, base image %d:%d", uid, gid, uid+1, gid)},
+		{Path: "/etc/app/setuid", Reason: "mode 4755, base image 0755"},
+	}
+	if !reflect.DeepEqual(report.Differing, wantDiffering) {
+		t.Errorf("RemoveBaseFiles() differing =\n%v\nwant\n%v", report.Differing, wantDiffering)
+	}
+	if report.Identical != 2 {
+		t.Errorf("RemoveBaseFiles() identical = %d, want 2", report.Identical)
+	}
+
+	// Identical files are dropped, the others stay in the profile
+	for _, file := range []string{"etc/app/same.conf", "etc/app/link.conf"} {
+		if _, err := os.Lstat(filepath.Join(profileDirectory, file)); !os.IsNotExist(err) {
+			t.Errorf("%s was not dropped from the profile", file)
+		}
+	}
+	for _, file := range []string{"etc/app/content.conf", "etc/app/mode.conf", "etc/app/owner.conf", "etc/app/setuid", "etc/app/unknown.conf"} {
+		if _, err := os.Lstat(filepath.Join(profileDirectory, file)); err != nil {
+			t.Errorf("%s was dropped from the profile: %v", file, err)
+		}
+	}
+}
+
+func TestLoadBaseRootfsInvalidLayerDigest(t *testing.T) {
+	for _, digest := range []string{"sha512:abc", "sha256:", "sha256"} {
+		layoutDirectory := t.TempDir()
+		blobDirectory := filepath.Join(layoutDirectory, "blobs", "sha256")
+		if err := os.MkdirAll(blobDirectory, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		manifest := ociManifest{SchemaVersion: 2, MediaType: ociManifestMediaType, Layers: []ociDescriptor{
+			{MediaType: "application/vnd.oci.image.layer.v1.tar", Digest: digest},
+		}}
+		manifestDescriptor, err := writeJSONBlob(blobDirectory, ociManifestMediaType, manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index := ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType, Manifests: []ociDescriptor{manifestDescriptor}}
+		if err := writeJSONFile(filepath.Join(layoutDirectory, ociIndexFile), index); err != nil {
+			t.Fatal(err)
+		}
+
+		// A malformed digest is reported instead of indexing a blob path
+		if _, err := LoadBaseRootfs(layoutDirectory); err == nil {
+			t.Errorf("LoadBaseRootfs() with layer digest %q succeeded, want an error", digest)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package dockerizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"application_profiling/internal/profiler"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v2"
+)
+
+// invalidNameCharacters matches the characters not allowed in Compose service and volume names
+var invalidNameCharacters = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// ComposeApplication is a profiled application that becomes a Compose service.
+type ComposeApplication struct {
+	ProcessInfo  *profiler.ProcessInfo
+	BuildContext string   // Directory with the Dockerfile of the application, relative to the Compose file
+	Volumes      []string // State directories of the application
+}
+
+// ServiceDependency records that one service connects to a port or socket of another.
+type ServiceDependency struct {
+	Service   string
+	DependsOn string
+	Via       string // e.g. "tcp/3306" or "unix:/run/mysqld/mysqld.sock"
+}
+
+// composeFile is the layout of a docker-compose.yml file
+type composeFile struct {
+	Services yaml.MapSlice `yaml:"services"`
+	Volumes  yaml.MapSlice `yaml:"volumes,omitempty"`
+}
+
+// composeService is a service of a docker-compose.yml file
+type composeService struct {
+	Build     composeBuild `yaml:"build"`
+	Ports     []string     `yaml:"ports,omitempty"`
+	EnvFile   []string     `yaml:"env_file,omitempty"`
+	Volumes   []string     `yaml:"volumes,omitempty"`
+	DependsOn []string     `yaml:"depends_on,omitempty"`
+}
+
+// composeBuild is the build section of a Compose service
+type composeBuild struct {
+	Context string `yaml:"context"`
+}
+
+// composeEntry holds a service while the Compose file is assembled
+type composeEntry struct {
+	name        string
+	application ComposeApplication
+	service     composeService
+	mounts      map[string]string // Mount target to volume name
+}
+
+// GenerateCompose writes a docker-compose.yml with one service per application, and an env file
+// per service next to it. Ports come from the listening sockets, state directories become named
+// volumes, and directories of Unix sockets used by several applications become shared named volumes.
+// A service depends on the services whose TCP port or Unix socket its application was connected to.
+func GenerateCompose(applications []ComposeApplication, composePath string) ([]ServiceDependency, error) {
+	// 1. One service per application, with its ports, env file and state volumes
+	entries := make([]*composeEntry, 0, len(applications))
+	usedNames := make(map[string]bool)
+	volumeNames := make(map[string]bool)
+	for _, application := range applications {
+		entry := &composeEntry{
+			name:        uniqueName(serviceName(application.ProcessInfo), usedNames),
+			application: application,
+			service:     composeService{Build: composeBuild{Context: application.BuildContext}},
+			mounts:      make(map[string]string),
+		}
+		for _, port := range application.ProcessInfo.ListeningTCP {
+			entry.service.Ports = append(entry.service.Ports, fmt.Sprintf("%d:%d", port, port))
+		}
+		for _, port := range application.ProcessInfo.ListeningUDP {
+			entry.service.Ports = append(entry.service.Ports, fmt.Sprintf("%d:%d/udp", port, port))
+		}
+
+		envFile := entry.name + ".env"
+		if err := writeEnvFile(containerEnvironment(application.ProcessInfo), filepath.Join(filepath.Dir(composePath), envFile)); err != nil {
+			return nil, err
+		}
+		entry.service.EnvFile = []string{envFile}
+
+		for _, volume := range application.Volumes {
+			volumeName := uniqueName(entry.name+"-"+volumeSuffix(volume), volumeNames)
+			entry.mounts[volume] = volumeName
+			entry.service.Volumes = append(entry.service.Volumes, volumeName+":"+volume)
+		}
+		entries = append(entries, entry)
+	}
+
+	// 2. Shared socket directories and dependencies between the services
+	var dependencies []ServiceDependency
+	for _, server := range entries {
+		// Accepted connections list the path of their listening socket again
+		seenSockets := make(map[string]bool)
+		for _, socketPath := range server.application.ProcessInfo.UnixSockets {
+			if seenSockets[socketPath] {
+				continue
+			}
+			seenSockets[socketPath] = true
+			directory := filepath.Dir(socketPath)
+			var clients []*composeEntry
+			for _, client := range entries {
+				if client == server {
+					continue
+				}
+				if containsString(client.application.ProcessInfo.ConnectedUnix, socketPath) {
+					dependencies = append(dependencies, ServiceDependency{Service: client.name, DependsOn: server.name, Via: "unix:" + socketPath})
+					clients = append(clients, client)
+				} else if containsString(client.application.ProcessInfo.UnixSockets, socketPath) {
+					clients = append(clients, client)
+				}
+			}
+			if len(clients) == 0 {
+				continue
+			}
+
+			// The server may already keep the socket in one of its state volumes
+			volumeName, found := server.mounts[directory]
+			if !found {
+				volumeName = uniqueName("sockets-"+volumeSuffix(directory), volumeNames)
+			}
+			for _, entry := range append(clients, server) {
+				if _, mounted := entry.mounts[directory]; !mounted {
+					entry.mounts[directory] = volumeName
+					entry.service.Volumes = append(entry.service.Volumes, volumeName+":"+directory)
+				}
+			}
+		}
+
+		for _, port := range server.application.ProcessInfo.ListeningTCP {
+			for _, client := range entries {
+				if client != server && containsInt(client.application.ProcessInfo.ConnectedTCP, port) {
+					dependencies = append(dependencies, ServiceDependency{Service: client.name, DependsOn: server.name, Via: fmt.Sprintf("tcp/%d", port)})
+				}
+			}
+		}
+	}
+	entriesByName := make(map[string]*composeEntry, len(entries))
+	for _, entry := range entries {
+		entriesByName[entry.name] = entry
+	}
+	for _, dependency := range dependencies {
+		entry := entriesByName[dependency.Service]
+		if containsString(entry.service.DependsOn, dependency.DependsOn) {
+			continue
+		}
+		// Compose rejects cycles, e.g. of applications connected to each other
+		if dependsOn(dependency.DependsOn, dependency.Service, entriesByName) {
+			log.Warn("Skipping dependency that would form a cycle", "service", dependency.Service, "dependson", dependency.DependsOn, "via", dependency.Via)
+			continue
+		}
+		entry.service.DependsOn = append(entry.service.DependsOn, dependency.DependsOn)
+	}
+
+	// 3. Write the Compose file, declaring every named volume
+	var file composeFile
+	declaredVolumes := make(map[string]bool)
+	for _, entry := range entries {
+		file.Services = append(file.Services, yaml.MapItem{Key: entry.name, Value: entry.service})
+		for _, mount := range entry.service.Volumes {
+			volumeName := strings.SplitN(mount, ":", 2)[0]
+			if !declaredVolumes[volumeName] {
+				declaredVolumes[volumeName] = true
+				file.Volumes = append(file.Volumes, yaml.MapItem{Key: volumeName, Value: map[string]string{}})
+			}
+		}
+	}
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+	return dependencies, os.WriteFile(composePath, data, 0o644)
+}
+
+// dependsOn checks if a service depends on another one, directly or through other services
+func dependsOn(service, dependency string, entriesByName map[string]*composeEntry) bool {
+	visited := make(map[string]bool)
+	pending := []string{service}
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if name == dependency {
+			return true
+		}
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		pending = append(pending, entriesByName[name].service.DependsOn...)
+	}
+	return false
+}
+
+// serviceName names the service after the systemd unit, or else the executable of the application
+func serviceName(info *profiler.ProcessInfo) string {
+	name := filepath.Base(info.ExecutablePath)
+	if info.SystemdUnit != nil {
+		name = strings.TrimSuffix(info.SystemdUnit.Name, ".service")
+	}
+	name = strings.Trim(invalidNameCharacters.ReplaceAllString(strings.ToLower(name), "-"), "-.")
+	if name == "" {
+		return "app"
+	}
+	return name
+}
+
+// volumeSuffix turns a directory into a volume name part, e.g. "/var/lib/mysql" into "var-lib-mysql"
+func volumeSuffix(directory string) string {
+	suffix := strings.Trim(invalidNameCharacters.ReplaceAllString(strings.ToLower(directory), "-"), "-.")
+	if suffix == "" {
+		return "root"
+	}
+	return suffix
+}
+
+// uniqueName returns the name, or the name with a number appended if it is already used
+func uniqueName(name string, usedNames map[string]bool) string {
+	candidate := name
+	for number := 2; usedNames[candidate]; number++ {
+		candidate = fmt.Sprintf("%s-%d", name, number)
+	}
+	usedNames[candidate] = true
+	return candidate
+}
+
+// containerEnvironment returns the environment the Dockerfile sets for the application
+func containerEnvironment(info *profiler.ProcessInfo) []string {
+	if info.SystemdUnit != nil {
+		return unitEnvironment(info.SystemdUnit)
+	}
+	return info.EnvironmentVariables
+}
+
+// writeEnvFile writes KEY=value lines for the env_file of a service.
+// Compose reads the values literally, so variables with line breaks cannot be written.
+func writeEnvFile(variables []string, envFilePath string) error {
+	var content strings.Builder
+	for _, variable := range variables {
+		if !strings.ContainsAny(variable, "\r\n") {
+			content.WriteString(variable + "\n")
+		}
+	}
+	return os.WriteFile(envFilePath, []byte(content.String()), 0o644)
+}
+
+// containsInt checks if the value is in the list
+func containsInt(values []int, value int) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
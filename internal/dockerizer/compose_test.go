@@ -0,0 +1,161 @@
+package dockerizer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"application_profiling/internal/profiler"
+
+	"gopkg.in/yaml.v2"
+)
+
+// generateTestCompose generates the Compose file of the applications and returns the detected
+// dependencies, the services by name and the declared volumes
+func generateTestCompose(t *testing.T, applications []ComposeApplication) ([]ServiceDependency, map[string]composeService, map[string]interface{}) {
+	t.Helper()
+	composePath := filepath.Join(t.TempDir(), "docker-compose.yml")
+	dependencies, err := GenerateCompose(applications, composePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(composePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Services map[string]composeService `yaml:"services"`
+		Volumes  map[string]interface{}    `yaml:"volumes"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	return dependencies, file.Services, file.Volumes
+}
+
+func TestGenerateCompose(t *testing.T) {
+	socketPath := "/run/mysqld/mysqld.sock"
+	applications := []ComposeApplication{
+		{
+			// Accepted connections list the listening socket again
+			ProcessInfo: &profiler.ProcessInfo{
+				ExecutablePath: "/usr/sbin/mysqld",
+				ListeningTCP:   []int{3306},
+				UnixSockets:    []string{socketPath, socketPath},
+			},
+			BuildContext: "mysqld",
+			Volumes:      []string{"/var/lib/mysql", "/run/mysqld"},
+		},
+		{
+			// Connects through both the socket and the port
+			ProcessInfo: &profiler.ProcessInfo{
+				ExecutablePath: "/opt/app/bin/server",
+				ListeningTCP:   []int{8080},
+				ConnectedTCP:   []int{3306},
+				ConnectedUnix:  []string{socketPath},
+			},
+			BuildContext: "server",
+		},
+		{
+			// Same executable name, connects through the port only
+			ProcessInfo: &profiler.ProcessInfo{
+				ExecutablePath: "/opt/worker/bin/server",
+				ConnectedTCP:   []int{3306},
+			},
+			BuildContext: "worker",
+		},
+	}
+
+	dependencies, services, volumes := generateTestCompose(t, applications)
+
+	wantDependencies := []ServiceDependency{
+		{Service: "server", DependsOn: "mysqld", Via: "unix:" + socketPath},
+		{Service: "server", DependsOn: "mysqld", Via: "tcp/3306"},
+		{Service: "server-2", DependsOn: "mysqld", Via: "tcp/3306"},
+	}
+	if !reflect.DeepEqual(dependencies, wantDependencies) {
+		t.Errorf("dependencies = %+v, want %+v", dependencies, wantDependencies)
+	}
+
+	// The socket directory is shared through the server's state volume
+	wantServices := map[string]composeService{
+		"mysqld": {
+			Build:   composeBuild{Context: "mysqld"},
+			Ports:   []string{"3306:3306"},
+			EnvFile: []string{"mysqld.env"},
+			Volumes: []string{"mysqld-var-lib-mysql:/var/lib/mysql", "mysqld-run-mysqld:/run/mysqld"},
+		},
+		"server": {
+			Build:     composeBuild{Context: "server"},
+			Ports:     []string{"8080:8080"},
+			EnvFile:   []string{"server.env"},
+			Volumes:   []string{"mysqld-run-mysqld:/run/mysqld"},
+			DependsOn: []string{"mysqld"},
+		},
+		"server-2": {
+			Build:     composeBuild{Context: "worker"},
+			EnvFile:   []string{"server-2.env"},
+			DependsOn: []string{"mysqld"},
+		},
+	}
+	if !reflect.DeepEqual(services, wantServices) {
+		t.Errorf("services = %+v, want %+v", services, wantServices)
+	}
+
+	var volumeNames []string
+	for volumeName := range volumes {
+		volumeNames = append(volumeNames, volumeName)
+	}
+	if len(volumes) != 2 || volumes["mysqld-var-lib-mysql"] == nil || volumes["mysqld-run-mysqld"] == nil {
+		t.Errorf("volumes = %q, want mysqld-var-lib-mysql and mysqld-run-mysqld", volumeNames)
+	}
+}
+
+func TestGenerateComposeSocketVolume(t *testing.T) {
+	socketPath := "/run/app/app.sock"
+	applications := []ComposeApplication{
+		{ProcessInfo: &profiler.ProcessInfo{ExecutablePath: "/usr/bin/app", UnixSockets: []string{socketPath}}, Volumes: []string{"/data"}},
+		{ProcessInfo: &profiler.ProcessInfo{ExecutablePath: "/usr/bin/client", ConnectedUnix: []string{socketPath}}},
+		// Its state volume name collides with the one of the first service
+		{ProcessInfo: &profiler.ProcessInfo{ExecutablePath: "/usr/bin/app-data"}, Volumes: []string{"/"}},
+	}
+
+	_, services, volumes := generateTestCompose(t, applications)
+
+	// Without a state volume holding it, the socket directory gets a shared volume of its own
+	if want := []string{"app-data:/data", "sockets-run-app:/run/app"}; !reflect.DeepEqual(services["app"].Volumes, want) {
+		t.Errorf("app volumes = %q, want %q", services["app"].Volumes, want)
+	}
+	if want := []string{"sockets-run-app:/run/app"}; !reflect.DeepEqual(services["client"].Volumes, want) {
+		t.Errorf("client volumes = %q, want %q", services["client"].Volumes, want)
+	}
+	if want := []string{"app-data-root:/"}; !reflect.DeepEqual(services["app-data"].Volumes, want) {
+		t.Errorf("app-data volumes = %q, want %q", services["app-data"].Volumes, want)
+	}
+	if len(volumes) != 3 {
+		t.Errorf("declared %d volumes, want 3", len(volumes))
+	}
+}
+
+func TestGenerateComposeDependencyCycle(t *testing.T) {
+	// Two applications connected to each other
+	applications := []ComposeApplication{
+		{ProcessInfo: &profiler.ProcessInfo{ExecutablePath: "/usr/bin/first", ListeningTCP: []int{5000}, ConnectedTCP: []int{6000}}},
+		{ProcessInfo: &profiler.ProcessInfo{ExecutablePath: "/usr/bin/second", ListeningTCP: []int{6000}, ConnectedTCP: []int{5000}}},
+	}
+
+	dependencies, services, _ := generateTestCompose(t, applications)
+
+	if len(dependencies) != 2 {
+		t.Errorf("detected %d dependencies, want 2", len(dependencies))
+	}
+	// The back edge is left out of depends_on
+	if want := []string{"first"}; !reflect.DeepEqual(services["second"].DependsOn, want) {
+		t.Errorf("second depends_on = %q, want %q", services["second"].DependsOn, want)
+	}
+	if services["first"].DependsOn != nil {
+		t.Errorf("first depends_on = %q, want none", services["first"].DependsOn)
+	}
+}
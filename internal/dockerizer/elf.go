@@ -0,0 +1,331 @@
+package dockerizer
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"application_profiling/internal/profiler"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v2"
+)
+
+// Dynamic linker configuration
+const (
+	ldSoConfigFile = "/etc/ld.so.conf"
+	ldSoCacheFile  = "/etc/ld.so.cache"
+	ldSoCacheMagic = "glibc-ld.so.cache1.1"
+)
+
+// Layout of the glibc ld.so.cache format: a header, then entries pointing into a string table
+const (
+	ldSoCacheHeaderSize = 48 // Magic, library count, string table size, flags, extension offset, unused
+	ldSoCacheEntrySize  = 24 // Flags, key offset, value offset, OS version, hardware capabilities
+)
+
+// defaultLibraryDirectories are searched after the cache, like the dynamic linker does
+var defaultLibraryDirectories = []string{"/lib64", "/usr/lib64", "/lib", "/usr/lib"}
+
+// LibraryDependency is a shared library the dynamic linker loads that the trace did not record.
+type LibraryDependency struct {
+	Name     string `yaml:"name"`           // Name from DT_NEEDED or the interpreter path
+	Path     string `yaml:"path,omitempty"` // Resolved path, empty if the library was not found
+	NeededBy string `yaml:"neededby"`       // ELF file that needs the library
+}
+
+// LibraryReport lists the libraries added by ELF analysis and those that could not be resolved.
+type LibraryReport struct {
+	Added      []LibraryDependency `yaml:"added"`
+	Unresolved []LibraryDependency `yaml:"unresolved"`
+}
+
+// libraryResolver finds shared libraries the way the dynamic linker does
+type libraryResolver struct {
+	libraryPath []string          // Directories of LD_LIBRARY_PATH
+	configured  []string          // Directories of ld.so.conf and its includes
+	cache       map[string]string // Library name to path, from ld.so.cache
+	inspected   map[string]bool
+}
+
+// ResolveSharedLibraries reads the interpreter, DT_NEEDED and DT_RUNPATH/DT_RPATH entries of every
+// executable and shared object among the file paths and resolves the libraries they need, transitively.
+// Libraries not already covered by the file paths are returned in the report's Added list.
+func ResolveSharedLibraries(filePaths, environmentVariables []string) LibraryReport {
+	resolver := &libraryResolver{
+		configured: readLdSoConfig(ldSoConfigFile, make(map[string]bool)),
+		cache:      readLdSoCache(ldSoCacheFile),
+		inspected:  make(map[string]bool),
+	}
+	for _, variable := range environmentVariables {
+		if value, found := strings.CutPrefix(variable, "LD_LIBRARY_PATH="); found {
+			resolver.libraryPath = filepath.SplitList(value)
+		}
+	}
+
+	var report LibraryReport
+	pathsToCheck := expandDirectories(filePaths)
+	for len(pathsToCheck) > 0 {
+		filePath := pathsToCheck[0]
+		pathsToCheck = pathsToCheck[1:]
+		for _, dependency := range resolver.inspect(filePath) {
+			switch {
+			case dependency.Path == "":
+				report.Unresolved = append(report.Unresolved, dependency)
+			case !isCoveredLibrary(dependency, filePaths) && !containsDependency(report.Added, dependency.Path):
+				report.Added = append(report.Added, dependency)
+				pathsToCheck = append(pathsToCheck, dependency.Path)
+			}
+		}
+	}
+
+	sort.Slice(report.Added, func(i, j int) bool { return report.Added[i].Path < report.Added[j].Path })
+	return report
+}
+
+// AddedPaths returns the paths of the libraries added by ELF analysis
+func (report LibraryReport) AddedPaths() []string {
+	var paths []string
+	for _, dependency := range report.Added {
+		paths = append(paths, dependency.Path)
+	}
+	return paths
+}
+
+// SaveLibraryReport writes the added and unresolved libraries to a YAML file.
+func SaveLibraryReport(report LibraryReport, reportPath string) error {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(reportPath, data, 0o644)
+}
+
+// isCoveredLibrary checks if the library is part of the file paths, also under its resolved
+// path, as the trace records e.g. /usr/lib/x86_64-linux-gnu/libc.so.6 for /lib/x86_64-linux-gnu/libc.so.6.
+// The interpreter is loaded by the kernel from its literal path, so its symlinks must be part of the files.
+func isCoveredLibrary(dependency LibraryDependency, filePaths []string) bool {
+	if profiler.IsCoveredByPaths(dependency.Path, filePaths) {
+		return true
+	}
+	if dependency.Name == dependency.Path {
+		return false
+	}
+	realPath, err := filepath.EvalSymlinks(dependency.Path)
+	return err == nil && profiler.IsCoveredByPaths(realPath, filePaths)
+}
+
+// containsDependency checks if a library with the given path is in the list
+func containsDependency(dependencies []LibraryDependency, libraryPath string) bool {
+	for _, dependency := range dependencies {
+		if dependency.Path == libraryPath {
+			return true
+		}
+	}
+	return false
+}
+
+// inspect returns the interpreter and the needed libraries of an ELF file, resolved to paths.
+// Files that are not ELF executables or shared objects have no dependencies.
+func (resolver *libraryResolver) inspect(filePath string) []LibraryDependency {
+	realPath, err := filepath.EvalSymlinks(filePath)
+	if err != nil || resolver.inspected[realPath] || !isELFFile(realPath) {
+		return nil
+	}
+	resolver.inspected[realPath] = true
+
+	file, err := elf.Open(realPath)
+	if err != nil {
+		log.Debug("Failed to read ELF file", "file", realPath, "error", err)
+		return nil
+	}
+	defer file.Close()
+
+	var dependencies []LibraryDependency
+	if interpreter := elfInterpreter(file); interpreter != "" {
+		dependencies = append(dependencies, LibraryDependency{Name: interpreter, Path: existingPath(interpreter), NeededBy: filePath})
+	}
+
+	needed, _ := file.DynString(elf.DT_NEEDED)
+	runPath, _ := file.DynString(elf.DT_RUNPATH)
+	rPath, _ := file.DynString(elf.DT_RPATH)
+	origin := filepath.Dir(realPath)
+	for _, name := range needed {
+		dependency := LibraryDependency{Name: name, NeededBy: filePath}
+		dependency.Path = resolver.resolve(name, file, expandOrigin(rPath, origin), expandOrigin(runPath, origin))
+		dependencies = append(dependencies, dependency)
+	}
+	return dependencies
+}
+
+// resolve finds a needed library in the search order of the dynamic linker: DT_RPATH (only without
+// DT_RUNPATH), LD_LIBRARY_PATH, DT_RUNPATH, ld.so.cache, then the default directories.
+// Candidates built for another architecture are skipped.
+func (resolver *libraryResolver) resolve(name string, requester *elf.File, rPath, runPath []string) string {
+	if strings.Contains(name, "/") {
+		return existingPath(name)
+	}
+
+	var directories []string
+	if len(runPath) == 0 {
+		directories = append(directories, rPath...)
+	}
+	directories = append(directories, resolver.libraryPath...)
+	directories = append(directories, runPath...)
+	for _, directory := range directories {
+		if candidate := filepath.Join(directory, name); isCompatibleLibrary(candidate, requester) {
+			return candidate
+		}
+	}
+
+	if candidate, found := resolver.cache[name]; found && isCompatibleLibrary(candidate, requester) {
+		return candidate
+	}
+	for _, directory := range append(resolver.configured, defaultLibraryDirectories...) {
+		if candidate := filepath.Join(directory, name); isCompatibleLibrary(candidate, requester) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// elfInterpreter returns the program interpreter (PT_INTERP) of an executable, if any
+func elfInterpreter(file *elf.File) string {
+	for _, program := range file.Progs {
+		if program.Type != elf.PT_INTERP {
+			continue
+		}
+		data := make([]byte, program.Filesz)
+		if _, err := program.ReadAt(data, 0); err != nil {
+			return ""
+		}
+		return string(bytes.TrimRight(data, "\x00"))
+	}
+	return ""
+}
+
+// expandOrigin splits a DT_RUNPATH or DT_RPATH value and replaces $ORIGIN with the directory of the ELF file
+func expandOrigin(searchPaths []string, origin string) []string {
+	var directories []string
+	for _, searchPath := range searchPaths {
+		for _, directory := range filepath.SplitList(searchPath) {
+			directory = strings.ReplaceAll(directory, "${ORIGIN}", origin)
+			directory = strings.ReplaceAll(directory, "$ORIGIN", origin)
+			if directory != "" {
+				directories = append(directories, directory)
+			}
+		}
+	}
+	return directories
+}
+
+// isELFFile checks if a regular file starts with the ELF magic number
+func isELFFile(filePath string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := file.Read(magic); err != nil {
+		return false
+	}
+	return string(magic) == elf.ELFMAG
+}
+
+// isCompatibleLibrary checks if the library exists and is built for the class and machine of the requester
+func isCompatibleLibrary(libraryPath string, requester *elf.File) bool {
+	library, err := elf.Open(libraryPath)
+	if err != nil {
+		return false
+	}
+	defer library.Close()
+	return library.Class == requester.Class && library.Machine == requester.Machine
+}
+
+// existingPath returns the path if it exists, or an empty string
+func existingPath(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// readLdSoConfig returns the library directories of an ld.so.conf file, following its include directives
+func readLdSoConfig(configFile string, visited map[string]bool) []string {
+	if visited[configFile] {
+		return nil
+	}
+	visited[configFile] = true
+
+	var directories []string
+	if err := readLines(configFile, func(line string) {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if pattern, found := strings.CutPrefix(line, "include "); found {
+			pattern = strings.TrimSpace(pattern)
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(configFile), pattern)
+			}
+			includedFiles, _ := filepath.Glob(pattern)
+			for _, includedFile := range includedFiles {
+				directories = append(directories, readLdSoConfig(includedFile, visited)...)
+			}
+		} else if line != "" {
+			directories = append(directories, line)
+		}
+	}); err != nil {
+		log.Debug("Failed to read dynamic linker configuration", "file", configFile, "error", err)
+	}
+	return directories
+}
+
+// readLdSoCache maps library names to paths from the glibc ld.so.cache. Older caches start with
+// the legacy "ld.so-1.7.0" format; the offsets of the current format are relative to its header.
+// The first entry of a name wins, as entries are sorted by preference.
+func readLdSoCache(cacheFile string) map[string]string {
+	libraries := make(map[string]string)
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		log.Debug("Failed to read dynamic linker cache", "file", cacheFile, "error", err)
+		return libraries
+	}
+
+	start := bytes.Index(data, []byte(ldSoCacheMagic))
+	if start < 0 || len(data) < start+ldSoCacheHeaderSize {
+		log.Debug("Unsupported dynamic linker cache format", "file", cacheFile)
+		return libraries
+	}
+	cache := data[start:]
+	count := int(binary.LittleEndian.Uint32(cache[len(ldSoCacheMagic):]))
+
+	for i := 0; i < count; i++ {
+		entry := ldSoCacheHeaderSize + i*ldSoCacheEntrySize
+		if entry+ldSoCacheEntrySize > len(cache) {
+			break
+		}
+		name := cacheString(cache, binary.LittleEndian.Uint32(cache[entry+4:]))
+		libraryPath := cacheString(cache, binary.LittleEndian.Uint32(cache[entry+8:]))
+		if _, found := libraries[name]; !found && name != "" && libraryPath != "" {
+			libraries[name] = libraryPath
+		}
+	}
+	return libraries
+}
+
+// cacheString reads the NUL-terminated string at an offset of the cache
+func cacheString(cache []byte, offset uint32) string {
+	if int(offset) >= len(cache) {
+		return ""
+	}
+	end := bytes.IndexByte(cache[offset:], 0)
+	if end < 0 {
+		return ""
+	}
+	return string(cache[offset : int(offset)+end])
+}
@@ -0,0 +1,134 @@
+package dockerizer
+
+import (
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestReadLdSoCache(t *testing.T) {
+	// The fixture has a legacy header in front, and a second, less preferred entry of libfoo.so.1
+	want := map[string]string{
+		"libfoo.so.1": "/usr/lib/x86_64-linux-gnu/libfoo.so.1",
+		"libbar.so":   "/usr/lib/libbar.so",
+	}
+	if got := readLdSoCache("testdata/ldso/ld.so.cache"); !reflect.DeepEqual(got, want) {
+		t.Errorf("readLdSoCache() = %v, want %v", got, want)
+	}
+
+	// Unreadable and unknown caches resolve nothing
+	for _, cacheFile := range []string{"testdata/ldso/missing.cache", "testdata/ldso/ld.so.conf"} {
+		if got := readLdSoCache(cacheFile); len(got) != 0 {
+			t.Errorf("readLdSoCache(%q) = %v, want no libraries", cacheFile, got)
+		}
+	}
+}
+
+func TestReadLdSoConfig(t *testing.T) {
+	// Includes are read in place and relative to the including file; the include loop is read once
+	want := []string{"/opt/app/lib", "/opt/other/lib", "/usr/local/lib"}
+	if got := readLdSoConfig("testdata/ldso/ld.so.conf", make(map[string]bool)); !slices.Equal(got, want) {
+		t.Errorf("readLdSoConfig() = %q, want %q", got, want)
+	}
+}
+
+func TestExpandOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		searchPaths []string
+		want        []string
+	}{
+		{name: "none", searchPaths: nil, want: nil},
+		{name: "origin forms", searchPaths: []string{"$ORIGIN/../lib", "${ORIGIN}"}, want: []string{"/opt/app/bin/../lib", "/opt/app/bin"}},
+		{name: "colon-separated with empty entries", searchPaths: []string{"/usr/local/lib::$ORIGIN/lib:"}, want: []string{"/usr/local/lib", "/opt/app/bin/lib"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := expandOrigin(test.searchPaths, "/opt/app/bin"); !slices.Equal(got, test.want) {
+				t.Errorf("expandOrigin(%q) = %q, want %q", test.searchPaths, got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveSearchOrder(t *testing.T) {
+	// The test binary stands in for the requester and for every compatible library
+	executablePath, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requester, err := elf.Open(executablePath)
+	if err != nil {
+		t.Skipf("the test binary is not an ELF file: %v", err)
+	}
+	defer requester.Close()
+
+	// One directory per source of the search order, each holding the library
+	root := t.TempDir()
+	directory := func(name string) string {
+		directoryPath := filepath.Join(root, name)
+		if err := os.MkdirAll(directoryPath, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(executablePath, filepath.Join(directoryPath, "libfoo.so.1")); err != nil {
+			t.Fatal(err)
+		}
+		return directoryPath
+	}
+	rPath, libraryPath, runPath, cached, configured := directory("rpath"), directory("env"), directory("runpath"), directory("cache"), directory("conf")
+	incompatible := filepath.Join(root, "incompatible")
+	if err := os.MkdirAll(incompatible, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(incompatible, "libfoo.so.1"), []byte("not an ELF file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		rPath       []string
+		runPath     []string
+		libraryPath []string
+		cache       bool
+		configured  bool
+		want        string
+	}{
+		{name: "rpath before LD_LIBRARY_PATH", rPath: []string{rPath}, libraryPath: []string{libraryPath}, cache: true, want: rPath},
+		{name: "rpath ignored next to runpath", rPath: []string{rPath}, runPath: []string{runPath}, want: runPath},
+		{name: "LD_LIBRARY_PATH before runpath", rPath: []string{rPath}, runPath: []string{runPath}, libraryPath: []string{libraryPath}, want: libraryPath},
+		{name: "runpath before the cache", runPath: []string{runPath}, cache: true, configured: true, want: runPath},
+		{name: "cache before ld.so.conf", cache: true, configured: true, want: cached},
+		{name: "ld.so.conf", configured: true, want: configured},
+		{name: "incompatible candidate skipped", rPath: []string{incompatible, rPath}, want: rPath},
+		{name: "not found", rPath: []string{incompatible}, want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolver := &libraryResolver{libraryPath: test.libraryPath, cache: make(map[string]string)}
+			if test.cache {
+				resolver.cache["libfoo.so.1"] = filepath.Join(cached, "libfoo.so.1")
+			}
+			if test.configured {
+				resolver.configured = []string{configured}
+			}
+			want := test.want
+			if want != "" {
+				want = filepath.Join(want, "libfoo.so.1")
+			}
+			if got := resolver.resolve("libfoo.so.1", requester, test.rPath, test.runPath); got != want {
+				t.Errorf("resolve() = %q, want %q", got, want)
+			}
+		})
+	}
+
+	// Names with a slash are taken as paths
+	resolver := &libraryResolver{}
+	if got, want := resolver.resolve(executablePath, requester, nil, nil), executablePath; got != want {
+		t.Errorf("resolve(%q) = %q, want %q", executablePath, got, want)
+	}
+}
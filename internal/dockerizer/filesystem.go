@@ -10,7 +10,10 @@ import (
 	"github.com/charmbracelet/log"
 )
 
-var visitedFiles = make(map[string]bool)
+var (
+	visitedFiles      = make(map[string]bool)
+	volumeDirectories = make(map[string]bool)
+)
 
 // LoadFilePaths loads file paths from a trace log.
 func LoadFilePaths(traceLogPath string) ([]string, error) {
@@ -26,7 +29,15 @@ func LoadFilePaths(traceLogPath string) ([]string, error) {
 }
 
 // CopyFilesToProfile copies a list of files (and directories) into the specified profile directory.
-func CopyFilesToProfile(filePaths []string, profileDirectory string) error {
+// Volume directories are created empty, so application state is not baked into the image.
+func CopyFilesToProfile(filePaths []string, profileDirectory string, volumes []string) error {
+	for _, volume := range volumes {
+		volumeDirectories[volume] = true
+		if err := copyFileRecursively(volume, profileDirectory); err != nil {
+			log.Warnf("Failed to create volume directory %s: %v", volume, err)
+		}
+	}
+
 	for _, filePath := range filePaths {
 		if err := copyFileRecursively(filePath, profileDirectory); err != nil {
 			log.Warnf("Failed to copy %s: %v", filePath, err)
@@ -53,6 +64,14 @@ func copyFileRecursively(sourcePath, profileDirectory string) error {
 	// Determine the destination path inside profileDirectory.
 	destinationPath := filepath.Join(profileDirectory, sourcePath)
 
+	// Leave the contents of volumes out of the profile.
+	if isInsideVolume(sourcePath) {
+		return nil
+	}
+	if volumeDirectories[sourcePath] && sourceFileInfo.IsDir() {
+		return createEmptyDirectory(destinationPath, sourceFileInfo)
+	}
+
 	// Handle symlinks.
 	if sourceFileInfo.Mode()&os.ModeSymlink != 0 {
 		return copySymlink(sourcePath, destinationPath, profileDirectory, sourceFileInfo)
@@ -139,6 +158,29 @@ func copyDirectory(sourcePath, destinationPath, profileDirectory string, sourceF
 	return nil
 }
 
+// createEmptyDirectory creates a directory with the permissions and ownership of the source, but none of its entries.
+func createEmptyDirectory(destinationPath string, sourceFileInfo os.FileInfo) error {
+	if err := os.MkdirAll(destinationPath, sourceFileInfo.Mode().Perm()); err != nil {
+		return err
+	}
+
+	uid, gid, err := getUIDGIDFromFileInfo(sourceFileInfo)
+	if err != nil {
+		return err
+	}
+	return os.Chown(destinationPath, uid, gid)
+}
+
+// isInsideVolume checks if a path lies below one of the volume directories.
+func isInsideVolume(sourcePath string) bool {
+	for parent := filepath.Dir(sourcePath); parent != "/" && parent != "."; parent = filepath.Dir(parent) {
+		if volumeDirectories[parent] {
+			return true
+		}
+	}
+	return false
+}
+
 // copyRegularFile copies a regular file from sourcePath to destinationPath.
 func copyRegularFile(sourcePath, destinationPath string, sourceFileInfo os.FileInfo) error {
 	// Ensure the destination directory exists.
@@ -1,24 +1,53 @@
 package dockerizer
 
 import (
-	"application_profiling/internal/profiler"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/template"
+
+	"application_profiling/internal/adapter"
+	"application_profiling/internal/profiler"
+
+	"github.com/charmbracelet/log"
 )
 
 const dockerfileTemplateContent = `# Set the base image
 FROM {{.BaseImage}}
+{{- if .InstallCommand }}
 
-# Copy the profile archive
-COPY {{.TarFile}} /
+# Install the packages owning the profiled files
+RUN {{.InstallCommand}}
+{{- end }}
+{{- if .Scratch }}
+{{- range .Layers }}
 
-# Extract the profile and clean up the archive
-RUN tar --skip-old-files -xvf /{{.TarFile}} -C / && rm /{{.TarFile}}
+# Add the {{.Name}} layer of the root filesystem
+ADD {{.File}} /
+{{- end }}
+{{- else }}
+{{- range .Layers }}
+{{ if .Overwrite }}
+# Extract the {{.Name}} layer of the profile, replacing the files of the base image
+COPY {{.File}} /tmp/{{.File}}
+RUN tar --no-overwrite-dir -xzf /tmp/{{.File}} -C / && rm /tmp/{{.File}}
+{{- else }}
+# Extract the {{.Name}} layer of the profile, keeping the files of the base image
+COPY {{.File}} /tmp/{{.File}}
+RUN tar --skip-old-files -xzf /tmp/{{.File}} -C / && rm /tmp/{{.File}}
+{{- end }}
+{{- end }}
 
 # Overwrite user and group data
 COPY {{.ProfileDirectory}}/etc/passwd {{.ProfileDirectory}}/etc/group /etc/
+{{- end }}
+{{- if .EntrypointScript }}
+
+# Copy the script running the pre-start steps
+COPY {{.EntrypointScript}} /usr/local/bin/{{.EntrypointScript}}
+{{- end }}
 
 # Set environment variables
 {{- range .EnvironmentVariables }}
@@ -39,72 +68,196 @@ EXPOSE {{.}}/tcp
 EXPOSE {{.}}/udp
 {{- end }}
 
+# Declare application state directories as volumes
+{{- range .Volumes }}
+VOLUME ["{{.}}"]
+{{- end }}
+{{- if .StopSignal }}
+
+# Set the signal that stops the application
+STOPSIGNAL {{.StopSignal}}
+{{- end }}
+{{- if .Healthcheck }}
+
+# Check that the application is healthy
+HEALTHCHECK {{.Healthcheck}}
+{{- end }}
+{{- if .EntrypointScript }}
+
+# Run the pre-start steps before the application
+ENTRYPOINT ["/usr/local/bin/{{.EntrypointScript}}"]
+{{- end }}
+
 # Set the entry point
 CMD [{{.Command}}]
 `
 
 // DockerfileData holds the data needed for the Dockerfile template.
 type DockerfileData struct {
-	TarFile              string
+	Layers               []LayerArchive
 	ProfileDirectory     string
 	EnvironmentVariables []string
 	UserAndGroup         string
 	WorkingDirectory     string
 	TCPPorts             []int
 	UDPPorts             []int
+	Volumes              []string
+	StopSignal           string
+	Healthcheck          string
+	EntrypointScript     string
 	Command              string
+	Arguments            []string // Arguments of the CMD instruction that Command quotes
 	BaseImage            string
+	Scratch              bool
+	InstallCommand       string
+	Adapter              adapter.Adapter // Adapter of the application's executable
 }
 
-// GenerateDockerfile generates a Dockerfile from thegiven ProcessInfo.
-func GenerateDockerfile(info *profiler.ProcessInfo, dockerfilePath, tarFile, profileDirectory string) error {
-	commandLine := buildCommandLine(info)
-	userAndGroup := fmt.Sprintf("%s:%s", info.ProcessUser, info.ProcessGroup)
-
+// GenerateDockerfile generates a Dockerfile from the given ProcessInfo.
+// Each layer archive is extracted by its own instruction, so it becomes its own image layer.
+// The given volumes are declared as VOLUME instructions. For a systemd service,
+// the start is derived from its unit file instead of the running process.
+// The adapter of the application's executable keeps it in the foreground and
+// provides its stop signal and healthcheck. A non-empty installCommand installs
+// the packages owning the profiled files before the profile is extracted.
+// baseImage replaces the host OS image; "scratch" adds the profile as the whole root filesystem.
+// The returned data describes the image, e.g. to write it without Docker.
+func GenerateDockerfile(info *profiler.ProcessInfo, dockerfilePath string, layers []LayerArchive, profileDirectory string, volumes []string, adapters *adapter.Registry, installCommand, baseImage string) (DockerfileData, error) {
+	process := buildContainerProcess(info, adapters)
 	dockerfileData := DockerfileData{
-		TarFile:              tarFile,
+		Layers:               layers,
 		ProfileDirectory:     profileDirectory,
-		EnvironmentVariables: info.EnvironmentVariables,
-		UserAndGroup:         userAndGroup,
-		WorkingDirectory:     info.WorkingDirectory,
+		EnvironmentVariables: process.Environment,
+		UserAndGroup:         process.UserAndGroup,
+		WorkingDirectory:     process.WorkingDirectory,
 		TCPPorts:             info.ListeningTCP,
 		UDPPorts:             info.ListeningUDP,
-		Command:              commandLine,
+		Volumes:              volumes,
+		StopSignal:           process.StopSignal,
+		Arguments:            process.Arguments,
+		Command:              buildCommandLine(process.Arguments),
 		BaseImage:            info.OSImage,
+		Scratch:              baseImage == ScratchImage,
+		InstallCommand:       installCommand,
+		Adapter:              process.Adapter,
+	}
+	if baseImage != "" {
+		dockerfileData.BaseImage = baseImage
 	}
 
-	return writeDockerfile(dockerfileData, dockerfilePath)
+	// Run the ExecStartPre steps of a systemd service from a script next to the Dockerfile
+	if len(process.PreStartCommands) > 0 {
+		scriptPath := filepath.Join(filepath.Dir(dockerfilePath), entrypointScriptName)
+		if err := writeEntrypointScript(info.SystemdUnit.Name, process.PreStartCommands, scriptPath); err != nil {
+			return dockerfileData, err
+		}
+		dockerfileData.EntrypointScript = entrypointScriptName
+	}
+
+	dockerfileData.Healthcheck = process.Adapter.HealthcheckInstruction(info.ListeningTCP)
+	if dockerfileData.Scratch && dockerfileData.Healthcheck != "" {
+		// Healthcheck commands rely on tools of the base OS
+		log.Info("Skipping healthcheck in an image without a base OS", "adapter", process.Adapter.Name)
+		dockerfileData.Healthcheck = ""
+	}
+
+	return dockerfileData, writeDockerfile(dockerfileData, dockerfilePath)
 }
 
-// buildCommandLine constructs the CMD array from the executable path
-// and the associated command-line arguments. It produces something like:
-// ["/usr/sbin/nginx", "-g", "daemon on; master_process on;"]
-func buildCommandLine(processInformation *profiler.ProcessInfo) string {
-	var commandSegments []string
+// containerProcess describes how the container runs the application.
+type containerProcess struct {
+	Arguments        []string // Command line, kept in the foreground by the adapter
+	Environment      []string
+	UserAndGroup     string
+	WorkingDirectory string
+	StopSignal       string
+	PreStartCommands []string // Shell lines of the entrypoint script, for systemd services
+	Adapter          adapter.Adapter
+}
+
+// buildContainerProcess derives the start of the container from the running process, or from the
+// unit file of a systemd service, and applies the adapter of the application's executable
+func buildContainerProcess(info *profiler.ProcessInfo, adapters *adapter.Registry) containerProcess {
+	process := containerProcess{
+		Arguments:        processArguments(info),
+		Environment:      info.EnvironmentVariables,
+		UserAndGroup:     fmt.Sprintf("%s:%s", info.ProcessUser, info.ProcessGroup),
+		WorkingDirectory: info.WorkingDirectory,
+	}
+
+	if info.SystemdUnit != nil {
+		startup := buildUnitStartup(info)
+		if len(startup.Command) > 0 {
+			process.Arguments = startup.Command
+		} else {
+			// An empty ExecStart has no command to run; keep the one of the running process
+			log.Warn("Unit has no start command, using the command line of the process", "unit", info.SystemdUnit.Name)
+		}
+		process.Environment = startup.Environment
+		process.UserAndGroup = startup.UserAndGroup
+		process.WorkingDirectory = startup.WorkingDirectory
+		process.StopSignal = startup.StopSignal
+		process.PreStartCommands = startup.PreStartCommands
+	}
+
+	// Apply the application knowledge of the adapter
+	process.Adapter = adapters.Find(process.Arguments[0])
+	log.Info("Applying application adapter", "adapter", process.Adapter.Name)
+	process.Arguments = process.Adapter.ForegroundArguments(process.Arguments)
+	if process.StopSignal == "" {
+		process.StopSignal = process.Adapter.StopSignal
+	}
+	return process
+}
 
-	// Add the executable path (quoted for Docker CMD array).
-	commandSegments = append(commandSegments, fmt.Sprintf("\"%s\"", processInformation.ExecutablePath))
+// quoteEnvironmentVariables quotes the values of KEY=value pairs for ENV instructions
+// when they contain whitespace, quotes or "$"
+func quoteEnvironmentVariables(variables []string) []string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	quoted := make([]string, 0, len(variables))
+	for _, variable := range variables {
+		key, value, _ := strings.Cut(variable, "=")
+		if strings.ContainsAny(value, " \t\"'$\\") {
+			value = `"` + replacer.Replace(value) + `"`
+		}
+		quoted = append(quoted, key+"="+value)
+	}
+	return quoted
+}
 
-	// Append flags and optional values (quoted).
-	for _, argument := range processInformation.CommandLineArguments {
-		commandSegments = append(commandSegments, fmt.Sprintf("\"%s\"", argument.Flag))
+// processArguments returns the executable path and the command-line arguments of the running process
+func processArguments(info *profiler.ProcessInfo) []string {
+	arguments := []string{info.ExecutablePath}
+	for _, argument := range info.CommandLineArguments {
+		arguments = append(arguments, argument.Flag)
 		if argument.Value != "" {
-			commandSegments = append(commandSegments, fmt.Sprintf("\"%s\"", argument.Value))
+			arguments = append(arguments, argument.Value)
 		}
 	}
+	return arguments
+}
 
-	// Join them with commas to form a valid Docker CMD array, e.g.:
-	// CMD ["/usr/sbin/nginx", "-g", "daemon on; master_process on;"]
-	commandString := strings.Join(commandSegments, ", ")
+// buildCommandLine constructs the CMD array from the command arguments.
+// It produces something like:
+// "/usr/sbin/nginx", "-g", "daemon off; master_process on;"
+func buildCommandLine(arguments []string) string {
+	var commandSegments []string
 
-	// Replace "daemon on" with "daemon off" in the entire command string
-	commandString = strings.ReplaceAll(commandString, "daemon on", "daemon off")
+	// Quote every argument for the Docker CMD array
+	for _, argument := range arguments {
+		quoted, _ := json.Marshal(argument)
+		commandSegments = append(commandSegments, string(quoted))
+	}
 
-	return commandString
+	// Join them with commas to form a valid Docker CMD array, e.g.:
+	// CMD ["/usr/sbin/nginx", "-g", "daemon off; master_process on;"]
+	return strings.Join(commandSegments, ", ")
 }
 
 // writeDockerfile writes the Dockerfile to the specified path using the provided data.
 func writeDockerfile(data DockerfileData, dockerfilePath string) error {
+	data.EnvironmentVariables = quoteEnvironmentVariables(data.EnvironmentVariables)
+
 	dockerfileTemplate, parseErr := template.New("Dockerfile").Parse(dockerfileTemplateContent)
 	if parseErr != nil {
 		return parseErr
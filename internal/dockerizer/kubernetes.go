@@ -0,0 +1,427 @@
+package dockerizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"application_profiling/internal/adapter"
+	"application_profiling/internal/profiler"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v2"
+)
+
+// configMapMaxBytes is the size limit of a ConfigMap
+const configMapMaxBytes = 1 << 20
+
+// Lower bounds of the resource requests, for processes that were idle while profiled
+const (
+	minimumMilliCPU  = 10
+	minimumMemoryMiB = 16
+)
+
+// Characters not allowed in Kubernetes object names and in ConfigMap keys
+var (
+	invalidLabelCharacters = regexp.MustCompile(`[^a-z0-9-]+`)
+	invalidKeyCharacters   = regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+)
+
+// KubernetesOptions configures the generated manifests.
+type KubernetesOptions struct {
+	Image             string   // Image of the container
+	Headroom          float64  // Resource requests are the observed usage times the headroom
+	LimitFactor       float64  // Resource limits are the requests times the limit factor
+	VolumeSize        string   // Storage requested for every state directory
+	ConfigDirectories []string // Directories turned into ConfigMaps, next to those of the adapter
+}
+
+// kubernetesObject is a Kubernetes manifest; only the fields of its kind are set
+type kubernetesObject struct {
+	APIVersion string            `yaml:"apiVersion,omitempty"`
+	Kind       string            `yaml:"kind,omitempty"`
+	Metadata   objectMeta        `yaml:"metadata"`
+	Spec       interface{}       `yaml:"spec,omitempty"`
+	Data       map[string]string `yaml:"data,omitempty"`
+	BinaryData map[string]string `yaml:"binaryData,omitempty"`
+}
+
+// objectMeta is the metadata of an object
+type objectMeta struct {
+	Name   string            `yaml:"name,omitempty"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// workloadSpec is the spec of a Deployment or StatefulSet
+type workloadSpec struct {
+	Replicas             int                `yaml:"replicas"`
+	ServiceName          string             `yaml:"serviceName,omitempty"`
+	Selector             labelSelector      `yaml:"selector"`
+	Template             podTemplate        `yaml:"template"`
+	VolumeClaimTemplates []kubernetesObject `yaml:"volumeClaimTemplates,omitempty"`
+}
+
+// labelSelector selects the pods of a workload or Service
+type labelSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+// podTemplate is the pod template of a workload
+type podTemplate struct {
+	Metadata objectMeta `yaml:"metadata"`
+	Spec     podSpec    `yaml:"spec"`
+}
+
+// podSpec is the spec of a pod
+type podSpec struct {
+	SecurityContext *podSecurityContext `yaml:"securityContext,omitempty"`
+	Containers      []container         `yaml:"containers"`
+	Volumes         []podVolume         `yaml:"volumes,omitempty"`
+}
+
+// podSecurityContext sets the user and group of the pod's processes
+type podSecurityContext struct {
+	RunAsUser  *int64 `yaml:"runAsUser,omitempty"`
+	RunAsGroup *int64 `yaml:"runAsGroup,omitempty"`
+}
+
+// container is a container of a pod
+type container struct {
+	Name         string                `yaml:"name"`
+	Image        string                `yaml:"image"`
+	Command      []string              `yaml:"command,omitempty"`
+	Args         []string              `yaml:"args,omitempty"`
+	WorkingDir   string                `yaml:"workingDir,omitempty"`
+	Env          []environmentVariable `yaml:"env,omitempty"`
+	Ports        []containerPort       `yaml:"ports,omitempty"`
+	Resources    *resourceRequirements `yaml:"resources,omitempty"`
+	VolumeMounts []volumeMount         `yaml:"volumeMounts,omitempty"`
+}
+
+// environmentVariable is an environment variable of a container
+type environmentVariable struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// containerPort is a port a container listens on
+type containerPort struct {
+	ContainerPort int    `yaml:"containerPort"`
+	Protocol      string `yaml:"protocol"`
+}
+
+// resourceRequirements holds resource requests and limits
+type resourceRequirements struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+}
+
+// volumeMount mounts a volume into a container
+type volumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+}
+
+// podVolume is a volume of a pod
+type podVolume struct {
+	Name      string           `yaml:"name"`
+	ConfigMap *configMapSource `yaml:"configMap,omitempty"`
+}
+
+// configMapSource projects the keys of a ConfigMap to files
+type configMapSource struct {
+	Name  string      `yaml:"name"`
+	Items []keyToPath `yaml:"items"`
+}
+
+// keyToPath maps a ConfigMap key to a file path
+type keyToPath struct {
+	Key  string `yaml:"key"`
+	Path string `yaml:"path"`
+}
+
+// persistentVolumeClaimSpec is the spec of a volume claim template
+type persistentVolumeClaimSpec struct {
+	AccessModes []string             `yaml:"accessModes"`
+	Resources   resourceRequirements `yaml:"resources"`
+}
+
+// serviceSpec is the spec of a Service
+type serviceSpec struct {
+	ClusterIP string            `yaml:"clusterIP,omitempty"` // "None" for a headless Service
+	Selector  map[string]string `yaml:"selector"`
+	Ports     []servicePort     `yaml:"ports"`
+}
+
+// servicePort is a port of a Service
+type servicePort struct {
+	Name       string `yaml:"name"`
+	Port       int    `yaml:"port"`
+	TargetPort int    `yaml:"targetPort"`
+	Protocol   string `yaml:"protocol"`
+}
+
+// GenerateKubernetesManifests writes the manifests of the profiled application to a multi-document
+// YAML file: a Deployment, or a StatefulSet with a volume claim per state directory and the headless
+// Service that governs it; a Service per listening port; and a ConfigMap per configuration directory,
+// mounted over the directory.
+// The container runs with the same command, user and working directory as the Dockerfile, and its
+// resource requests and limits are derived from the observed usage. It returns the written objects.
+func GenerateKubernetesManifests(info *profiler.ProcessInfo, volumes []string, adapters *adapter.Registry, options KubernetesOptions, manifestPath string) ([]string, error) {
+	process := buildContainerProcess(info, adapters)
+	name := objectName(serviceName(info), "")
+	labels := map[string]string{"app": name}
+
+	// 1. The container, started like the Dockerfile starts it
+	applicationContainer := container{
+		Name:       name,
+		Image:      options.Image,
+		Command:    process.Arguments,
+		WorkingDir: process.WorkingDirectory,
+		Resources:  resourceRequests(observedUsage(info), options),
+	}
+	if len(process.PreStartCommands) > 0 {
+		applicationContainer.Command = []string{"/usr/local/bin/" + entrypointScriptName}
+		applicationContainer.Args = process.Arguments
+	}
+	for _, variable := range process.Environment {
+		key, value, _ := strings.Cut(variable, "=")
+		applicationContainer.Env = append(applicationContainer.Env, environmentVariable{Name: key, Value: value})
+	}
+	for _, port := range info.ListeningTCP {
+		applicationContainer.Ports = append(applicationContainer.Ports, containerPort{ContainerPort: port, Protocol: "TCP"})
+	}
+	for _, port := range info.ListeningUDP {
+		applicationContainer.Ports = append(applicationContainer.Ports, containerPort{ContainerPort: port, Protocol: "UDP"})
+	}
+	pod := podSpec{SecurityContext: securityContext(process.UserAndGroup)}
+
+	// 2. ConfigMaps for the configuration directories
+	var objects []kubernetesObject
+	configDirectories := append(process.Adapter.ConfigDirectories(), options.ConfigDirectories...)
+	for index, directory := range uniqueStrings(configDirectories) {
+		configMap, items, err := directoryConfigMap(directory, objectName(name, fmt.Sprintf("config-%d", index+1)), labels)
+		if err != nil {
+			log.Warn("Skipping configuration directory", "directory", directory, "error", err)
+			continue
+		}
+		volumeName := fmt.Sprintf("config-%d", index+1)
+		pod.Volumes = append(pod.Volumes, podVolume{Name: volumeName, ConfigMap: &configMapSource{Name: configMap.Metadata.Name, Items: items}})
+		applicationContainer.VolumeMounts = append(applicationContainer.VolumeMounts, volumeMount{Name: volumeName, MountPath: directory})
+		objects = append(objects, configMap)
+	}
+
+	// 3. The workload: a StatefulSet keeps a volume claim per state directory
+	workload := workloadSpec{
+		Replicas: 1,
+		Selector: labelSelector{MatchLabels: labels},
+	}
+	kind := "Deployment"
+	if len(volumes) > 0 {
+		kind = "StatefulSet"
+		workload.ServiceName = name
+		for index, volume := range volumes {
+			claimName := fmt.Sprintf("state-%d", index+1)
+			workload.VolumeClaimTemplates = append(workload.VolumeClaimTemplates, kubernetesObject{
+				Metadata: objectMeta{Name: claimName},
+				Spec: persistentVolumeClaimSpec{
+					AccessModes: []string{"ReadWriteOnce"},
+					Resources:   resourceRequirements{Requests: map[string]string{"storage": options.VolumeSize}},
+				},
+			})
+			applicationContainer.VolumeMounts = append(applicationContainer.VolumeMounts, volumeMount{Name: claimName, MountPath: volume})
+		}
+	}
+	pod.Containers = []container{applicationContainer}
+	workload.Template = podTemplate{Metadata: objectMeta{Labels: labels}, Spec: pod}
+	objects = append(objects, kubernetesObject{APIVersion: "apps/v1", Kind: kind, Metadata: objectMeta{Name: name, Labels: labels}, Spec: workload})
+
+	// The StatefulSet's serviceName must name a headless Service, which gives its pods their DNS names
+	if kind == "StatefulSet" {
+		headless := serviceSpec{ClusterIP: "None", Selector: labels}
+		for _, port := range applicationContainer.Ports {
+			portName := fmt.Sprintf("%s-%d", strings.ToLower(port.Protocol), port.ContainerPort)
+			headless.Ports = append(headless.Ports, servicePort{Name: portName, Port: port.ContainerPort, TargetPort: port.ContainerPort, Protocol: port.Protocol})
+		}
+		objects = append(objects, kubernetesObject{APIVersion: "v1", Kind: "Service", Metadata: objectMeta{Name: name, Labels: labels}, Spec: headless})
+	}
+
+	// 4. A Service per listening port
+	for _, port := range applicationContainer.Ports {
+		serviceName := objectName(name, strconv.Itoa(port.ContainerPort))
+		if port.Protocol == "UDP" {
+			serviceName = objectName(name, fmt.Sprintf("%d-udp", port.ContainerPort))
+		}
+		objects = append(objects, kubernetesObject{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Metadata:   objectMeta{Name: serviceName, Labels: labels},
+			Spec: serviceSpec{
+				Selector: labels,
+				Ports:    []servicePort{{Name: strings.ToLower(port.Protocol), Port: port.ContainerPort, TargetPort: port.ContainerPort, Protocol: port.Protocol}},
+			},
+		})
+	}
+
+	return writeManifests(objects, manifestPath)
+}
+
+// observedUsage prefers the usage sampled during the trace window, the 95th percentile of the CPU
+// and the peak of the memory, over the single measurement taken before it
+func observedUsage(info *profiler.ProcessInfo) *profiler.ProcessUsage {
+	if info.SampledUsage == nil {
+		return info.ResourceUsage
+	}
+	return &profiler.ProcessUsage{
+		CPUCores: info.SampledUsage.CPUCores.P95,
+		MemoryMB: info.SampledUsage.RSSMB.Max,
+	}
+}
+
+// resourceRequests derives the requests from the observed usage and the headroom, and the limits from the requests
+func resourceRequests(usage *profiler.ProcessUsage, options KubernetesOptions) *resourceRequirements {
+	if usage == nil {
+		return nil
+	}
+	milliCPU := max(int(math.Ceil(usage.CPUCores*1000*options.Headroom)), minimumMilliCPU)
+	memoryMiB := max(int(math.Ceil(usage.MemoryMB*options.Headroom)), minimumMemoryMiB)
+	return &resourceRequirements{
+		Requests: map[string]string{
+			"cpu":    fmt.Sprintf("%dm", milliCPU),
+			"memory": fmt.Sprintf("%dMi", memoryMiB),
+		},
+		Limits: map[string]string{
+			"cpu":    fmt.Sprintf("%dm", int(math.Ceil(float64(milliCPU)*options.LimitFactor))),
+			"memory": fmt.Sprintf("%dMi", int(math.Ceil(float64(memoryMiB)*options.LimitFactor))),
+		},
+	}
+}
+
+// securityContext resolves the user and group of the container to the numeric IDs Kubernetes needs
+func securityContext(userAndGroup string) *podSecurityContext {
+	userName, groupName, _ := strings.Cut(userAndGroup, ":")
+	context := &podSecurityContext{}
+	if userID, err := strconv.ParseInt(userName, 10, 64); err == nil {
+		context.RunAsUser = &userID
+	} else if account, err := user.Lookup(userName); err == nil {
+		userID, _ := strconv.ParseInt(account.Uid, 10, 64)
+		context.RunAsUser = &userID
+	} else {
+		log.Warn("Unknown user, leaving the user to the image", "user", userName)
+		return nil
+	}
+
+	if groupName == "" {
+		return context
+	}
+	if groupID, err := strconv.ParseInt(groupName, 10, 64); err == nil {
+		context.RunAsGroup = &groupID
+	} else if group, err := user.LookupGroup(groupName); err == nil {
+		groupID, _ := strconv.ParseInt(group.Gid, 10, 64)
+		context.RunAsGroup = &groupID
+	} else {
+		log.Warn("Unknown group, leaving the group to the image", "group", groupName)
+	}
+	return context
+}
+
+// directoryConfigMap reads the files below a directory into a ConfigMap, and returns the items that
+// put every key back at its relative path. Symbolic links are stored with the content they point to.
+func directoryConfigMap(directory, name string, labels map[string]string) (kubernetesObject, []keyToPath, error) {
+	configMap := kubernetesObject{APIVersion: "v1", Kind: "ConfigMap", Metadata: objectMeta{Name: name, Labels: labels}}
+	var items []keyToPath
+	usedKeys := make(map[string]bool)
+	totalBytes := 0
+	err := filepath.WalkDir(directory, func(currentPath string, entry fs.DirEntry, walkError error) error {
+		if walkError != nil || entry.IsDir() {
+			return walkError
+		}
+		content, err := os.ReadFile(currentPath)
+		if err != nil {
+			return err
+		}
+		totalBytes += len(content)
+		if totalBytes > configMapMaxBytes {
+			return fmt.Errorf("files exceed the ConfigMap size limit of %d bytes", configMapMaxBytes)
+		}
+
+		relativePath, err := filepath.Rel(directory, currentPath)
+		if err != nil {
+			return err
+		}
+		key := uniqueName(strings.Trim(invalidKeyCharacters.ReplaceAllString(strings.ReplaceAll(relativePath, "/", "_"), "-"), "."), usedKeys)
+		if utf8.Valid(content) {
+			if configMap.Data == nil {
+				configMap.Data = make(map[string]string)
+			}
+			configMap.Data[key] = string(content)
+		} else {
+			if configMap.BinaryData == nil {
+				configMap.BinaryData = make(map[string]string)
+			}
+			configMap.BinaryData[key] = base64.StdEncoding.EncodeToString(content)
+		}
+		items = append(items, keyToPath{Key: key, Path: filepath.ToSlash(relativePath)})
+		return nil
+	})
+	if err != nil {
+		return configMap, nil, err
+	}
+	if len(items) == 0 {
+		return configMap, nil, fmt.Errorf("no files")
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	return configMap, items, nil
+}
+
+// objectName builds a Kubernetes object name (an RFC 1123 label) from a base name and an optional suffix
+func objectName(base, suffix string) string {
+	name := strings.Trim(invalidLabelCharacters.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		name = "app-" + name
+	}
+	maximumLength := 63
+	if suffix != "" {
+		maximumLength -= len(suffix) + 1
+	}
+	name = strings.TrimRight(name[:min(len(name), maximumLength)], "-")
+	if suffix != "" {
+		name += "-" + suffix
+	}
+	return name
+}
+
+// uniqueStrings removes repeated values, keeping the first occurrence
+func uniqueStrings(values []string) []string {
+	var unique []string
+	for _, value := range values {
+		if !containsString(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// writeManifests writes the objects as a multi-document YAML file and returns their "Kind/name" references
+func writeManifests(objects []kubernetesObject, manifestPath string) ([]string, error) {
+	var documents []string
+	var references []string
+	for _, object := range objects {
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, string(data))
+		references = append(references, object.Kind+"/"+object.Metadata.Name)
+	}
+	return references, os.WriteFile(manifestPath, []byte(strings.Join(documents, "---\n")), 0o644)
+}
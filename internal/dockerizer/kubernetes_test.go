@@ -0,0 +1,107 @@
+package dockerizer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"application_profiling/internal/adapter"
+	"application_profiling/internal/profiler"
+
+	"gopkg.in/yaml.v2"
+)
+
+// manifestObject holds the fields of a generated manifest the tests check
+type manifestObject struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		ServiceName string        `yaml:"serviceName"`
+		ClusterIP   string        `yaml:"clusterIP"`
+		Ports       []servicePort `yaml:"ports"`
+	} `yaml:"spec"`
+}
+
+// generateTestManifests generates the manifests of a server listening on TCP 5000 and UDP 5001
+// and returns them by kind and name
+func generateTestManifests(t *testing.T, volumes []string) map[string]manifestObject {
+	t.Helper()
+	adapters, err := adapter.LoadRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &profiler.ProcessInfo{
+		ExecutablePath: "/opt/app/bin/server",
+		ProcessUser:    "app",
+		ProcessGroup:   "app",
+		ListeningTCP:   []int{5000},
+		ListeningUDP:   []int{5001},
+	}
+	options := KubernetesOptions{Image: "localhost/app:latest", Headroom: 1.5, LimitFactor: 2, VolumeSize: "1Gi"}
+	manifestPath := filepath.Join(t.TempDir(), "manifests.yaml")
+	if _, err := GenerateKubernetesManifests(info, volumes, adapters, options, manifestPath); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := make(map[string]manifestObject)
+	for _, document := range strings.Split(string(data), "---\n") {
+		var object manifestObject
+		if err := yaml.Unmarshal([]byte(document), &object); err != nil {
+			t.Fatal(err)
+		}
+		objects[object.Kind+"/"+object.Metadata.Name] = object
+	}
+	return objects
+}
+
+func TestStatefulSetHeadlessService(t *testing.T) {
+	objects := generateTestManifests(t, []string{"/var/lib/app"})
+
+	statefulSet, found := objects["StatefulSet/server"]
+	if !found {
+		t.Fatalf("no StatefulSet/server among %v", objects)
+	}
+	headless, found := objects["Service/"+statefulSet.Spec.ServiceName]
+	if !found {
+		t.Fatalf("no Service named by serviceName %q", statefulSet.Spec.ServiceName)
+	}
+	if headless.Spec.ClusterIP != "None" {
+		t.Errorf("Service %s has clusterIP %q, want a headless Service", headless.Metadata.Name, headless.Spec.ClusterIP)
+	}
+	wantPorts := []servicePort{
+		{Name: "tcp-5000", Port: 5000, TargetPort: 5000, Protocol: "TCP"},
+		{Name: "udp-5001", Port: 5001, TargetPort: 5001, Protocol: "UDP"},
+	}
+	if !reflect.DeepEqual(headless.Spec.Ports, wantPorts) {
+		t.Errorf("headless Service ports = %+v, want %+v", headless.Spec.Ports, wantPorts)
+	}
+
+	// The Services per port stay
+	for _, name := range []string{"Service/server-5000", "Service/server-5001-udp"} {
+		object, found := objects[name]
+		if !found {
+			t.Errorf("no %s", name)
+		} else if object.Spec.ClusterIP != "" {
+			t.Errorf("%s: clusterIP %q, want none", name, object.Spec.ClusterIP)
+		}
+	}
+}
+
+func TestDeploymentWithoutHeadlessService(t *testing.T) {
+	objects := generateTestManifests(t, nil)
+
+	if _, found := objects["Deployment/server"]; !found {
+		t.Fatalf("no Deployment/server among %v", objects)
+	}
+	if _, found := objects["Service/server"]; found {
+		t.Error("a Deployment gets a headless Service")
+	}
+}
@@ -0,0 +1,110 @@
+package dockerizer
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+
+	"application_profiling/internal/profiler"
+
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed layers/default.yaml
+var defaultLayersData []byte
+
+// otherLayerName is the layer of the files no layer rule matches
+const otherLayerName = "other"
+
+// LayerDefinition names an image layer and the paths it holds.
+type LayerDefinition struct {
+	Name  string                 `yaml:"name"`
+	Paths []profiler.RuleMatcher `yaml:"paths"`
+}
+
+// layersFile is the layout of a layers YAML file
+type layersFile struct {
+	Layers []LayerDefinition `yaml:"layers"`
+}
+
+// LayerRules assigns profile files to ordered image layers.
+type LayerRules struct {
+	names    []string
+	matchers [][]func(path string) bool
+}
+
+// LoadLayerRules loads the built-in layers, or the layers of the user file instead, if given.
+func LoadLayerRules(userLayersPath string) (*LayerRules, error) {
+	if userLayersPath == "" {
+		rules, err := parseLayerRules(defaultLayersData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default layers: %w", err)
+		}
+		return rules, nil
+	}
+
+	data, err := os.ReadFile(userLayersPath)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseLayerRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid layers file %s: %w", userLayersPath, err)
+	}
+	return rules, nil
+}
+
+// parseLayerRules parses a layers file and compiles its path rules
+func parseLayerRules(data []byte) (*LayerRules, error) {
+	var file layersFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	rules := &LayerRules{}
+	for _, layer := range file.Layers {
+		if layer.Name == "" || layer.Name == otherLayerName || containsString(rules.names, layer.Name) {
+			return nil, fmt.Errorf("layer names must be unique, non-empty and not %q", otherLayerName)
+		}
+		var matchers []func(path string) bool
+		for _, matcher := range layer.Paths {
+			match, err := matcher.Compile()
+			if err != nil {
+				return nil, fmt.Errorf("layer %s: %w", layer.Name, err)
+			}
+			matchers = append(matchers, match)
+		}
+		rules.names = append(rules.names, layer.Name)
+		rules.matchers = append(rules.matchers, matchers)
+	}
+	rules.names = append(rules.names, otherLayerName)
+	rules.matchers = append(rules.matchers, nil)
+	return rules, nil
+}
+
+// Names returns the layer names in image order, ending with the layer of unmatched files
+func (rules *LayerRules) Names() []string {
+	return rules.names
+}
+
+// Layer returns the index of the first layer with a rule matching the path
+func (rules *LayerRules) Layer(path string) int {
+	for index, matchers := range rules.matchers {
+		for _, match := range matchers {
+			if match(path) {
+				return index
+			}
+		}
+	}
+	return len(rules.names) - 1
+}
+
+// containsString checks if the value is in the list
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,397 @@
+package dockerizer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// Media types and file names of the OCI image specification
+const (
+	ociLayoutVersion     = "1.0.0"
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+	ociLayerMediaType    = "application/vnd.oci.image.layer.v1.tar+gzip"
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+	ociLayoutFile        = "oci-layout"
+	ociIndexFile         = "index.json"
+	dockerManifestFile   = "manifest.json"
+)
+
+// Output formats of the image writer
+const (
+	ImageFormatOCI           = "oci"
+	ImageFormatDockerArchive = "docker-archive"
+)
+
+// ociDescriptor references a blob of the image layout
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+}
+
+// ociPlatform is the platform of a manifest referenced by a multi-platform index
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// ociIndex is the index.json entry point of an image layout
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest lists the config and layers of an image
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// ociImageConfig is the configuration of an image: its platform, run settings and layers
+type ociImageConfig struct {
+	Created      string           `json:"created"`
+	Architecture string           `json:"architecture"`
+	OS           string           `json:"os"`
+	Config       ociRuntimeConfig `json:"config"`
+	RootFS       ociRootFS        `json:"rootfs"`
+	History      []ociHistory     `json:"history"`
+}
+
+// ociRuntimeConfig holds the execution parameters of a container created from the image
+type ociRuntimeConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+}
+
+// ociRootFS lists the digests of the uncompressed layers
+type ociRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// ociHistory describes how a layer was created
+type ociHistory struct {
+	Created   string `json:"created"`
+	CreatedBy string `json:"created_by"`
+}
+
+// dockerManifestEntry is an image of the manifest.json read by "docker load"
+type dockerManifestEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// imageLayer is a layer blob written to the layout
+type imageLayer struct {
+	descriptor ociDescriptor
+	diffID     string // Digest of the uncompressed layer
+	createdBy  string
+}
+
+// WriteOCIImage writes the image described by the Dockerfile data to an OCI image layout directory.
+// The layer archives and the entrypoint script are read from the context directory next to the
+// Dockerfile: each archive becomes a layer, and the entrypoint script, if any, a last one.
+// The image config is taken from the Dockerfile data, so the image matches the Dockerfile.
+func WriteOCIImage(data DockerfileData, contextDirectory, layoutDirectory, reference string) error {
+	blobDirectory := filepath.Join(layoutDirectory, "blobs", "sha256")
+	if err := os.MkdirAll(blobDirectory, 0o755); err != nil {
+		return err
+	}
+
+	// 1. Write the layers
+	var layers []imageLayer
+	for _, archive := range data.Layers {
+		layer, err := importLayerArchive(blobDirectory, filepath.Join(contextDirectory, archive.File))
+		if err != nil {
+			return fmt.Errorf("failed to write layer %s: %w", archive.Name, err)
+		}
+		layer.createdBy = "vm2container: " + archive.Name
+		layers = append(layers, layer)
+	}
+
+	if data.EntrypointScript != "" {
+		scriptLayer, err := writeLayer(blobDirectory, func(tarWriter *tar.Writer) error {
+			return addFileAs(tarWriter, filepath.Join(contextDirectory, data.EntrypointScript), "usr/local/bin/"+data.EntrypointScript)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write entrypoint layer: %w", err)
+		}
+		scriptLayer.createdBy = "vm2container: entrypoint script"
+		layers = append(layers, scriptLayer)
+	}
+
+	// 2. Write the config and the manifest referencing it
+	configDescriptor, err := writeJSONBlob(blobDirectory, ociConfigMediaType, buildImageConfig(data, layers))
+	if err != nil {
+		return err
+	}
+	manifest := ociManifest{SchemaVersion: 2, MediaType: ociManifestMediaType, Config: configDescriptor}
+	for _, layer := range layers {
+		manifest.Layers = append(manifest.Layers, layer.descriptor)
+	}
+	manifestDescriptor, err := writeJSONBlob(blobDirectory, ociManifestMediaType, manifest)
+	if err != nil {
+		return err
+	}
+
+	// 3. Write the entry points of the layout, and the manifest.json read by "docker load"
+	manifestDescriptor.Annotations = map[string]string{ociRefNameAnnotation: reference}
+	index := ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType, Manifests: []ociDescriptor{manifestDescriptor}}
+	if err := writeJSONFile(filepath.Join(layoutDirectory, ociIndexFile), index); err != nil {
+		return err
+	}
+	if err := writeJSONFile(filepath.Join(layoutDirectory, ociLayoutFile), map[string]string{"imageLayoutVersion": ociLayoutVersion}); err != nil {
+		return err
+	}
+	dockerManifest := []dockerManifestEntry{{Config: blobPath(configDescriptor.Digest), RepoTags: []string{reference}}}
+	for _, layer := range layers {
+		dockerManifest[0].Layers = append(dockerManifest[0].Layers, blobPath(layer.descriptor.Digest))
+	}
+	return writeJSONFile(filepath.Join(layoutDirectory, dockerManifestFile), dockerManifest)
+}
+
+// WriteDockerArchive packs an image layout directory into a tarball that "docker load" accepts
+func WriteDockerArchive(layoutDirectory, archivePath string) error {
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	tarWriter := tar.NewWriter(archive)
+	defer tarWriter.Close()
+
+	return filepath.Walk(layoutDirectory, func(currentPath string, fileInfo os.FileInfo, walkError error) error {
+		if walkError != nil {
+			return walkError
+		}
+		return addToTarArchive(tarWriter, layoutDirectory, currentPath, fileInfo)
+	})
+}
+
+// buildImageConfig maps the Dockerfile instructions to the image configuration
+func buildImageConfig(data DockerfileData, layers []imageLayer) ociImageConfig {
+	created := time.Now().UTC().Format(time.RFC3339)
+	config := ociImageConfig{
+		Created:      created,
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		Config: ociRuntimeConfig{
+			User:       data.UserAndGroup,
+			Env:        data.EnvironmentVariables,
+			Cmd:        data.Arguments,
+			WorkingDir: data.WorkingDirectory,
+			StopSignal: data.StopSignal,
+		},
+		RootFS: ociRootFS{Type: "layers"},
+	}
+	if data.EntrypointScript != "" {
+		config.Config.Entrypoint = []string{"/usr/local/bin/" + data.EntrypointScript}
+	}
+
+	ports := make(map[string]struct{})
+	for _, port := range data.TCPPorts {
+		ports[fmt.Sprintf("%d/tcp", port)] = struct{}{}
+	}
+	for _, port := range data.UDPPorts {
+		ports[fmt.Sprintf("%d/udp", port)] = struct{}{}
+	}
+	if len(ports) > 0 {
+		config.Config.ExposedPorts = ports
+	}
+	if len(data.Volumes) > 0 {
+		config.Config.Volumes = make(map[string]struct{})
+		for _, volume := range data.Volumes {
+			config.Config.Volumes[volume] = struct{}{}
+		}
+	}
+
+	for _, layer := range layers {
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, layer.diffID)
+		config.History = append(config.History, ociHistory{Created: created, CreatedBy: layer.createdBy})
+	}
+	return config
+}
+
+// writeLayer writes a gzip-compressed layer blob with the entries added by addEntries.
+// The blob is named by the digest of the compressed data; the diff ID is the digest of the tar stream.
+func writeLayer(blobDirectory string, addEntries func(tarWriter *tar.Writer) error) (imageLayer, error) {
+	temporaryFile, err := os.CreateTemp(blobDirectory, "layer-*")
+	if err != nil {
+		return imageLayer{}, err
+	}
+	defer os.Remove(temporaryFile.Name())
+	defer temporaryFile.Close()
+
+	compressedDigest, uncompressedDigest := sha256.New(), sha256.New()
+	compressedCounter := &countingWriter{writer: io.MultiWriter(temporaryFile, compressedDigest)}
+	gzipWriter := gzip.NewWriter(compressedCounter)
+	tarWriter := tar.NewWriter(io.MultiWriter(gzipWriter, uncompressedDigest))
+
+	if err := addEntries(tarWriter); err != nil {
+		return imageLayer{}, err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return imageLayer{}, err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return imageLayer{}, err
+	}
+
+	if err := temporaryFile.Chmod(0o644); err != nil {
+		return imageLayer{}, err
+	}
+	digest := formatDigest(compressedDigest)
+	if err := os.Rename(temporaryFile.Name(), filepath.Join(blobDirectory, digestHex(digest))); err != nil {
+		return imageLayer{}, err
+	}
+	return imageLayer{
+		descriptor: ociDescriptor{MediaType: ociLayerMediaType, Digest: digest, Size: compressedCounter.count},
+		diffID:     formatDigest(uncompressedDigest),
+	}, nil
+}
+
+// importLayerArchive copies a tar.gz archive into the blobs as a layer, computing the digests of its
+// compressed and uncompressed content
+func importLayerArchive(blobDirectory, archivePath string) (imageLayer, error) {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return imageLayer{}, err
+	}
+	defer archive.Close()
+
+	temporaryFile, err := os.CreateTemp(blobDirectory, "layer-*")
+	if err != nil {
+		return imageLayer{}, err
+	}
+	defer os.Remove(temporaryFile.Name())
+	defer temporaryFile.Close()
+
+	// Copy the archive while decompressing it to hash the tar stream
+	compressedDigest, uncompressedDigest := sha256.New(), sha256.New()
+	compressedCounter := &countingWriter{writer: io.MultiWriter(temporaryFile, compressedDigest)}
+	copier := io.TeeReader(archive, compressedCounter)
+	gzipReader, err := gzip.NewReader(copier)
+	if err != nil {
+		return imageLayer{}, err
+	}
+	if _, err := io.Copy(uncompressedDigest, gzipReader); err != nil {
+		return imageLayer{}, err
+	}
+	if _, err := io.Copy(io.Discard, copier); err != nil {
+		return imageLayer{}, err
+	}
+
+	if err := temporaryFile.Chmod(0o644); err != nil {
+		return imageLayer{}, err
+	}
+	digest := formatDigest(compressedDigest)
+	if err := os.Rename(temporaryFile.Name(), filepath.Join(blobDirectory, digestHex(digest))); err != nil {
+		return imageLayer{}, err
+	}
+	return imageLayer{
+		descriptor: ociDescriptor{MediaType: ociLayerMediaType, Digest: digest, Size: compressedCounter.count},
+		diffID:     formatDigest(uncompressedDigest),
+	}, nil
+}
+
+// addFileAs adds a regular file to a tar archive under another name, creating its parent directories
+func addFileAs(tarWriter *tar.Writer, sourcePath, name string) error {
+	fileInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		return err
+	}
+	var parents []string
+	for parent := filepath.Dir(name); parent != "."; parent = filepath.Dir(parent) {
+		parents = append([]string{parent}, parents...)
+	}
+	for _, parent := range parents {
+		header := &tar.Header{Typeflag: tar.TypeDir, Name: parent + "/", Mode: 0o755, ModTime: fileInfo.ModTime()}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+	}
+
+	header, err := tar.FileInfoHeader(fileInfo, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Uid, header.Gid = 0, 0
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	return writeFileToTar(tarWriter, sourcePath)
+}
+
+// writeJSONBlob writes a JSON document as a blob and returns its descriptor
+func writeJSONBlob(blobDirectory, mediaType string, document interface{}) (ociDescriptor, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	digest := sha256.Sum256(data)
+	descriptor := ociDescriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(digest[:]), Size: int64(len(data))}
+	return descriptor, os.WriteFile(filepath.Join(blobDirectory, hex.EncodeToString(digest[:])), data, 0o644)
+}
+
+// writeJSONFile writes a JSON document to a file of the layout
+func writeJSONFile(filePath string, document interface{}) error {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0o644)
+}
+
+// formatDigest returns the "sha256:<hex>" digest of the data written to the hash
+func formatDigest(digest hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(digest.Sum(nil))
+}
+
+// digestHex returns the hex part of a "sha256:<hex>" digest
+func digestHex(digest string) string {
+	return digest[len("sha256:"):]
+}
+
+// blobPath returns the path of a blob relative to the layout directory
+func blobPath(digest string) string {
+	return "blobs/sha256/" + digestHex(digest)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+// Write writes to the underlying writer and counts the written bytes
+func (counter *countingWriter) Write(data []byte) (int, error) {
+	written, err := counter.writer.Write(data)
+	counter.count += int64(written)
+	return written, err
+}
@@ -0,0 +1,180 @@
+package dockerizer
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// digestPattern matches the sha256 digests used by the image layout
+var digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// ValidateOCILayout checks an image layout directory against the OCI image specification:
+// the oci-layout version, the index and manifest schema and media types, the digest and size
+// of every referenced blob, and the config's diff IDs against the uncompressed layers.
+func ValidateOCILayout(layoutDirectory string) error {
+	// 1. The layout marker
+	var layout struct {
+		ImageLayoutVersion string `json:"imageLayoutVersion"`
+	}
+	if err := readJSONFile(filepath.Join(layoutDirectory, ociLayoutFile), &layout); err != nil {
+		return err
+	}
+	if layout.ImageLayoutVersion != ociLayoutVersion {
+		return fmt.Errorf("%s: unsupported imageLayoutVersion %q", ociLayoutFile, layout.ImageLayoutVersion)
+	}
+
+	// 2. The index and the manifests it references
+	var index ociIndex
+	if err := readJSONFile(filepath.Join(layoutDirectory, ociIndexFile), &index); err != nil {
+		return err
+	}
+	if index.SchemaVersion != 2 {
+		return fmt.Errorf("%s: schemaVersion must be 2, got %d", ociIndexFile, index.SchemaVersion)
+	}
+	if index.MediaType != "" && index.MediaType != ociIndexMediaType {
+		return fmt.Errorf("%s: unexpected mediaType %q", ociIndexFile, index.MediaType)
+	}
+	if len(index.Manifests) == 0 {
+		return fmt.Errorf("%s: no manifests", ociIndexFile)
+	}
+
+	for _, manifestDescriptor := range index.Manifests {
+		if err := validateManifest(layoutDirectory, manifestDescriptor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateManifest checks a manifest, its config and its layers
+func validateManifest(layoutDirectory string, descriptor ociDescriptor) error {
+	if descriptor.MediaType != ociManifestMediaType {
+		return fmt.Errorf("manifest %s: unexpected mediaType %q", descriptor.Digest, descriptor.MediaType)
+	}
+	var manifest ociManifest
+	if err := readBlob(layoutDirectory, descriptor, &manifest); err != nil {
+		return err
+	}
+	if manifest.SchemaVersion != 2 {
+		return fmt.Errorf("manifest %s: schemaVersion must be 2, got %d", descriptor.Digest, manifest.SchemaVersion)
+	}
+	if manifest.MediaType != "" && manifest.MediaType != ociManifestMediaType {
+		return fmt.Errorf("manifest %s: unexpected mediaType %q", descriptor.Digest, manifest.MediaType)
+	}
+
+	if manifest.Config.MediaType != ociConfigMediaType {
+		return fmt.Errorf("config %s: unexpected mediaType %q", manifest.Config.Digest, manifest.Config.MediaType)
+	}
+	var config ociImageConfig
+	if err := readBlob(layoutDirectory, manifest.Config, &config); err != nil {
+		return err
+	}
+	if config.Architecture == "" || config.OS == "" {
+		return fmt.Errorf("config %s: architecture and os are required", manifest.Config.Digest)
+	}
+	if config.RootFS.Type != "layers" {
+		return fmt.Errorf("config %s: rootfs type must be \"layers\", got %q", manifest.Config.Digest, config.RootFS.Type)
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		return fmt.Errorf("config %s: %d diff_ids for %d layers", manifest.Config.Digest, len(config.RootFS.DiffIDs), len(manifest.Layers))
+	}
+
+	for i, layer := range manifest.Layers {
+		if layer.MediaType != ociLayerMediaType {
+			return fmt.Errorf("layer %s: unexpected mediaType %q", layer.Digest, layer.MediaType)
+		}
+		diffID, err := verifyLayer(layoutDirectory, layer)
+		if err != nil {
+			return err
+		}
+		if diffID != config.RootFS.DiffIDs[i] {
+			return fmt.Errorf("layer %s: diff_id %s does not match the uncompressed content %s", layer.Digest, config.RootFS.DiffIDs[i], diffID)
+		}
+	}
+	return nil
+}
+
+// readBlob verifies a JSON blob against its descriptor and decodes it
+func readBlob(layoutDirectory string, descriptor ociDescriptor, document interface{}) error {
+	data, err := readVerifiedBlob(layoutDirectory, descriptor)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, document); err != nil {
+		return fmt.Errorf("blob %s: %w", descriptor.Digest, err)
+	}
+	return nil
+}
+
+// readVerifiedBlob reads a blob and checks its size and digest
+func readVerifiedBlob(layoutDirectory string, descriptor ociDescriptor) ([]byte, error) {
+	if !digestPattern.MatchString(descriptor.Digest) {
+		return nil, fmt.Errorf("invalid digest %q", descriptor.Digest)
+	}
+	data, err := os.ReadFile(filepath.Join(layoutDirectory, blobPath(descriptor.Digest)))
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", descriptor.Digest, err)
+	}
+	if int64(len(data)) != descriptor.Size {
+		return nil, fmt.Errorf("blob %s: size %d does not match descriptor size %d", descriptor.Digest, len(data), descriptor.Size)
+	}
+	digest := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(digest[:]) != descriptor.Digest {
+		return nil, fmt.Errorf("blob %s: content does not match its digest", descriptor.Digest)
+	}
+	return data, nil
+}
+
+// verifyLayer checks the size and digest of a compressed layer blob and returns the digest of its uncompressed content
+func verifyLayer(layoutDirectory string, descriptor ociDescriptor) (string, error) {
+	if !digestPattern.MatchString(descriptor.Digest) {
+		return "", fmt.Errorf("invalid digest %q", descriptor.Digest)
+	}
+	blob, err := os.Open(filepath.Join(layoutDirectory, blobPath(descriptor.Digest)))
+	if err != nil {
+		return "", fmt.Errorf("layer %s: %w", descriptor.Digest, err)
+	}
+	defer blob.Close()
+
+	compressedDigest := sha256.New()
+	counter := &countingWriter{writer: compressedDigest}
+	gzipReader, err := gzip.NewReader(io.TeeReader(blob, counter))
+	if err != nil {
+		return "", fmt.Errorf("layer %s: %w", descriptor.Digest, err)
+	}
+	uncompressedDigest := sha256.New()
+	if _, err := io.Copy(uncompressedDigest, gzipReader); err != nil {
+		return "", fmt.Errorf("layer %s: %w", descriptor.Digest, err)
+	}
+	// Count trailing bytes the gzip reader did not consume
+	if _, err := io.Copy(counter, blob); err != nil {
+		return "", err
+	}
+
+	if counter.count != descriptor.Size {
+		return "", fmt.Errorf("layer %s: size %d does not match descriptor size %d", descriptor.Digest, counter.count, descriptor.Size)
+	}
+	if formatDigest(compressedDigest) != descriptor.Digest {
+		return "", fmt.Errorf("layer %s: content does not match its digest", descriptor.Digest)
+	}
+	return formatDigest(uncompressedDigest), nil
+}
+
+// readJSONFile decodes a JSON file of the layout
+func readJSONFile(filePath string, document interface{}) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, document); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(filePath), err)
+	}
+	return nil
+}
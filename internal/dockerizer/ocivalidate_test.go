@@ -0,0 +1,180 @@
+package dockerizer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestImage writes the image of a small profile to an OCI image layout in a temporary directory
+func writeTestImage(t *testing.T) string {
+	t.Helper()
+	profileDirectory, contextDirectory, layoutDirectory := t.TempDir(), t.TempDir(), t.TempDir()
+
+	files := map[string]string{
+		"etc/app/app.conf": "listen 8080\n",
+		"usr/bin/app":      "#!/bin/sh\nexec sleep infinity\n",
+	}
+	for name, content := range files {
+		filePath := filepath.Join(profileDirectory, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(contextDirectory, "entrypoint.sh"), []byte("#!/bin/sh\nexec \"$@\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadLayerRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archives, err := CreateLayerArchives(profileDirectory, contextDirectory, rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := DockerfileData{
+		Layers:           archives,
+		EntrypointScript: "entrypoint.sh",
+		Arguments:        []string{"/usr/bin/app"},
+		TCPPorts:         []int{8080},
+	}
+	if err := WriteOCIImage(data, contextDirectory, layoutDirectory, "app:latest"); err != nil {
+		t.Fatal(err)
+	}
+	return layoutDirectory
+}
+
+// rewriteManifest lets edit change the manifest and the config of an image layout, and writes them back
+func rewriteManifest(t *testing.T, layoutDirectory string, edit func(manifest *ociManifest, config *ociImageConfig)) {
+	t.Helper()
+	var index ociIndex
+	if err := readJSONFile(filepath.Join(layoutDirectory, ociIndexFile), &index); err != nil {
+		t.Fatal(err)
+	}
+	var manifest ociManifest
+	if err := readBlob(layoutDirectory, index.Manifests[0], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	var config ociImageConfig
+	if err := readBlob(layoutDirectory, manifest.Config, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	edit(&manifest, &config)
+
+	blobDirectory := filepath.Join(layoutDirectory, "blobs", "sha256")
+	configDescriptor, err := writeJSONBlob(blobDirectory, ociConfigMediaType, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Config = configDescriptor
+	manifestDescriptor, err := writeJSONBlob(blobDirectory, ociManifestMediaType, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Manifests[0] = manifestDescriptor
+	if err := writeJSONFile(filepath.Join(layoutDirectory, ociIndexFile), index); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateOCILayout(t *testing.T) {
+	layoutDirectory := writeTestImage(t)
+	if err := ValidateOCILayout(layoutDirectory); err != nil {
+		t.Fatalf("ValidateOCILayout() = %v, want no error", err)
+	}
+}
+
+func TestValidateOCILayoutErrors(t *testing.T) {
+	// An all-zero digest, which no blob of the layout has
+	const otherDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, layoutDirectory string)
+		want    string
+	}{
+		{
+			name: "malformed layer digest",
+			corrupt: func(t *testing.T, layoutDirectory string) {
+				rewriteManifest(t, layoutDirectory, func(manifest *ociManifest, config *ociImageConfig) {
+					manifest.Layers[0].Digest = "sha256:not-hex"
+				})
+			},
+			want: `invalid digest "sha256:not-hex"`,
+		},
+		{
+			name: "layer content does not match its digest",
+			corrupt: func(t *testing.T, layoutDirectory string) {
+				rewriteManifest(t, layoutDirectory, func(manifest *ociManifest, config *ociImageConfig) {
+					// Move the layer to a blob named by another digest
+					blobDirectory := filepath.Join(layoutDirectory, "blobs", "sha256")
+					err := os.Rename(filepath.Join(blobDirectory, digestHex(manifest.Layers[0].Digest)), filepath.Join(blobDirectory, digestHex(otherDigest)))
+					if err != nil {
+						t.Fatal(err)
+					}
+					manifest.Layers[0].Digest = otherDigest
+				})
+			},
+			want: "content does not match its digest",
+		},
+		{
+			name: "layer size mismatch",
+			corrupt: func(t *testing.T, layoutDirectory string) {
+				rewriteManifest(t, layoutDirectory, func(manifest *ociManifest, config *ociImageConfig) {
+					manifest.Layers[0].Size++
+				})
+			},
+			want: "does not match descriptor size",
+		},
+		{
+			name: "manifest size mismatch",
+			corrupt: func(t *testing.T, layoutDirectory string) {
+				var index ociIndex
+				if err := readJSONFile(filepath.Join(layoutDirectory, ociIndexFile), &index); err != nil {
+					t.Fatal(err)
+				}
+				index.Manifests[0].Size--
+				if err := writeJSONFile(filepath.Join(layoutDirectory, ociIndexFile), index); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "does not match descriptor size",
+		},
+		{
+			name: "diff_id mismatch",
+			corrupt: func(t *testing.T, layoutDirectory string) {
+				rewriteManifest(t, layoutDirectory, func(manifest *ociManifest, config *ociImageConfig) {
+					config.RootFS.DiffIDs[0] = otherDigest
+				})
+			},
+			want: "diff_id " + otherDigest + " does not match the uncompressed content",
+		},
+		{
+			name: "missing diff_id",
+			corrupt: func(t *testing.T, layoutDirectory string) {
+				rewriteManifest(t, layoutDirectory, func(manifest *ociManifest, config *ociImageConfig) {
+					config.RootFS.DiffIDs = config.RootFS.DiffIDs[1:]
+				})
+			},
+			want: "diff_ids for",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layoutDirectory := writeTestImage(t)
+			test.corrupt(t, layoutDirectory)
+
+			err := ValidateOCILayout(layoutDirectory)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("ValidateOCILayout() = %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,561 @@
+package dockerizer
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v2"
+)
+
+// Package is an installed package that owns profiled files.
+type Package struct {
+	Name         string   `yaml:"name"`
+	Version      string   `yaml:"version"`
+	Architecture string   `yaml:"architecture,omitempty"`
+	Essential    bool     `yaml:"essential,omitempty"` // Part of every base image, never installed explicitly
+	Files        []string `yaml:"files,omitempty"`     // Profiled files owned by the package
+}
+
+// PackageDatabase finds the installed packages owning files.
+type PackageDatabase interface {
+	// Name returns the package manager of the database, e.g. "dpkg"
+	Name() string
+	// Owner returns the package owning the file, if any
+	Owner(filePath string) (Package, bool)
+	// IsConfigFile checks if the file is a configuration file the administrator may have changed
+	IsConfigFile(filePath string) bool
+	// IsModified checks if the file differs from the packaged version.
+	// Files without a recorded checksum count as modified.
+	IsModified(filePath string) bool
+	// InstallCommand returns the shell command installing the given packages at their versions
+	InstallCommand(packages []Package) string
+	// ReadInstalledPackages reads the installed packages and their versions from a database file
+	// of the same package manager, e.g. the one of the base image
+	ReadInstalledPackages(reader io.Reader) (map[string]string, error)
+	// DatabaseFile returns the path of the database file listing the installed packages
+	DatabaseFile() string
+}
+
+// PackageReport lists the packages owning profiled files, the package-owned files that
+// were changed after installation, and the files no package owns.
+type PackageReport struct {
+	PackageManager string      `yaml:"packagemanager"`
+	Packages       []Package   `yaml:"packages"`
+	ModifiedPaths  []string    `yaml:"modified"`
+	UnownedPaths   []string    `yaml:"unowned"`
+	ConfigDrift    ConfigDrift `yaml:"-"`
+}
+
+// ConfigDrift lists the package configuration files changed by the administrator,
+// and those still matching the packaged version.
+type ConfigDrift struct {
+	Modified []ConfigFileState `yaml:"modified"`
+	Pristine []ConfigFileState `yaml:"pristine"`
+}
+
+// ConfigFileState is a package configuration file found among the profiled files.
+type ConfigFileState struct {
+	Path    string `yaml:"path"`
+	Package string `yaml:"package"`
+}
+
+// NewPackageDatabase loads the package database of the host distribution, given its os-release
+// ID and ID_LIKE IDs. Debian-based hosts use dpkg and Alpine uses apk; rpm is not supported yet.
+func NewPackageDatabase(distributions []string) (PackageDatabase, error) {
+	for _, distribution := range distributions {
+		switch distribution {
+		case "ubuntu", "debian":
+			return loadDpkgDatabase()
+		case "alpine":
+			return loadApkDatabase()
+		}
+	}
+	return nil, fmt.Errorf("no package database support for %q", strings.Join(distributions, " "))
+}
+
+// AttributePackages maps the profiled paths to their owning packages. Directories are expanded
+// into their files. Package-owned files are checked against the package checksums: files changed
+// after installation are listed as modified so they are still copied, next to the unowned files.
+func AttributePackages(filePaths []string, database PackageDatabase) PackageReport {
+	report := PackageReport{PackageManager: database.Name()}
+	packagesByName := make(map[string]*Package)
+
+	for _, filePath := range expandDirectories(filePaths) {
+		owner, owned := database.Owner(filePath)
+		if !owned {
+			report.UnownedPaths = append(report.UnownedPaths, filePath)
+			continue
+		}
+
+		modified := database.IsModified(filePath)
+		if modified {
+			report.ModifiedPaths = append(report.ModifiedPaths, filePath)
+		}
+		if database.IsConfigFile(filePath) {
+			state := ConfigFileState{Path: filePath, Package: owner.Name}
+			if modified {
+				report.ConfigDrift.Modified = append(report.ConfigDrift.Modified, state)
+			} else {
+				report.ConfigDrift.Pristine = append(report.ConfigDrift.Pristine, state)
+			}
+		}
+
+		known, found := packagesByName[owner.Name]
+		if !found {
+			known = &owner
+			packagesByName[owner.Name] = known
+		}
+		known.Files = append(known.Files, filePath)
+	}
+
+	for _, ownerPackage := range packagesByName {
+		report.Packages = append(report.Packages, *ownerPackage)
+	}
+	sort.Slice(report.Packages, func(i, j int) bool { return report.Packages[i].Name < report.Packages[j].Name })
+	sort.Strings(report.ModifiedPaths)
+	sort.Strings(report.UnownedPaths)
+	return report
+}
+
+// CopyPaths returns the files the package manager does not provide: the modified and the unowned files
+func (report PackageReport) CopyPaths() []string {
+	return append(append([]string{}, report.ModifiedPaths...), report.UnownedPaths...)
+}
+
+// InstallablePackages returns the packages to install explicitly, leaving out essential packages and
+// those the base image provides (basePackages maps their names to their versions). A base image
+// package keeps the base image's version, as pinning it to the host's version may be a downgrade
+// or a version the archive no longer has; the profiled files that differ from it are overrides.
+func (report PackageReport) InstallablePackages(basePackages map[string]string) []Package {
+	var packages []Package
+	for _, ownerPackage := range report.Packages {
+		if ownerPackage.Essential {
+			log.Debug("Skipping essential package", "package", ownerPackage.Name)
+			continue
+		}
+		if baseVersion, found := basePackages[ownerPackage.Name]; found {
+			if baseVersion != ownerPackage.Version {
+				log.Warn("Package is provided by the base image at another version, keeping the base image's", "package", ownerPackage.Name, "host", ownerPackage.Version, "base", baseVersion)
+			} else {
+				log.Debug("Skipping package provided by the base image", "package", ownerPackage.Name)
+			}
+			continue
+		}
+		packages = append(packages, ownerPackage)
+	}
+	return packages
+}
+
+// SavePackageReport writes the package attribution to a YAML file.
+func SavePackageReport(report PackageReport, reportPath string) error {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(reportPath, data, 0o644)
+}
+
+// SaveConfigDrift writes the modified and pristine configuration files to a YAML file.
+func SaveConfigDrift(drift ConfigDrift, reportPath string) error {
+	data, err := yaml.Marshal(drift)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(reportPath, data, 0o644)
+}
+
+// expandDirectories replaces directories with the files and symlinks below them
+func expandDirectories(filePaths []string) []string {
+	var expanded []string
+	for _, filePath := range filePaths {
+		fileInfo, err := os.Lstat(filePath)
+		if err != nil || !fileInfo.IsDir() {
+			expanded = append(expanded, filePath)
+			continue
+		}
+		filepath.WalkDir(filePath, func(path string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() {
+				expanded = append(expanded, path)
+			}
+			return nil
+		})
+	}
+	return expanded
+}
+
+// alternativePaths returns the spellings of a path a package may have listed it under:
+// merged-/usr systems reach /usr/bin through /bin (and the same for sbin and lib directories)
+func alternativePaths(filePath string) []string {
+	alternatives := []string{filePath}
+	for _, directory := range []string{"/bin/", "/sbin/", "/lib/", "/lib32/", "/lib64/", "/libx32/"} {
+		if strings.HasPrefix(filePath, directory) {
+			alternatives = append(alternatives, "/usr"+filePath)
+		}
+		if strings.HasPrefix(filePath, "/usr"+directory) {
+			alternatives = append(alternatives, strings.TrimPrefix(filePath, "/usr"))
+		}
+	}
+	if resolved, err := filepath.EvalSymlinks(filePath); err == nil && resolved != filePath {
+		alternatives = append(alternatives, resolved)
+	}
+	return alternatives
+}
+
+// fileChecksum returns the digest of a file's contents
+func fileChecksum(filePath string, digest hash.Hash) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(digest, file); err != nil {
+		return nil, err
+	}
+	return digest.Sum(nil), nil
+}
+
+// isSymlink checks if the path is a symbolic link; links are recreated by their package and have no checksum
+func isSymlink(filePath string) bool {
+	fileInfo, err := os.Lstat(filePath)
+	return err == nil && fileInfo.Mode()&os.ModeSymlink != 0
+}
+
+// dpkgDatabase reads the dpkg file lists, checksums and status database
+type dpkgDatabase struct {
+	owners      map[string]string  // File path to package key ("name" or "name:arch")
+	packages    map[string]Package // Package key to package
+	configFiles map[string]bool
+	checksums   map[string]string // File path to MD5 checksum, from the md5sums files and Conffiles
+}
+
+// Paths of the dpkg database
+const (
+	dpkgInfoDirectory = "/var/lib/dpkg/info"
+	dpkgStatusFile    = "/var/lib/dpkg/status"
+)
+
+// loadDpkgDatabase loads the installed packages and their file lists
+func loadDpkgDatabase() (*dpkgDatabase, error) {
+	database := newDpkgDatabase()
+	if err := readFile(dpkgStatusFile, database.readStatus); err != nil {
+		return nil, err
+	}
+	database.loadChecksums()
+
+	listFiles, err := filepath.Glob(filepath.Join(dpkgInfoDirectory, "*.list"))
+	if err != nil {
+		return nil, err
+	}
+	for _, listFile := range listFiles {
+		packageKey := strings.TrimSuffix(filepath.Base(listFile), ".list")
+		if err := readLines(listFile, func(line string) {
+			// Directories are shared between packages; only files decide ownership
+			if fileInfo, err := os.Lstat(line); err == nil && !fileInfo.IsDir() {
+				database.owners[line] = packageKey
+			}
+		}); err != nil {
+			log.Warn("Failed to read dpkg file list", "file", listFile, "error", err)
+		}
+	}
+	return database, nil
+}
+
+// loadChecksums reads the "<md5>  <path>" lines of the md5sums files. The paths are relative to "/".
+// Configuration files are not listed there; their checksums come from the status database.
+func (database *dpkgDatabase) loadChecksums() {
+	checksumFiles, _ := filepath.Glob(filepath.Join(dpkgInfoDirectory, "*.md5sums"))
+	for _, checksumFile := range checksumFiles {
+		if err := readLines(checksumFile, func(line string) {
+			if checksum, filePath, found := strings.Cut(line, "  "); found {
+				database.checksums["/"+filePath] = checksum
+			}
+		}); err != nil {
+			log.Warn("Failed to read dpkg checksums", "file", checksumFile, "error", err)
+		}
+	}
+}
+
+// newDpkgDatabase creates an empty dpkg database
+func newDpkgDatabase() *dpkgDatabase {
+	return &dpkgDatabase{
+		owners:      make(map[string]string),
+		packages:    make(map[string]Package),
+		configFiles: make(map[string]bool),
+		checksums:   make(map[string]string),
+	}
+}
+
+// readStatus reads the versions and configuration files of the installed packages from the status database
+func (database *dpkgDatabase) readStatus(reader io.Reader) error {
+	var current Package
+	var installed, inConffiles bool
+	finish := func() {
+		if installed && current.Name != "" {
+			database.packages[current.Name] = current
+			database.packages[current.Name+":"+current.Architecture] = current
+		}
+		current, installed, inConffiles = Package{}, false, false
+	}
+
+	err := scanLines(reader, func(line string) {
+		if line == "" {
+			finish()
+			return
+		}
+		if strings.HasPrefix(line, " ") {
+			// Continuation lines; those of Conffiles list " <path> <md5sum> [obsolete]"
+			if fields := strings.Fields(line); inConffiles && len(fields) >= 2 {
+				database.configFiles[fields[0]] = true
+				database.checksums[fields[0]] = fields[1]
+			}
+			return
+		}
+
+		key, value, _ := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		inConffiles = key == "Conffiles"
+		switch key {
+		case "Package":
+			current.Name = value
+		case "Version":
+			current.Version = value
+		case "Architecture":
+			current.Architecture = value
+		case "Essential":
+			current.Essential = value == "yes"
+		case "Status":
+			installed = strings.HasSuffix(value, " installed")
+		}
+	})
+	finish()
+	return err
+}
+
+// Name returns "dpkg"
+func (database *dpkgDatabase) Name() string {
+	return "dpkg"
+}
+
+// Owner returns the package whose file list contains the file
+func (database *dpkgDatabase) Owner(filePath string) (Package, bool) {
+	for _, candidate := range alternativePaths(filePath) {
+		if packageKey, found := database.owners[candidate]; found {
+			ownerPackage, known := database.packages[packageKey]
+			return ownerPackage, known
+		}
+	}
+	return Package{}, false
+}
+
+// IsConfigFile checks if the file is a conffile of a package
+func (database *dpkgDatabase) IsConfigFile(filePath string) bool {
+	return database.configFiles[filePath]
+}
+
+// IsModified compares the MD5 checksum of the file with the one recorded by dpkg
+func (database *dpkgDatabase) IsModified(filePath string) bool {
+	if isSymlink(filePath) {
+		return false
+	}
+	for _, candidate := range alternativePaths(filePath) {
+		if recorded, found := database.checksums[candidate]; found {
+			checksum, err := fileChecksum(filePath, md5.New())
+			return err != nil || hex.EncodeToString(checksum) != recorded
+		}
+	}
+	return true
+}
+
+// InstallCommand returns an apt-get command installing the packages at their versions.
+// apt-get refuses to replace a newer installed version unless downgrades are allowed explicitly.
+func (database *dpkgDatabase) InstallCommand(packages []Package) string {
+	var pinned []string
+	for _, ownerPackage := range packages {
+		pinned = append(pinned, fmt.Sprintf("%s=%s", ownerPackage.Name, ownerPackage.Version))
+	}
+	return "apt-get update && apt-get install -y --no-install-recommends --allow-downgrades " + strings.Join(pinned, " ") +
+		" && rm -rf /var/lib/apt/lists/*"
+}
+
+// ReadInstalledPackages reads the names and versions of the installed packages from a dpkg status database
+func (database *dpkgDatabase) ReadInstalledPackages(reader io.Reader) (map[string]string, error) {
+	statusDatabase := newDpkgDatabase()
+	if err := statusDatabase.readStatus(reader); err != nil {
+		return nil, err
+	}
+	versions := make(map[string]string)
+	for _, installedPackage := range statusDatabase.packages {
+		versions[installedPackage.Name] = installedPackage.Version
+	}
+	return versions, nil
+}
+
+// DatabaseFile returns the dpkg status database
+func (database *dpkgDatabase) DatabaseFile() string {
+	return dpkgStatusFile
+}
+
+// apkDatabase reads the apk installed database
+type apkDatabase struct {
+	owners    map[string]Package
+	versions  map[string]string // Package name to version
+	checksums map[string]string // File path to "Q1"-prefixed base64 SHA-1 checksum
+}
+
+// apkInstalledFile is the database of installed apk packages
+const apkInstalledFile = "/lib/apk/db/installed"
+
+// loadApkDatabase loads the installed packages and their files
+func loadApkDatabase() (*apkDatabase, error) {
+	database := newApkDatabase()
+	if err := readFile(apkInstalledFile, database.readInstalled); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// newApkDatabase creates an empty apk database
+func newApkDatabase() *apkDatabase {
+	return &apkDatabase{owners: make(map[string]Package), versions: make(map[string]string), checksums: make(map[string]string)}
+}
+
+// readInstalled reads the installed packages, their files and checksums from the installed database
+func (database *apkDatabase) readInstalled(reader io.Reader) error {
+	// Stanzas hold "P:" name, "V:" version, "A:" architecture, then "F:" directories each followed by
+	// "R:" files, each followed by its "Z:" checksum
+	var current Package
+	var files []string
+	var directory string
+	finish := func() {
+		if current.Name != "" {
+			database.versions[current.Name] = current.Version
+		}
+		for _, file := range files {
+			database.owners[file] = current
+		}
+		current, files, directory = Package{}, nil, ""
+	}
+
+	err := scanLines(reader, func(line string) {
+		if line == "" {
+			finish()
+			return
+		}
+		key, value, _ := strings.Cut(line, ":")
+		switch key {
+		case "P":
+			current.Name = value
+		case "V":
+			current.Version = value
+		case "A":
+			current.Architecture = value
+		case "F":
+			directory = value
+		case "R":
+			files = append(files, "/"+filepath.Join(directory, value))
+		case "Z":
+			if len(files) > 0 {
+				database.checksums[files[len(files)-1]] = value
+			}
+		}
+	})
+	finish()
+	return err
+}
+
+// Name returns "apk"
+func (database *apkDatabase) Name() string {
+	return "apk"
+}
+
+// Owner returns the package that installed the file
+func (database *apkDatabase) Owner(filePath string) (Package, bool) {
+	for _, candidate := range alternativePaths(filePath) {
+		if ownerPackage, found := database.owners[candidate]; found {
+			return ownerPackage, true
+		}
+	}
+	return Package{}, false
+}
+
+// IsConfigFile checks if the file is below /etc, which apk protects from being overwritten
+func (database *apkDatabase) IsConfigFile(filePath string) bool {
+	return strings.HasPrefix(filePath, "/etc/")
+}
+
+// IsModified compares the SHA-1 checksum of the file with the one recorded by apk
+func (database *apkDatabase) IsModified(filePath string) bool {
+	if isSymlink(filePath) {
+		return false
+	}
+	for _, candidate := range alternativePaths(filePath) {
+		if recorded, found := database.checksums[candidate]; found {
+			checksum, err := fileChecksum(filePath, sha1.New())
+			return err != nil || "Q1"+base64.StdEncoding.EncodeToString(checksum) != recorded
+		}
+	}
+	return true
+}
+
+// InstallCommand returns an apk command installing the packages at their versions
+func (database *apkDatabase) InstallCommand(packages []Package) string {
+	var pinned []string
+	for _, ownerPackage := range packages {
+		pinned = append(pinned, fmt.Sprintf("%s=%s", ownerPackage.Name, ownerPackage.Version))
+	}
+	return "apk add --no-cache " + strings.Join(pinned, " ")
+}
+
+// ReadInstalledPackages reads the names and versions of the installed packages from an apk installed database
+func (database *apkDatabase) ReadInstalledPackages(reader io.Reader) (map[string]string, error) {
+	installedDatabase := newApkDatabase()
+	if err := installedDatabase.readInstalled(reader); err != nil {
+		return nil, err
+	}
+	return installedDatabase.versions, nil
+}
+
+// DatabaseFile returns the apk installed database
+func (database *apkDatabase) DatabaseFile() string {
+	return apkInstalledFile
+}
+
+// readLines calls handleLine for every line of a file
+func readLines(filePath string, handleLine func(line string)) error {
+	return readFile(filePath, func(reader io.Reader) error {
+		return scanLines(reader, handleLine)
+	})
+}
+
+// readFile opens a file and passes it to read
+func readFile(filePath string, read func(reader io.Reader) error) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return read(file)
+}
+
+// scanLines calls handleLine for every line read from the reader
+func scanLines(reader io.Reader, handleLine func(line string)) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		handleLine(scanner.Text())
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,166 @@
+package dockerizer
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tarballEntry is an entry of a test tarball; the size of regular files is taken from the content
+type tarballEntry struct {
+	header  tar.Header
+	content string
+}
+
+// writeTarball writes an uncompressed tarball with the given entries, like "docker export" does
+func writeTarball(t *testing.T, entries []tarballEntry) string {
+	t.Helper()
+	tarballPath := filepath.Join(t.TempDir(), "rootfs.tar")
+	file, err := os.Create(tarballPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tarWriter := tar.NewWriter(file)
+	for _, entry := range entries {
+		header := entry.header
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(entry.content))
+		}
+		if err := tarWriter.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tarballPath
+}
+
+func TestDpkgReadStatus(t *testing.T) {
+	database := newDpkgDatabase()
+	if err := readFile("testdata/packages/dpkg_status", database.readStatus); err != nil {
+		t.Fatal(err)
+	}
+
+	// Installed packages are known by name and by name and architecture, as in the .list file names
+	nginxCommon := Package{Name: "nginx-common", Version: "1.22.1-9", Architecture: "all"}
+	libc := Package{Name: "libc6", Version: "2.36-9+deb12u4", Architecture: "amd64"}
+	dash := Package{Name: "dash", Version: "0.5.12-2", Architecture: "amd64", Essential: true}
+	wantPackages := map[string]Package{
+		"nginx-common": nginxCommon, "nginx-common:all": nginxCommon,
+		"libc6": libc, "libc6:amd64": libc,
+		"dash": dash, "dash:amd64": dash,
+	}
+	if !reflect.DeepEqual(database.packages, wantPackages) {
+		t.Errorf("packages = %v, want %v", database.packages, wantPackages)
+	}
+
+	// Conffiles are configuration files with their packaged checksum, also when obsolete
+	wantConfigFiles := map[string]bool{"/etc/nginx/nginx.conf": true, "/etc/nginx/win-utf": true}
+	if !reflect.DeepEqual(database.configFiles, wantConfigFiles) {
+		t.Errorf("configFiles = %v, want %v", database.configFiles, wantConfigFiles)
+	}
+	wantChecksums := map[string]string{
+		"/etc/nginx/nginx.conf": "5a1b6e2c1b1b0f6e4a7c3d0e9f8a7b6c",
+		"/etc/nginx/win-utf":    "7a5d4e1f0b9c8d7e6f5a4b3c2d1e0f9a",
+	}
+	if !reflect.DeepEqual(database.checksums, wantChecksums) {
+		t.Errorf("checksums = %v, want %v", database.checksums, wantChecksums)
+	}
+}
+
+func TestApkReadInstalled(t *testing.T) {
+	database := newApkDatabase()
+	if err := readFile("testdata/packages/apk_installed", database.readInstalled); err != nil {
+		t.Fatal(err)
+	}
+
+	musl := Package{Name: "musl", Version: "1.2.4-r2", Architecture: "x86_64"}
+	nginx := Package{Name: "nginx", Version: "1.24.0-r7", Architecture: "x86_64"}
+	wantOwners := map[string]Package{
+		"/lib/ld-musl-x86_64.so.1":   musl,
+		"/lib/libc.musl-x86_64.so.1": musl,
+		"/etc/nginx/nginx.conf":      nginx,
+		"/usr/sbin/nginx":            nginx,
+	}
+	if !reflect.DeepEqual(database.owners, wantOwners) {
+		t.Errorf("owners = %v, want %v", database.owners, wantOwners)
+	}
+
+	// Every "Z:" checksum belongs to the "R:" file before it, in the "F:" directory before that
+	wantChecksums := map[string]string{
+		"/lib/ld-musl-x86_64.so.1":   "Q1pELvbYSyVEGBzYBkuVJW3ePa8lU=",
+		"/lib/libc.musl-x86_64.so.1": "Q17yJ3JFNypA4mxhJJr0ou6CzsJVI=",
+		"/etc/nginx/nginx.conf":      "Q1RGFyx0MUO3BAqLnqzE40MzNx5Xw=",
+		"/usr/sbin/nginx":            "Q1fMlf2F3b0nJJGvwV5aWFAbQ0bcE=",
+	}
+	if !reflect.DeepEqual(database.checksums, wantChecksums) {
+		t.Errorf("checksums = %v, want %v", database.checksums, wantChecksums)
+	}
+
+	// Packages without files are installed as well
+	wantVersions := map[string]string{"musl": "1.2.4-r2", "nginx": "1.24.0-r7", "alpine-base": "3.18.4-r0"}
+	if !reflect.DeepEqual(database.versions, wantVersions) {
+		t.Errorf("versions = %v, want %v", database.versions, wantVersions)
+	}
+}
+
+func TestInstallablePackagesLeavesOutBasePackages(t *testing.T) {
+	status, err := os.ReadFile("testdata/packages/dpkg_status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The base image has a newer libc6 than the host
+	baseStatus := strings.Replace(string(status), "Version: 2.36-9+deb12u4", "Version: 2.36-9+deb12u7", 1)
+	base, err := LoadBaseRootfs(writeTarball(t, []tarballEntry{
+		{header: tar.Header{Name: "var/lib/dpkg/", Typeflag: tar.TypeDir, Mode: 0o755}},
+		{header: tar.Header{Name: "var/lib/dpkg/status", Typeflag: tar.TypeReg, Mode: 0o644}, content: baseStatus},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	database := newDpkgDatabase()
+	basePackages, err := base.InstalledPackages(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBasePackages := map[string]string{"nginx-common": "1.22.1-9", "libc6": "2.36-9+deb12u7", "dash": "0.5.12-2"}
+	if !reflect.DeepEqual(basePackages, wantBasePackages) {
+		t.Errorf("InstalledPackages() = %v, want %v", basePackages, wantBasePackages)
+	}
+
+	report := PackageReport{Packages: []Package{
+		{Name: "dash", Version: "0.5.12-2", Essential: true},
+		{Name: "libc6", Version: "2.36-9+deb12u4"},
+		{Name: "nginx", Version: "1.22.1-9"},
+	}}
+	wantInstalled := []Package{{Name: "nginx", Version: "1.22.1-9"}}
+	if installed := report.InstallablePackages(basePackages); !reflect.DeepEqual(installed, wantInstalled) {
+		t.Errorf("InstallablePackages() = %v, want %v", installed, wantInstalled)
+	}
+
+	// Without the base image, only essential packages are left out, and downgrades are allowed
+	installed := report.InstallablePackages(nil)
+	wantCommand := "apt-get update && apt-get install -y --no-install-recommends --allow-downgrades libc6=2.36-9+deb12u4 nginx=1.22.1-9 && rm -rf /var/lib/apt/lists/*"
+	if command := database.InstallCommand(installed); command != wantCommand {
+		t.Errorf("InstallCommand() = %q, want %q", command, wantCommand)
+	}
+
+	// A base image without a dpkg database is reported
+	emptyBase, err := LoadBaseRootfs(writeTarball(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := emptyBase.InstalledPackages(database); err == nil {
+		t.Error("InstalledPackages() of a base image without a dpkg database succeeded")
+	}
+}
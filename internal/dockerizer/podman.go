@@ -0,0 +1,299 @@
+package dockerizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"application_profiling/internal/profiler"
+
+	"github.com/charmbracelet/log"
+)
+
+// defaultRestartPolicy is the restart policy of applications not run by a systemd service
+const defaultRestartPolicy = "on-failure"
+
+// podmanContainer holds the settings shared by the Quadlet file and the "podman run" unit.
+type podmanContainer struct {
+	Name        string
+	Image       string
+	Ports       []string // e.g. "8080:8080/tcp"
+	Volumes     []string // e.g. "nginx-var-log-nginx:/var/log/nginx"
+	Environment []string
+	User        string
+	Group       string
+	HealthFlags [][2]string // Podman healthcheck flags without "--", with their values
+	Ulimits     []string    // e.g. "nofile=1024:4096"
+	PidsLimit   string
+	Memory      string
+	CPUs        string
+	Service     []string // [Service] settings of the unit, e.g. "Restart=on-failure"
+}
+
+// GeneratePodmanUnits writes a Podman Quadlet file (<name>.container) and an equivalent systemd unit
+// running "podman run" (container-<name>.service, for hosts without Quadlet) to the output directory.
+// The container publishes the listening ports, mounts the state directories as named volumes and
+// runs with the environment, user and healthcheck of the Dockerfile. The restart policy and the
+// resource limits are taken from the systemd unit of the source process, if any.
+// It returns the paths of the written files.
+func GeneratePodmanUnits(info *profiler.ProcessInfo, data DockerfileData, image, outputDirectory string) ([]string, error) {
+	container := buildPodmanContainer(info, data, image)
+	quadletPath := filepath.Join(outputDirectory, container.Name+".container")
+	servicePath := filepath.Join(outputDirectory, "container-"+container.Name+".service")
+
+	if err := os.WriteFile(quadletPath, []byte(container.quadlet()), 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(servicePath, []byte(container.serviceUnit()), 0o644); err != nil {
+		return nil, err
+	}
+	return []string{quadletPath, servicePath}, nil
+}
+
+// buildPodmanContainer collects the container settings from the Dockerfile data and the systemd unit
+func buildPodmanContainer(info *profiler.ProcessInfo, data DockerfileData, image string) podmanContainer {
+	container := podmanContainer{
+		Name:        objectName(serviceName(info), ""),
+		Image:       image,
+		Environment: data.EnvironmentVariables,
+	}
+	container.User, container.Group, _ = strings.Cut(data.UserAndGroup, ":")
+
+	for _, port := range data.TCPPorts {
+		container.Ports = append(container.Ports, fmt.Sprintf("%d:%d/tcp", port, port))
+	}
+	for _, port := range data.UDPPorts {
+		container.Ports = append(container.Ports, fmt.Sprintf("%d:%d/udp", port, port))
+	}
+	for _, volume := range data.Volumes {
+		container.Volumes = append(container.Volumes, container.Name+"-"+volumeSuffix(volume)+":"+volume)
+	}
+
+	// The Dockerfile leaves out the healthcheck if the image has no shell to run it
+	if data.Healthcheck != "" {
+		healthcheck := data.Adapter.Healthcheck
+		container.HealthFlags = append(container.HealthFlags, [2]string{"health-cmd", data.Adapter.HealthcheckCommand(data.TCPPorts)})
+		for _, flag := range [][2]string{
+			{"health-interval", healthcheck.Interval},
+			{"health-timeout", healthcheck.Timeout},
+			{"health-start-period", healthcheck.StartPeriod},
+		} {
+			if flag[1] != "" {
+				container.HealthFlags = append(container.HealthFlags, flag)
+			}
+		}
+		if healthcheck.Retries > 0 {
+			container.HealthFlags = append(container.HealthFlags, [2]string{"health-retries", strconv.Itoa(healthcheck.Retries)})
+		}
+	}
+
+	// Map the restart policy and the limits of the systemd unit
+	unit := info.SystemdUnit
+	if unit == nil {
+		unit = &profiler.SystemdUnit{}
+	}
+	restart := unit.Restart
+	if restart == "" {
+		restart = defaultRestartPolicy
+	}
+	container.Service = append(container.Service, "Restart="+restart)
+	if unit.RestartSec != "" {
+		container.Service = append(container.Service, "RestartSec="+unit.RestartSec)
+	}
+	if unit.TimeoutStopSec != "" {
+		container.Service = append(container.Service, "TimeoutStopSec="+unit.TimeoutStopSec)
+	}
+	if unit.LimitNOFILE != "" {
+		container.Ulimits = append(container.Ulimits, "nofile="+podmanUlimit(unit.LimitNOFILE))
+	}
+	if unit.LimitNPROC != "" {
+		container.Ulimits = append(container.Ulimits, "nproc="+podmanUlimit(unit.LimitNPROC))
+	}
+	if _, err := strconv.Atoi(unit.TasksMax); err == nil {
+		container.PidsLimit = unit.TasksMax
+	} else if unit.TasksMax != "" && unit.TasksMax != "infinity" {
+		log.Warn("Skipping task limit that Podman cannot express", "tasksmax", unit.TasksMax)
+	}
+	if memory, ok := podmanMemory(unit.MemoryMax); ok {
+		container.Memory = memory
+	} else if unit.MemoryMax != "" && unit.MemoryMax != "infinity" {
+		log.Warn("Skipping memory limit that Podman cannot express", "memorymax", unit.MemoryMax)
+	}
+	if cpus, ok := podmanCPUs(unit.CPUQuota); ok {
+		container.CPUs = cpus
+	} else if unit.CPUQuota != "" {
+		log.Warn("Skipping CPU quota that Podman cannot express", "cpuquota", unit.CPUQuota)
+	}
+	return container
+}
+
+// quadlet renders the Quadlet .container file
+func (container podmanContainer) quadlet() string {
+	var lines []string
+	lines = append(lines, container.unitSection()...)
+	lines = append(lines, "", "[Container]", "Image="+container.Image, "ContainerName="+container.Name)
+	for _, port := range container.Ports {
+		lines = append(lines, "PublishPort="+port)
+	}
+	for _, volume := range container.Volumes {
+		lines = append(lines, "Volume="+volume)
+	}
+	for _, variable := range container.Environment {
+		lines = append(lines, "Environment="+profiler.QuoteUnitWord(variable))
+	}
+	if container.User != "" {
+		lines = append(lines, "User="+container.User)
+	}
+	if container.Group != "" {
+		lines = append(lines, "Group="+container.Group)
+	}
+	quadletKeys := map[string]string{
+		"health-cmd": "HealthCmd", "health-interval": "HealthInterval", "health-timeout": "HealthTimeout",
+		"health-start-period": "HealthStartPeriod", "health-retries": "HealthRetries",
+	}
+	for _, flag := range container.HealthFlags {
+		lines = append(lines, quadletKeys[flag[0]]+"="+strings.ReplaceAll(flag[1], "%", "%%"))
+	}
+	for _, ulimit := range container.Ulimits {
+		lines = append(lines, "Ulimit="+ulimit)
+	}
+	if container.PidsLimit != "" {
+		lines = append(lines, "PidsLimit="+container.PidsLimit)
+	}
+
+	// Quadlet has no keys for the memory and CPU limits of the container
+	var podmanArguments []string
+	if container.Memory != "" {
+		podmanArguments = append(podmanArguments, "--memory="+container.Memory)
+	}
+	if container.CPUs != "" {
+		podmanArguments = append(podmanArguments, "--cpus="+container.CPUs)
+	}
+	if len(podmanArguments) > 0 {
+		lines = append(lines, "PodmanArgs="+strings.Join(podmanArguments, " "))
+	}
+
+	lines = append(lines, "", "[Service]")
+	lines = append(lines, container.Service...)
+	lines = append(lines, "", "[Install]", "WantedBy=multi-user.target default.target")
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// serviceUnit renders a systemd unit that runs the container with "podman run", like "podman generate systemd --new"
+func (container podmanContainer) serviceUnit() string {
+	arguments := []string{"--name", container.Name}
+	for _, port := range container.Ports {
+		arguments = append(arguments, "--publish", port)
+	}
+	for _, volume := range container.Volumes {
+		arguments = append(arguments, "--volume", volume)
+	}
+	for _, variable := range container.Environment {
+		arguments = append(arguments, "--env", variable)
+	}
+	if container.User != "" {
+		user := container.User
+		if container.Group != "" {
+			user += ":" + container.Group
+		}
+		arguments = append(arguments, "--user", user)
+	}
+	for _, flag := range container.HealthFlags {
+		arguments = append(arguments, "--"+flag[0], flag[1])
+	}
+	for _, ulimit := range container.Ulimits {
+		arguments = append(arguments, "--ulimit", ulimit)
+	}
+	if container.PidsLimit != "" {
+		arguments = append(arguments, "--pids-limit", container.PidsLimit)
+	}
+	if container.Memory != "" {
+		arguments = append(arguments, "--memory", container.Memory)
+	}
+	if container.CPUs != "" {
+		arguments = append(arguments, "--cpus", container.CPUs)
+	}
+
+	// The fixed arguments use unit specifiers, so they are not quoted
+	execStart := "ExecStart=/usr/bin/podman run --cidfile=%t/%n.ctr-id --cgroups=no-conmon --rm --sdnotify=conmon --replace -d"
+	for index := 0; index < len(arguments); index++ {
+		word := profiler.QuoteUnitWord(arguments[index])
+		if strings.HasPrefix(arguments[index], "--") && index+1 < len(arguments) {
+			index++
+			word += " " + profiler.QuoteUnitWord(arguments[index])
+		}
+		execStart += " \\\n\t" + word
+	}
+	execStart += " \\\n\t" + profiler.QuoteUnitWord(container.Image)
+
+	lines := container.unitSection()
+	lines = append(lines, "RequiresMountsFor=%t/containers", "", "[Service]", "Environment=PODMAN_SYSTEMD_UNIT=%n")
+	lines = append(lines, container.Service...)
+	lines = append(lines,
+		execStart,
+		"ExecStop=/usr/bin/podman stop --ignore -t 10 --cidfile=%t/%n.ctr-id",
+		"ExecStopPost=/usr/bin/podman rm -f --ignore -t 10 --cidfile=%t/%n.ctr-id",
+		"Type=notify",
+		"NotifyAccess=all",
+		"", "[Install]", "WantedBy=multi-user.target default.target")
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// unitSection renders the [Unit] section shared by both files
+func (container podmanContainer) unitSection() []string {
+	return []string{
+		"[Unit]",
+		"Description=" + container.Name + " container, migrated by vm2container",
+		"Wants=network-online.target",
+		"After=network-online.target",
+	}
+}
+
+// podmanUlimit converts a systemd resource limit ("soft:hard", a single value or "infinity") to a Podman ulimit value
+func podmanUlimit(limit string) string {
+	soft, hard, found := strings.Cut(limit, ":")
+	if !found {
+		hard = soft
+	}
+	if soft == "infinity" {
+		soft = "-1"
+	}
+	if hard == "infinity" {
+		hard = "-1"
+	}
+	return soft + ":" + hard
+}
+
+// podmanMemory converts a systemd memory size (bytes with an optional K, M, G or T suffix) to a Podman memory limit
+func podmanMemory(size string) (string, bool) {
+	if size == "" {
+		return "", false
+	}
+	number, suffix := size, ""
+	if last := size[len(size)-1]; strings.ContainsRune("KMGT", rune(last)) {
+		number, suffix = size[:len(size)-1], string(last)
+	}
+	value, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	if suffix == "T" {
+		// Podman has no terabyte unit
+		return strconv.FormatUint(value*1024, 10) + "g", true
+	}
+	if suffix == "" {
+		return number, true
+	}
+	return number + strings.ToLower(suffix), true
+}
+
+// podmanCPUs converts a systemd CPU quota (e.g. "150%") to a number of CPUs (e.g. "1.5")
+func podmanCPUs(quota string) (string, bool) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(quota, "%"), 64)
+	if err != nil || !strings.HasSuffix(quota, "%") || percent <= 0 {
+		return "", false
+	}
+	return strconv.FormatFloat(percent/100, 'f', -1, 64), true
+}
@@ -0,0 +1,98 @@
+package dockerizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPodmanUlimit(t *testing.T) {
+	tests := []struct {
+		limit string
+		want  string
+	}{
+		{limit: "1024", want: "1024:1024"},
+		{limit: "1024:4096", want: "1024:4096"},
+		{limit: "infinity", want: "-1:-1"},
+		{limit: "1024:infinity", want: "1024:-1"},
+	}
+
+	for _, test := range tests {
+		if got := podmanUlimit(test.limit); got != test.want {
+			t.Errorf("podmanUlimit(%q) = %q, want %q", test.limit, got, test.want)
+		}
+	}
+}
+
+func TestPodmanMemory(t *testing.T) {
+	tests := []struct {
+		size   string
+		want   string
+		wantOK bool
+	}{
+		{size: "1073741824", want: "1073741824", wantOK: true},
+		{size: "512K", want: "512k", wantOK: true},
+		{size: "512M", want: "512m", wantOK: true},
+		{size: "2G", want: "2g", wantOK: true},
+		{size: "2T", want: "2048g", wantOK: true},
+		{size: ""},
+		{size: "infinity"},
+		{size: "50%"},
+		{size: "1.5G"},
+		{size: "G"},
+	}
+
+	for _, test := range tests {
+		got, ok := podmanMemory(test.size)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("podmanMemory(%q) = %q, %v, want %q, %v", test.size, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestPodmanCPUs(t *testing.T) {
+	tests := []struct {
+		quota  string
+		want   string
+		wantOK bool
+	}{
+		{quota: "150%", want: "1.5", wantOK: true},
+		{quota: "50%", want: "0.5", wantOK: true},
+		{quota: "200%", want: "2", wantOK: true},
+		{quota: "0%"},
+		{quota: "150"},
+		{quota: "abc%"},
+		{quota: ""},
+	}
+
+	for _, test := range tests {
+		got, ok := podmanCPUs(test.quota)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("podmanCPUs(%q) = %q, %v, want %q, %v", test.quota, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestPodmanSpecifierEscaping(t *testing.T) {
+	container := podmanContainer{
+		Name:        "app",
+		Image:       "localhost/app:latest",
+		Environment: []string{"PROMPT=100%", "FORMAT=%h %s"},
+		HealthFlags: [][2]string{{"health-cmd", "test -f /run/app-%i.pid"}},
+	}
+
+	// Values are escaped for systemd, which would otherwise expand "%" specifiers
+	quadlet := container.quadlet()
+	for _, line := range []string{"Environment=PROMPT=100%%", `Environment="FORMAT=%%h %%s"`, "HealthCmd=test -f /run/app-%%i.pid"} {
+		if !strings.Contains(quadlet, line+"\n") {
+			t.Errorf("quadlet() is missing %q:\n%s", line, quadlet)
+		}
+	}
+
+	// The fixed arguments keep their specifiers
+	serviceUnit := container.serviceUnit()
+	for _, word := range []string{"--cidfile=%t/%n.ctr-id", "--env PROMPT=100%%", `--env "FORMAT=%%h %%s"`, `--health-cmd "test -f /run/app-%%i.pid"`} {
+		if !strings.Contains(serviceUnit, word) {
+			t.Errorf("serviceUnit() is missing %q:\n%s", word, serviceUnit)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package dockerizer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"application_profiling/internal/profiler"
+
+	"github.com/charmbracelet/log"
+)
+
+// ScratchImage is the base image name that selects a self-contained root filesystem
+const ScratchImage = "scratch"
+
+// Host account databases the minimal copies are taken from
+const (
+	hostPasswdFile = "/etc/passwd"
+	hostGroupFile  = "/etc/group"
+)
+
+// scratchNsswitch resolves users, groups and hosts from files only, as no NSS modules are copied
+const scratchNsswitch = `passwd:         files
+group:          files
+shadow:         files
+hosts:          files dns
+networks:       files
+protocols:      files
+services:       files
+`
+
+// ScratchFilePaths returns the files an image without a base OS needs besides the profiled ones:
+// a shell and the executables of the pre-start steps of a systemd service, which run from the
+// entrypoint script. Their libraries are added by the shared library resolution.
+func ScratchFilePaths(info *profiler.ProcessInfo) []string {
+	if info.SystemdUnit == nil || len(info.SystemdUnit.ExecStartPre) == 0 {
+		return nil
+	}
+
+	filePaths := []string{"/bin/sh"}
+	for _, commandLine := range info.SystemdUnit.ExecStartPre {
+		if _, arguments := profiler.ParseExecCommand(commandLine); len(arguments) > 0 && filepath.IsAbs(arguments[0]) {
+			filePaths = append(filePaths, arguments[0])
+		}
+	}
+	return filePaths
+}
+
+// mergedDirectories are the top-level directories that merged-/usr systems link into /usr
+var mergedDirectories = []string{"/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32"}
+
+// CreateScratchLayout recreates the top-level symlinks of merged-/usr hosts (e.g. /lib -> usr/lib)
+// in the empty profile directory, before files are copied. Paths like /lib/x86_64-linux-gnu/libc.so.6
+// used by the dynamic linker then resolve to the copied files below /usr, as they do on the host.
+func CreateScratchLayout(profileDirectory string) error {
+	for _, directory := range mergedDirectories {
+		linkTarget, err := os.Readlink(directory)
+		if err != nil {
+			continue
+		}
+		// Keep the link inside the root filesystem
+		linkTarget = strings.TrimPrefix(linkTarget, "/")
+		if err := os.MkdirAll(filepath.Join(profileDirectory, filepath.Dir(directory), linkTarget), 0o755); err != nil {
+			return err
+		}
+		if err := os.Symlink(linkTarget, filepath.Join(profileDirectory, directory)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrepareScratchRootfs completes the profile directory into a root filesystem that runs without
+// a base image: minimal passwd and group files with only root and the accounts of the application,
+// an nsswitch.conf that only uses files, and a world-writable /tmp.
+func PrepareScratchRootfs(info *profiler.ProcessInfo, profileDirectory string) error {
+	users := []string{"root", info.ProcessUser}
+	groups := []string{"root", info.ProcessGroup}
+	if info.SystemdUnit != nil {
+		users = append(users, info.SystemdUnit.User)
+		groups = append(groups, info.SystemdUnit.Group)
+	}
+
+	etcDirectory := filepath.Join(profileDirectory, "etc")
+	if err := os.MkdirAll(etcDirectory, 0o755); err != nil {
+		return err
+	}
+	if err := writeAccountEntries(hostPasswdFile, filepath.Join(etcDirectory, "passwd"), users); err != nil {
+		return err
+	}
+	if err := writeAccountEntries(hostGroupFile, filepath.Join(etcDirectory, "group"), groups); err != nil {
+		return err
+	}
+	if err := replaceFile(filepath.Join(etcDirectory, "nsswitch.conf"), []byte(scratchNsswitch)); err != nil {
+		return err
+	}
+
+	tmpDirectory := filepath.Join(profileDirectory, "tmp")
+	if err := os.MkdirAll(tmpDirectory, 0o755); err != nil {
+		return err
+	}
+	return os.Chmod(tmpDirectory, os.ModeSticky|0o777)
+}
+
+// writeAccountEntries copies the lines of the named accounts from a passwd or group file
+func writeAccountEntries(sourcePath, destinationPath string, names []string) error {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		if name != "" {
+			wanted[name] = true
+		}
+	}
+
+	var entries []string
+	if err := readLines(sourcePath, func(line string) {
+		if name, _, found := strings.Cut(line, ":"); found && wanted[name] {
+			entries = append(entries, line)
+			delete(wanted, name)
+		}
+	}); err != nil {
+		return err
+	}
+	for name := range wanted {
+		log.Warn("Account not found on the host", "name", name, "file", sourcePath)
+	}
+	return replaceFile(destinationPath, []byte(strings.Join(entries, "\n")+"\n"))
+}
+
+// replaceFile writes a file in place of a copied file or symlink
+func replaceFile(filePath string, data []byte) error {
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0o644)
+}
@@ -0,0 +1,223 @@
+package dockerizer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"application_profiling/internal/profiler"
+
+	"github.com/charmbracelet/log"
+)
+
+// entrypointScriptName is the file name of the script running the ExecStartPre steps
+const entrypointScriptName = "vm2container-entrypoint.sh"
+
+// variableReference matches "${NAME}" references in ExecStart arguments
+var variableReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// variableWord matches an argument that is a bare "$NAME" reference
+var variableWord = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// unitStartup describes how the container starts a systemd service.
+type unitStartup struct {
+	Command          []string // CMD, from the main ExecStart
+	Environment      []string // ENV, from Environment= and EnvironmentFile=
+	StopSignal       string   // STOPSIGNAL, from KillSignal=
+	UserAndGroup     string   // USER, from User= and Group=
+	WorkingDirectory string   // WORKDIR, from WorkingDirectory=
+	PreStartCommands []string // Shell lines of the entrypoint script, from ExecStartPre=
+}
+
+// buildUnitStartup derives the container start from the unit settings.
+// Settings the unit leaves out fall back to what was observed on the running process.
+func buildUnitStartup(info *profiler.ProcessInfo) unitStartup {
+	unit := info.SystemdUnit
+	startup := unitStartup{
+		Environment:      unitEnvironment(unit),
+		StopSignal:       stopSignal(unit.KillSignal),
+		UserAndGroup:     fmt.Sprintf("%s:%s", info.ProcessUser, info.ProcessGroup),
+		WorkingDirectory: info.WorkingDirectory,
+	}
+
+	// The container runs the main command; variables are expanded like systemd does
+	if len(unit.ExecStart) > 0 {
+		_, arguments := profiler.ParseExecCommand(unit.ExecStart[0])
+		startup.Command = expandUnitVariables(arguments, startup.Environment)
+	}
+
+	// The unit may only set the user, which then runs with its primary group
+	if unit.User != "" {
+		startup.UserAndGroup = unit.User
+		if unit.Group != "" {
+			startup.UserAndGroup += ":" + unit.Group
+		}
+	}
+
+	// A "-" prefix ignores a missing directory, "~" means the home directory of the user
+	if workingDirectory := strings.TrimPrefix(unit.WorkingDirectory, "-"); strings.HasPrefix(workingDirectory, "/") {
+		startup.WorkingDirectory = workingDirectory
+	}
+
+	for _, commandLine := range unit.ExecStartPre {
+		startup.PreStartCommands = append(startup.PreStartCommands, preStartCommand(unit.Name, commandLine, startup.Environment))
+	}
+	return startup
+}
+
+// unitEnvironment collects the variables of the unit. As in systemd, variables from
+// environment files override those set with Environment=.
+func unitEnvironment(unit *profiler.SystemdUnit) []string {
+	variables := append([]string{}, unit.Environment...)
+	for _, environmentFile := range unit.EnvironmentFiles {
+		optional := strings.HasPrefix(environmentFile, "-")
+		environmentFile = strings.TrimPrefix(environmentFile, "-")
+
+		fileVariables, err := readEnvironmentFile(environmentFile)
+		if errors.Is(err, os.ErrNotExist) && optional {
+			continue
+		}
+		if err != nil {
+			log.Error("Failed to read environment file", "file", environmentFile, "error", err)
+			continue
+		}
+		variables = append(variables, fileVariables...)
+	}
+	return deduplicateVariables(variables)
+}
+
+// readEnvironmentFile reads KEY=value lines from a systemd environment file.
+// Comments start with "#" or ";", and values may be quoted.
+func readEnvironmentFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var variables []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if isQuoted(value) {
+			value = strings.Join(profiler.SplitUnitWords(value), " ")
+		}
+		variables = append(variables, strings.TrimSpace(key)+"="+value)
+	}
+	return variables, scanner.Err()
+}
+
+// isQuoted checks if a value is enclosed in matching single or double quotes
+func isQuoted(value string) bool {
+	return len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0]
+}
+
+// deduplicateVariables keeps the last assignment of every variable, in first-seen order
+func deduplicateVariables(variables []string) []string {
+	lastValues := make(map[string]string)
+	var keys []string
+	for _, variable := range variables {
+		key, value, _ := strings.Cut(variable, "=")
+		if _, found := lastValues[key]; !found {
+			keys = append(keys, key)
+		}
+		lastValues[key] = value
+	}
+
+	deduplicated := make([]string, 0, len(keys))
+	for _, key := range keys {
+		deduplicated = append(deduplicated, key+"="+lastValues[key])
+	}
+	return deduplicated
+}
+
+// expandUnitVariables expands variable references in Exec*= arguments: "${NAME}" is
+// replaced within a word, and a bare "$NAME" word is split into words at whitespace
+func expandUnitVariables(arguments, environment []string) []string {
+	values := make(map[string]string)
+	for _, variable := range environment {
+		key, value, _ := strings.Cut(variable, "=")
+		values[key] = value
+	}
+
+	var expanded []string
+	for _, argument := range arguments {
+		if match := variableWord.FindStringSubmatch(argument); match != nil {
+			expanded = append(expanded, strings.Fields(values[match[1]])...)
+			continue
+		}
+		argument = variableReference.ReplaceAllStringFunc(argument, func(reference string) string {
+			return values[variableReference.FindStringSubmatch(reference)[1]]
+		})
+		expanded = append(expanded, strings.ReplaceAll(argument, "$$", "$"))
+	}
+	return expanded
+}
+
+// preStartCommand converts an ExecStartPre= line into a shell line of the entrypoint script
+func preStartCommand(unitName, commandLine string, environment []string) string {
+	prefixes, arguments := profiler.ParseExecCommand(commandLine)
+	if strings.ContainsAny(prefixes, "+!") {
+		log.Warn("ExecStartPre step runs with elevated privileges in the unit, but as USER in the container", "unit", unitName, "command", commandLine)
+	}
+
+	quoted := make([]string, 0, len(arguments))
+	for _, argument := range expandUnitVariables(arguments, environment) {
+		quoted = append(quoted, shellQuote(argument))
+	}
+	shellLine := strings.Join(quoted, " ")
+
+	// A "-" prefix ignores failures of the step
+	if strings.Contains(prefixes, "-") {
+		shellLine += " || true"
+	}
+	return shellLine
+}
+
+// writeEntrypointScript writes the script that runs the ExecStartPre steps and then execs the CMD
+func writeEntrypointScript(unitName string, commands []string, scriptPath string) error {
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n")
+	script.WriteString(fmt.Sprintf("# Runs the ExecStartPre= steps of %s before the application\n", unitName))
+	script.WriteString("set -e\n")
+	for _, command := range commands {
+		script.WriteString(command + "\n")
+	}
+	script.WriteString("exec \"$@\"\n")
+	return os.WriteFile(scriptPath, []byte(script.String()), 0o755)
+}
+
+// stopSignal converts a KillSignal= value into a STOPSIGNAL value.
+// SIGTERM is Docker's default and is left out.
+func stopSignal(killSignal string) string {
+	if killSignal == "" {
+		return ""
+	}
+	signal := strings.ToUpper(killSignal)
+	if !strings.HasPrefix(signal, "SIG") && strings.Trim(signal, "0123456789") != "" {
+		signal = "SIG" + signal
+	}
+	if signal == "SIGTERM" || signal == "15" {
+		return ""
+	}
+	return signal
+}
+
+// shellQuote quotes a word for a POSIX shell unless it only contains safe characters
+func shellQuote(word string) string {
+	if word != "" && strings.Trim(word, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789/._-=:,+@%") == "" {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
@@ -0,0 +1,49 @@
+package dockerizer
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"application_profiling/internal/adapter"
+	"application_profiling/internal/profiler"
+)
+
+func TestUnitEnvironment(t *testing.T) {
+	environmentFile, err := filepath.Abs("testdata/app.env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit := &profiler.SystemdUnit{
+		Environment:      []string{"APP_MODE=production", "TZ=UTC"},
+		EnvironmentFiles: []string{environmentFile, "-/nonexistent/app.env"},
+	}
+
+	// Variables from environment files override those of Environment=
+	want := []string{"APP_MODE=staging", "TZ=UTC", "GREETING=hello world", `MOTD=say "hi"`, "EMPTY="}
+	if got := unitEnvironment(unit); !slices.Equal(got, want) {
+		t.Errorf("unitEnvironment() = %q, want %q", got, want)
+	}
+}
+
+func TestContainerProcessWithoutUnitCommand(t *testing.T) {
+	adapters, err := adapter.LoadRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A unit whose ExecStart parses to no words falls back to the running process
+	for _, execStart := range [][]string{nil, {""}, {"-"}} {
+		info := &profiler.ProcessInfo{
+			ExecutablePath: "/usr/local/bin/app",
+			CommandLineArguments: []profiler.FlagArgument{
+				{Flag: "--port", Value: "8080"},
+			},
+			SystemdUnit: &profiler.SystemdUnit{Name: "app.service", ExecStart: execStart},
+		}
+		process := buildContainerProcess(info, adapters)
+		if want := []string{"/usr/local/bin/app", "--port", "8080"}; !slices.Equal(process.Arguments, want) {
+			t.Errorf("ExecStart %q: Arguments = %q, want %q", execStart, process.Arguments, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package dockerizer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"application_profiling/internal/profiler"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Categories of paths written by the application at runtime
+const (
+	StateData    = "data"
+	StateLog     = "log"
+	StateCache   = "cache"
+	StateRuntime = "runtime"
+)
+
+// runtimePrefixes hold files that are recreated on every start (PID files, sockets, locks)
+var runtimePrefixes = []string{"/run/", "/var/run/", "/var/lock/", "/tmp/", "/var/tmp/", "/dev/"}
+
+// StatePath describes a written path and how it is treated in the container.
+type StatePath struct {
+	Path     string   `yaml:"path"`
+	Access   []string `yaml:"access"`
+	Category string   `yaml:"category"`
+	Volume   string   `yaml:"volume,omitempty"`
+	Reason   string   `yaml:"reason"`
+}
+
+// StateReport lists the detected volumes and the classification of every written path.
+type StateReport struct {
+	Volumes []string    `yaml:"volumes"`
+	Paths   []StatePath `yaml:"paths"`
+}
+
+// DetectStateDirectories finds the directories the application writes to at runtime.
+// Every written path of the access profile (the recorded paths, not the collapsed entries) is
+// persisted through its own directory: data and log directories become volumes, runtime and cache
+// files stay ephemeral. Directories that are system-generic (per the filter rules), or that hold
+// files the application only reads or runs, stay in the image.
+func DetectStateDirectories(accessProfile *profiler.AccessProfile, rules *profiler.FilterRules) StateReport {
+	report := StateReport{}
+	volumeSet := make(map[string]bool)
+
+	// Collect the paths that were only read or executed, which must stay in the image
+	var readOnlyPaths []string
+	for _, entry := range accessProfile.Paths {
+		if !entry.IsWritten() {
+			if entry.IsReadOnly() {
+				readOnlyPaths = append(readOnlyPaths, entry.Path)
+			}
+			continue
+		}
+		for _, recordedEntry := range entry.RecordedEntries() {
+			if recordedEntry.IsReadOnly() {
+				readOnlyPaths = append(readOnlyPaths, recordedEntry.Path)
+			}
+		}
+	}
+
+	for _, entry := range accessProfile.Paths {
+		if !entry.IsWritten() {
+			continue
+		}
+		for _, recordedEntry := range entry.RecordedEntries() {
+			if !recordedEntry.IsWritten() {
+				continue
+			}
+			statePath := classifyStatePath(recordedEntry, readOnlyPaths, rules)
+			if statePath.Volume != "" {
+				volumeSet[statePath.Volume] = true
+			}
+			report.Paths = append(report.Paths, statePath)
+		}
+	}
+
+	// Keep only the outermost volume of nested state directories
+	for volume := range volumeSet {
+		if !hasParentVolume(volume, volumeSet) {
+			report.Volumes = append(report.Volumes, volume)
+		}
+	}
+	sort.Strings(report.Volumes)
+
+	// Point nested state paths at the volume that holds them
+	for i, statePath := range report.Paths {
+		for _, volume := range report.Volumes {
+			if statePath.Volume != "" && isWithinDirectory(statePath.Volume, volume) {
+				report.Paths[i].Volume = volume
+			}
+		}
+	}
+
+	return report
+}
+
+// classifyStatePath decides whether a written path is application state and which volume holds it
+func classifyStatePath(entry profiler.PathAccess, readOnlyPaths []string, rules *profiler.FilterRules) StatePath {
+	statePath := StatePath{Path: entry.Path, Access: entry.Access}
+
+	// Runtime files and caches are recreated by the application
+	for _, prefix := range runtimePrefixes {
+		if strings.HasPrefix(entry.Path+"/", prefix) {
+			statePath.Category = StateRuntime
+			statePath.Reason = "runtime files are recreated on start"
+			return statePath
+		}
+	}
+	if strings.HasPrefix(entry.Path+"/", "/var/cache/") {
+		statePath.Category = StateCache
+		statePath.Reason = "caches can be rebuilt and stay in the container layer"
+		return statePath
+	}
+
+	statePath.Category = StateData
+	if strings.HasPrefix(entry.Path+"/", "/var/log/") {
+		statePath.Category = StateLog
+	}
+
+	// A written file is persisted through its directory, the deepest one holding it.
+	// Files that no longer exist (e.g. removed temporary files) are taken as files.
+	directory := entry.Path
+	if fileInfo, err := os.Stat(entry.Path); err != nil || !fileInfo.IsDir() {
+		directory = filepath.Dir(entry.Path)
+	}
+	if rules.IsGeneric(directory) {
+		statePath.Reason = "parent directory " + directory + " is a system directory; kept in the image"
+		return statePath
+	}
+	for _, readOnlyPath := range readOnlyPaths {
+		if isWithinDirectory(readOnlyPath, directory) {
+			statePath.Reason = "directory " + directory + " holds " + readOnlyPath + ", which is only read or run; kept in the image"
+			return statePath
+		}
+	}
+
+	statePath.Volume = directory
+	statePath.Reason = "written at runtime"
+	return statePath
+}
+
+// isWithinDirectory checks if a path is the given directory or lies below it
+func isWithinDirectory(path, directory string) bool {
+	return path == directory || strings.HasPrefix(path, directory+"/")
+}
+
+// hasParentVolume checks if any other volume contains the given directory
+func hasParentVolume(directory string, volumeSet map[string]bool) bool {
+	for parent := filepath.Dir(directory); parent != "/" && parent != "."; parent = filepath.Dir(parent) {
+		if volumeSet[parent] {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveStateReport writes the state classification report to a YAML file.
+func SaveStateReport(report StateReport, reportPath string) error {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(reportPath, data, 0o644)
+}
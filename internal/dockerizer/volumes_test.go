@@ -0,0 +1,113 @@
+package dockerizer
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"application_profiling/internal/profiler"
+)
+
+func TestDetectStateDirectories(t *testing.T) {
+	rules, err := profiler.LoadFilterRules("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := []string{profiler.AccessWrite, profiler.AccessCreate}
+
+	tests := []struct {
+		name        string
+		paths       []profiler.PathAccess
+		wantVolumes []string
+		wantStates  map[string]string // Volume or category of every written path
+	}{
+		{
+			name: "logs below a collapsed application directory",
+			paths: []profiler.PathAccess{{
+				Path:   "/opt/myapp",
+				Access: []string{profiler.AccessRead, profiler.AccessWrite, profiler.AccessCreate, profiler.AccessExec},
+				Entries: []profiler.PathAccess{
+					{Path: "/opt/myapp/bin/server", Access: []string{profiler.AccessExec}},
+					{Path: "/opt/myapp/conf/server.conf", Access: []string{profiler.AccessRead}},
+					{Path: "/opt/myapp/logs/server.log", Access: written},
+					{Path: "/opt/myapp/logs/access.log", Access: written},
+				},
+			}},
+			wantVolumes: []string{"/opt/myapp/logs"},
+			wantStates:  map[string]string{"/opt/myapp/logs/server.log": "/opt/myapp/logs", "/opt/myapp/logs/access.log": "/opt/myapp/logs"},
+		},
+		{
+			name: "pid file next to the binaries",
+			paths: []profiler.PathAccess{{
+				Path:   "/opt/myapp",
+				Access: []string{profiler.AccessWrite, profiler.AccessCreate, profiler.AccessExec},
+				Entries: []profiler.PathAccess{
+					{Path: "/opt/myapp/server", Access: []string{profiler.AccessExec}},
+					{Path: "/opt/myapp/server.pid", Access: written},
+				},
+			}},
+			wantStates: map[string]string{"/opt/myapp/server.pid": StateData},
+		},
+		{
+			name: "nested data directories",
+			paths: []profiler.PathAccess{{
+				Path:   "/var/lib/mysql",
+				Access: []string{profiler.AccessRead, profiler.AccessWrite, profiler.AccessCreate},
+				Entries: []profiler.PathAccess{
+					{Path: "/var/lib/mysql/ibdata1", Access: []string{profiler.AccessRead, profiler.AccessWrite}},
+					{Path: "/var/lib/mysql/shop/orders.ibd", Access: []string{profiler.AccessRead, profiler.AccessWrite, profiler.AccessCreate}},
+					{Path: "/var/lib/mysql/shop", Access: []string{profiler.AccessList}},
+				},
+			}},
+			wantVolumes: []string{"/var/lib/mysql"},
+			wantStates:  map[string]string{"/var/lib/mysql/ibdata1": "/var/lib/mysql", "/var/lib/mysql/shop/orders.ibd": "/var/lib/mysql"},
+		},
+		{
+			name: "read-only file in another entry of the directory",
+			paths: []profiler.PathAccess{
+				{Path: "/srv/app/data/seed.db", Access: []string{profiler.AccessRead}},
+				{Path: "/srv/app/data/store.db", Access: written},
+			},
+			wantStates: map[string]string{"/srv/app/data/store.db": StateData},
+		},
+		{
+			name: "runtime, cache, logs and files in system directories",
+			paths: []profiler.PathAccess{
+				{Path: "/run/myapp/server.sock", Access: written},
+				{Path: "/var/cache/myapp/index", Access: written},
+				{Path: "/var/log/myapp/server.log", Access: written},
+				{Path: "/var/log/myapp.log", Access: written},
+				{Path: "/etc/myapp.state", Access: []string{profiler.AccessWrite}},
+				{Path: "/etc/myapp/server.conf", Access: []string{profiler.AccessRead}},
+			},
+			wantVolumes: []string{"/var/log/myapp"},
+			wantStates: map[string]string{
+				"/run/myapp/server.sock":    StateRuntime,
+				"/var/cache/myapp/index":    StateCache,
+				"/var/log/myapp/server.log": "/var/log/myapp",
+				"/var/log/myapp.log":        StateLog,
+				"/etc/myapp.state":          StateData,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := DetectStateDirectories(&profiler.AccessProfile{Paths: test.paths}, rules)
+			if !slices.Equal(report.Volumes, test.wantVolumes) {
+				t.Errorf("volumes = %q, want %q", report.Volumes, test.wantVolumes)
+			}
+
+			states := make(map[string]string)
+			for _, statePath := range report.Paths {
+				states[statePath.Path] = statePath.Volume
+				if statePath.Volume == "" {
+					states[statePath.Path] = statePath.Category
+				}
+			}
+			if !reflect.DeepEqual(states, test.wantStates) {
+				t.Errorf("state paths = %v, want %v", states, test.wantStates)
+			}
+		})
+	}
+}
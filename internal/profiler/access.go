@@ -0,0 +1,261 @@
+package profiler
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v2"
+)
+
+// Kinds of access observed on a path, in the order they are reported
+const (
+	AccessRead   = "read"
+	AccessWrite  = "write"
+	AccessCreate = "create"
+	AccessExec   = "exec"
+	AccessStat   = "stat"
+	AccessList   = "list"
+)
+
+// AccessKinds lists every access kind, in report order
+var AccessKinds = []string{AccessRead, AccessWrite, AccessCreate, AccessExec, AccessStat, AccessList}
+
+// accessBySyscall maps system calls that access their paths in a fixed way to the access kind.
+// Open calls are classified by their flags, and calls taking a source and a destination
+// path are listed in destinationAccess.
+var accessBySyscall = map[string]string{
+	"execve": AccessExec, "execveat": AccessExec,
+	"stat": AccessStat, "lstat": AccessStat, "newfstatat": AccessStat, "statx": AccessStat,
+	"access": AccessStat, "faccessat": AccessStat, "faccessat2": AccessStat, "readlink": AccessStat,
+	"readlinkat": AccessStat, "statfs": AccessStat, "getxattr": AccessStat, "lgetxattr": AccessStat,
+	"listxattr": AccessStat, "llistxattr": AccessStat, "name_to_handle_at": AccessStat,
+	"chdir": AccessStat, "chroot": AccessStat, "mount": AccessStat, "umount2": AccessStat,
+	"inotify_add_watch": AccessRead,
+	"mkdir":             AccessCreate, "mkdirat": AccessCreate, "mknod": AccessCreate,
+	"mknodat": AccessCreate,
+	"unlink":  AccessWrite, "unlinkat": AccessWrite, "rmdir": AccessWrite, "truncate": AccessWrite,
+	"chmod": AccessWrite, "fchmodat": AccessWrite, "fchmodat2": AccessWrite, "chown": AccessWrite,
+	"lchown": AccessWrite, "fchownat": AccessWrite, "utime": AccessWrite, "utimes": AccessWrite,
+	"futimesat": AccessWrite, "utimensat": AccessWrite, "setxattr": AccessWrite,
+	"lsetxattr": AccessWrite, "removexattr": AccessWrite, "lremovexattr": AccessWrite,
+	"rename": AccessWrite, "renameat": AccessWrite, "renameat2": AccessWrite,
+}
+
+// destinationAccess maps calls that create a new name for an existing file to the
+// access of their source path; their last path is always created.
+var destinationAccess = map[string]string{
+	"link": AccessStat, "linkat": AccessStat, "symlink": "", "symlinkat": "",
+}
+
+// PathAccess records how a path was accessed during the trace, and by which processes.
+// Written entries also list the recorded paths below them with their own access, as the entry
+// may be a collapsed directory.
+type PathAccess struct {
+	Path       string       `yaml:"path"`
+	Access     []string     `yaml:"access"`
+	ProcessIDs []int        `yaml:"pids,omitempty"`
+	Entries    []PathAccess `yaml:"entries,omitempty"`
+}
+
+// AccessProfile lists the access modes of every path in the filtered profile.
+type AccessProfile struct {
+	Paths []PathAccess `yaml:"paths"`
+}
+
+// accessRecorder accumulates the access kinds and process IDs observed per path
+type accessRecorder struct {
+	kinds      map[string]map[string]bool
+	processIDs map[string]map[int]bool
+}
+
+// newAccessRecorder creates an empty access recorder
+func newAccessRecorder() *accessRecorder {
+	return &accessRecorder{
+		kinds:      make(map[string]map[string]bool),
+		processIDs: make(map[string]map[int]bool),
+	}
+}
+
+// record adds an observed access of a path
+func (recorder *accessRecorder) record(path, kind string, processID int) {
+	if recorder.kinds[path] == nil {
+		recorder.kinds[path] = make(map[string]bool)
+		recorder.processIDs[path] = make(map[int]bool)
+	}
+	recorder.kinds[path][kind] = true
+	if processID > 0 {
+		recorder.processIDs[path][processID] = true
+	}
+}
+
+// buildProfile aggregates the recorded accesses onto the given (possibly collapsed) paths.
+// A collapsed directory carries the accesses of everything observed below it; if any of them
+// was written, the recorded paths are kept as its entries.
+func (recorder *accessRecorder) buildProfile(filePaths []string) *AccessProfile {
+	profile := &AccessProfile{Paths: make([]PathAccess, 0, len(filePaths))}
+
+	for _, filePath := range filePaths {
+		kinds := make(map[string]bool)
+		processIDs := make(map[int]bool)
+		var entries []PathAccess
+		for recordedPath, recordedKinds := range recorder.kinds {
+			if recordedPath != filePath && !strings.HasPrefix(recordedPath, strings.TrimSuffix(filePath, "/")+"/") {
+				continue
+			}
+			for kind := range recordedKinds {
+				kinds[kind] = true
+			}
+			entries = append(entries, PathAccess{Path: recordedPath, Access: SortedAccessKinds(recordedKinds)})
+			for processID := range recorder.processIDs[recordedPath] {
+				processIDs[processID] = true
+			}
+		}
+
+		entry := PathAccess{Path: filePath, Access: SortedAccessKinds(kinds)}
+		for processID := range processIDs {
+			entry.ProcessIDs = append(entry.ProcessIDs, processID)
+		}
+		sort.Ints(entry.ProcessIDs)
+		if entry.IsWritten() {
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+			entry.Entries = entries
+		}
+		profile.Paths = append(profile.Paths, entry)
+	}
+
+	return profile
+}
+
+// SortedAccessKinds lists the given access kinds in report order.
+func SortedAccessKinds(kinds map[string]bool) []string {
+	var sorted []string
+	for _, kind := range AccessKinds {
+		if kinds[kind] {
+			sorted = append(sorted, kind)
+		}
+	}
+	return sorted
+}
+
+// classifyAccess returns the kinds of access a call performed on its n-th path argument
+func classifyAccess(event SyscallEvent, pathIndex int) []string {
+	// A failed call only probed the path
+	if event.Errno != "" || event.ReturnValue < 0 {
+		return []string{AccessStat}
+	}
+
+	if isOpenCall(event.Syscall) {
+		return classifyOpenFlags(event.Flags)
+	}
+	if event.Syscall == "creat" {
+		return []string{AccessWrite, AccessCreate}
+	}
+
+	if sourceAccess, found := destinationAccess[event.Syscall]; found {
+		if pathIndex == len(event.Paths)-1 {
+			return []string{AccessCreate}
+		}
+		if sourceAccess == "" {
+			return nil
+		}
+		return []string{sourceAccess}
+	}
+
+	if kind, found := accessBySyscall[event.Syscall]; found {
+		return []string{kind}
+	}
+
+	// Calls without a known access pattern at least looked the path up
+	return []string{AccessStat}
+}
+
+// classifyOpenFlags derives the access kinds of an open call from its flags
+func classifyOpenFlags(flags []string) []string {
+	var kinds []string
+	switch {
+	case slices.Contains(flags, "O_DIRECTORY"):
+		kinds = append(kinds, AccessList)
+	case slices.Contains(flags, "O_PATH"):
+		kinds = append(kinds, AccessStat)
+	case slices.Contains(flags, "O_WRONLY"):
+		kinds = append(kinds, AccessWrite)
+	case slices.Contains(flags, "O_RDWR"):
+		kinds = append(kinds, AccessRead, AccessWrite)
+	default:
+		kinds = append(kinds, AccessRead)
+	}
+	if slices.Contains(flags, "O_CREAT") || slices.Contains(flags, "O_TMPFILE") {
+		kinds = append(kinds, AccessCreate)
+	}
+	return kinds
+}
+
+// HasAccess checks if the entry records the given kind of access
+func (entry PathAccess) HasAccess(kind string) bool {
+	return slices.Contains(entry.Access, kind)
+}
+
+// IsWritten checks if the path (or anything below it) was modified or created at runtime
+func (entry PathAccess) IsWritten() bool {
+	return entry.HasAccess(AccessWrite) || entry.HasAccess(AccessCreate)
+}
+
+// IsReadOnly checks if the path was read or executed, but never modified or created
+func (entry PathAccess) IsReadOnly() bool {
+	return (entry.HasAccess(AccessRead) || entry.HasAccess(AccessExec)) && !entry.IsWritten()
+}
+
+// RecordedEntries returns the recorded paths of a written entry with their access.
+// Profiles without entries only have the entry itself.
+func (entry PathAccess) RecordedEntries() []PathAccess {
+	if len(entry.Entries) == 0 {
+		return []PathAccess{{Path: entry.Path, Access: entry.Access}}
+	}
+	return entry.Entries
+}
+
+// WrittenPaths returns the paths that were modified or created at runtime
+func (profile *AccessProfile) WrittenPaths() []string {
+	var writtenPaths []string
+	for _, entry := range profile.Paths {
+		if entry.IsWritten() {
+			writtenPaths = append(writtenPaths, entry.Path)
+		}
+	}
+	return writtenPaths
+}
+
+// SaveAccessProfile saves the access profile to a YAML file next to process_info.yaml
+func SaveAccessProfile(info *ProcessInfo, profile *AccessProfile) {
+	filePath := BuildFilePath(fmt.Sprintf("output/%d/profile", info.PID), "access_profile.yaml")
+	if err := profile.SaveAsYAML(filePath); err != nil {
+		log.Error("Failed to save access profile", "filePath", filePath, "error", err)
+	}
+}
+
+// SaveAsYAML writes the access profile to the given path
+func (profile *AccessProfile) SaveAsYAML(filePath string) error {
+	data, err := yaml.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0o644)
+}
+
+// LoadAccessProfile loads an access profile from a YAML file.
+func LoadAccessProfile(path string) (*AccessProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &AccessProfile{}
+	if err := yaml.Unmarshal(data, profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
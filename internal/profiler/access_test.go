@@ -0,0 +1,31 @@
+package profiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildProfileKeepsRecordedEntriesOfWrittenPaths(t *testing.T) {
+	recorder := newAccessRecorder()
+	recorder.record("/opt/myapp/bin/server", AccessExec, 10)
+	recorder.record("/opt/myapp/logs/server.log", AccessWrite, 11)
+	recorder.record("/opt/myapp/logs/server.log", AccessCreate, 11)
+	recorder.record("/etc/myapp/server.conf", AccessRead, 10)
+
+	profile := recorder.buildProfile([]string{"/etc/myapp", "/opt/myapp"})
+	want := []PathAccess{
+		{Path: "/etc/myapp", Access: []string{AccessRead}, ProcessIDs: []int{10}},
+		{
+			Path:       "/opt/myapp",
+			Access:     []string{AccessWrite, AccessCreate, AccessExec},
+			ProcessIDs: []int{10, 11},
+			Entries: []PathAccess{
+				{Path: "/opt/myapp/bin/server", Access: []string{AccessExec}},
+				{Path: "/opt/myapp/logs/server.log", Access: []string{AccessWrite, AccessCreate}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(profile.Paths, want) {
+		t.Errorf("buildProfile() =\n%+v\nwant\n%+v", profile.Paths, want)
+	}
+}
@@ -0,0 +1,72 @@
+package profiler
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/charmbracelet/log"
+)
+
+// AttachProcess traces a running process and its children without restarting it.
+// Besides the observed events, the result holds the paths the process tree already had
+// mapped or open before tracing began, and the working directory of every traced thread.
+func AttachProcess(info *ProcessInfo, options TraceOptions) TraceResult {
+	// Collect files loaded before the tracer attaches (startup libraries, open files)
+	processIDs := append([]int{info.PID}, info.ChildPIDs...)
+	result := TraceResult{
+		StaticPaths:        GetStaticPaths(processIDs),
+		WorkingDirectories: getThreadWorkingDirectories(processIDs),
+	}
+	SaveStaticPaths(info, result.StaticPaths)
+
+	// Get the output file path for the raw trace log
+	logfilePath := BuildFilePath(fmt.Sprintf("output/%d/profile", info.PID), "strace_raw.log")
+
+	// Create the tracer
+	tracer, err := NewTracer(options.Backend, logfilePath)
+	if err != nil {
+		log.Error("Failed to create tracer", "error", err)
+		return result
+	}
+
+	// Attach the tracer to the running processes
+	log.Info(fmt.Sprintf("Attaching tracer to PIDs %v...", processIDs))
+	if err := tracer.Attach(processIDs); err != nil {
+		log.Error("Failed to attach tracer", "error", err)
+		return result
+	}
+	log.Info("Monitoring process with tracer...")
+
+	result.Events, result.ResourceSamples = collectTraceEvents(tracer, info, options, processIDs, nil)
+	return result
+}
+
+// getThreadWorkingDirectories records the working directory of every thread of the given processes,
+// since workers may have changed directory long before the tracer attached
+func getThreadWorkingDirectories(processIDs []int) map[int]string {
+	workingDirectories := make(map[int]string)
+	for _, processID := range processIDs {
+		workingDirectory := GetWorkingDirectory(processID)
+		for _, threadID := range getThreadIDs(processID) {
+			workingDirectories[threadID] = workingDirectory
+		}
+	}
+	return workingDirectories
+}
+
+// getThreadIDs lists the thread IDs of a process from /proc/<PID>/task
+func getThreadIDs(processID int) []int {
+	taskEntries, err := os.ReadDir(fmt.Sprintf("/proc/%d/task", processID))
+	if err != nil {
+		return []int{processID}
+	}
+
+	var threadIDs []int
+	for _, taskEntry := range taskEntries {
+		if threadID, err := strconv.Atoi(taskEntry.Name()); err == nil {
+			threadIDs = append(threadIDs, threadID)
+		}
+	}
+	return threadIDs
+}
@@ -0,0 +1,101 @@
+package profiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigPath is a path referenced by a configuration file.
+type ConfigPath struct {
+	Path      string `yaml:"path"`
+	Directive string `yaml:"directive"` // Directive that references the path, e.g. "root"
+	Origin    string `yaml:"origin"`    // Configuration file and line, e.g. "/etc/nginx/nginx.conf:12"
+	Exists    bool   `yaml:"exists"`    // Whether the path exists on this host
+}
+
+// configParser extracts the paths referenced by a configuration file, following its includes.
+// It receives the executables of the profiled processes, which may be queried for built-in defaults.
+type configParser func(configFile string, executablePaths []string) []ConfigPath
+
+// configParsers maps the parser names used by application adapters to their implementation
+var configParsers = map[string]configParser{
+	"nginx": parseNginxConfig,
+	"mysql": parseMySQLConfig,
+}
+
+// HasConfigParser checks if a configuration parser with the given name exists
+func HasConfigParser(name string) bool {
+	_, found := configParsers[name]
+	return found
+}
+
+// DiscoverConfigPaths parses the known configuration files that are part of the traced paths
+// and returns the paths they reference, sorted by path. configFiles maps each known
+// configuration file to the name of its parser, executablePaths lists the executables of the
+// profiled processes.
+func DiscoverConfigPaths(tracedPaths []string, configFiles map[string]string, executablePaths []string) []ConfigPath {
+	var configPaths []ConfigPath
+	for configFile, parserName := range configFiles {
+		if !IsCoveredByPaths(configFile, tracedPaths) {
+			continue
+		}
+		parse, found := configParsers[parserName]
+		if !found {
+			log.Debug("No parser for configuration file", "file", configFile, "parser", parserName)
+			continue
+		}
+
+		log.Info(fmt.Sprintf("Parsing %s configuration %s...", parserName, configFile))
+		configPaths = append(configPaths, parse(configFile, executablePaths)...)
+	}
+
+	sort.Slice(configPaths, func(i, j int) bool {
+		if configPaths[i].Path != configPaths[j].Path {
+			return configPaths[i].Path < configPaths[j].Path
+		}
+		return configPaths[i].Origin < configPaths[j].Origin
+	})
+	return configPaths
+}
+
+// IsCoveredByPaths checks if the path, or a directory holding it, is in the list.
+func IsCoveredByPaths(path string, paths []string) bool {
+	for _, candidate := range paths {
+		if path == candidate || strings.HasPrefix(path, strings.TrimSuffix(candidate, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// newConfigPath records a referenced path, resolving it against baseDirectory if it is relative
+func newConfigPath(path, baseDirectory, directive, configFile string, line int) ConfigPath {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDirectory, path)
+	}
+	path = filepath.Clean(path)
+	_, err := os.Lstat(path)
+	return ConfigPath{
+		Path:      path,
+		Directive: directive,
+		Origin:    fmt.Sprintf("%s:%d", configFile, line),
+		Exists:    err == nil,
+	}
+}
+
+// SaveConfigPaths writes the discovered configuration paths with their origin to a YAML file
+func SaveConfigPaths(configPaths []ConfigPath, filePath string) error {
+	data, err := yaml.Marshal(struct {
+		Paths []ConfigPath `yaml:"paths"`
+	}{configPaths})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0o644)
+}
@@ -1,89 +1,91 @@
 package profiler
 
 import (
-	"bufio"
-	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
-	"regexp"
 	"sort"
-	"strings"
 
 	"github.com/charmbracelet/log"
 )
 
-var (
-	filePathRegex = regexp.MustCompile(`(?:\s|")((/|\.\/)[^" ]+)`)
-	dirRegex      = regexp.MustCompile(`chdir\("([^"]+)"\)`)
-)
-
-// FilterStraceLog reads a raw strace log file, filters file paths, and writes to a new log file
-func FilterStraceLog(info *ProcessInfo) {
-	// Get the input and output file paths
-
-	inputFilePath := BuildFilePath(fmt.Sprintf("output/%d/profile", info.PID), "strace_raw.log")
+// FilterTraceEvents filters the file paths of traced system calls and writes them to a new log file.
+// Static paths (discovered from /proc in attach mode) are filtered alongside the trace.
+// The rules decide which paths are system-generic or excluded, and how far paths collapse.
+func FilterTraceEvents(info *ProcessInfo, result TraceResult, rules *FilterRules) {
+	// Get the output file path
 	outputFilePath := BuildFilePath(fmt.Sprintf("output/%d/profile", info.PID), "strace_filtered.log")
 
-	// Open input file
-	inputFile, err := os.Open(inputFilePath)
-	if err != nil {
-		log.Error("Failed to open input file", "error", err)
-	}
-	defer inputFile.Close()
-
 	// Open output file
 	outputFile, err := os.Create(outputFilePath)
 	if err != nil {
 		log.Error("Failed to create output file", "error", err)
+		return
 	}
 	defer outputFile.Close()
 
-	// Process the strace log
-	err = processStraceLog(inputFile, outputFile, info.WorkingDirectory, info.ExecutablePath)
+	// Process the trace events
+	resolver := NewPathResolver(result.Events, info.WorkingDirectory, result.WorkingDirectories)
+	access := newAccessRecorder()
+	access.record(info.ExecutablePath, AccessExec, info.PID)
+	filePaths, err := processTraceEvents(result.Events, outputFile, resolver, access, rules, info.ExecutablePath, result.StaticPaths)
 	if err != nil {
-		log.Error("Failed to process strace log", "error", err)
+		log.Error("Failed to process trace events", "error", err)
 	}
+
+	// Save how each of the filtered paths was accessed
+	SaveAccessProfile(info, access.buildProfile(filePaths))
 }
 
-// processStraceLog scans the input file, filters file paths, and writes them to the output file
-func processStraceLog(inputFile *os.File, outputFile *os.File, initialWorkingDirectory, executablePath string) error {
+// processTraceEvents filters the file paths of the events, records how they were accessed,
+// and writes them to the output file. It returns the written paths.
+func processTraceEvents(events []SyscallEvent, outputFile *os.File, resolver *PathResolver, access *accessRecorder, rules *FilterRules, executablePath string, supplementaryPaths []string) ([]string, error) {
 	filePaths := []string{}
 	seenPaths := make(map[string]bool)
-	currentWorkingDirectory := initialWorkingDirectory
 
-	scanner := bufio.NewScanner(inputFile)
-	for scanner.Scan() {
-		line := scanner.Text()
+	for _, event := range events {
+		// Resolve the paths before updating per-process state (cwd, fds) with this call
+		resolvedPaths := resolver.ResolvePathArguments(event)
+		resolver.Observe(event)
 
-		// Skip lines with error indicators
-		if containsErrorIndicators(line) {
+		// Skip calls that failed to resolve a path
+		if isFailedLookup(event) {
 			continue
 		}
 
-		// Update working directory if "chdir" syscall is encountered
-		currentWorkingDirectory = updateWorkingDirectory(line, currentWorkingDirectory)
+		for pathIndex, filePath := range resolvedPaths {
+			// Skip unresolved paths and symlink targets, which are link content rather than accessed paths
+			if filePath == "" || (isSymlinkCall(event.Syscall) && pathIndex == 0) {
+				continue
+			}
 
-		// Extract and resolve file path
-		filePath, err := extractFilePath(line, currentWorkingDirectory)
-		if err != nil {
-			continue
+			// Record the access, even for paths that end up collapsed into their directory
+			if !rules.IsGenericOrExcluded(filePath) {
+				for _, kind := range classifyAccess(event, pathIndex) {
+					access.record(filePath, kind, event.PID)
+				}
+			}
+
+			// Skip duplicates and invalid paths
+			if seenPaths[filePath] || rules.IsGenericOrExcluded(filePath) {
+				continue
+			}
+
+			// Mark as seen and append to list
+			seenPaths[filePath] = true
+			filePaths = append(filePaths, filePath)
 		}
+	}
 
-		// Skip duplicates and invalid paths
-		if seenPaths[filePath] || isGenericOrExcluded(filePath) {
+	// Include supplementary paths that the trace did not observe
+	for _, filePath := range supplementaryPaths {
+		if seenPaths[filePath] || rules.IsGenericOrExcluded(filePath) {
 			continue
 		}
-
-		// Mark as seen and append to list
+		access.record(filePath, AccessRead, 0)
 		seenPaths[filePath] = true
 		filePaths = append(filePaths, filePath)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return err
-	}
-
 	// Ensure the executable path is included
 	if !seenPaths[executablePath] {
 		filePaths = append(filePaths, executablePath)
@@ -91,115 +93,39 @@ func processStraceLog(inputFile *os.File, outputFile *os.File, initialWorkingDir
 	}
 
 	// Collapse application-specific directories
-	filePaths = collapseApplicationSpecificDirs(filePaths)
+	filePaths = collapseApplicationSpecificDirs(filePaths, rules)
 
 	// Write the final paths
 	for _, filePath := range filePaths {
 		if _, err := outputFile.WriteString(filePath + "\n"); err != nil {
-			return err
+			return filePaths, err
 		}
 	}
 
-	return nil
+	return filePaths, nil
 }
 
-// extractFilePath extracts and resolves the file path from a line
-func extractFilePath(line, currentWorkingDirectory string) (string, error) {
-	match := filePathRegex.FindStringSubmatch(line)
-	if match == nil {
-		return "", errors.New("no file path found")
-	}
-	filePath := match[1]
-
-	// Resolve relative paths (e.g., "./file")
-	if strings.HasPrefix(filePath, "./") {
-		filePath = filepath.Join(currentWorkingDirectory, filePath[2:])
-	}
-
-	return filePath, nil
+// isSymlinkCall checks if a system call creates a symbolic link
+func isSymlinkCall(name string) bool {
+	return name == "symlink" || name == "symlinkat"
 }
 
-// updateWorkingDirectory updates the current directory if a chdir syscall is found
-func updateWorkingDirectory(line, currentDir string) string {
-	if !strings.Contains(line, "chdir(") {
-		return currentDir
-	}
-
-	matches := dirRegex.FindStringSubmatch(line)
-	if len(matches) > 1 {
-		return matches[1]
-	}
-	return currentDir
-}
-
-// containsErrorIndicators checks if a line contains error-related indicators
-func containsErrorIndicators(line string) bool {
-	return strings.Contains(line, "(Invalid argument)") || strings.Contains(line, "(No such file or directory)")
-}
-
-// isGenericOrExcluded checks if a file path is generic or excluded
-func isGenericOrExcluded(path string) bool {
-	return isGenericPath(path) || hasExcludedPrefix(path)
-}
-
-// isGenericPath checks if a file path is system-generic
-func isGenericPath(path string) bool {
-	// Normalize by removing trailing slash
-	clean := strings.TrimSuffix(path, "/")
-	return GenericPathsSet[clean]
-}
-
-// hasExcludedPrefix checks if a file path starts with any excluded prefix
-func hasExcludedPrefix(path string) bool {
-	for prefix := range ExcludePrefixesSet {
-		if strings.HasPrefix(path, prefix) {
-			return true
-		}
-	}
-	return false
+// isFailedLookup checks if an event failed because its path was missing or invalid
+func isFailedLookup(event SyscallEvent) bool {
+	return event.Errno == "ENOENT" || event.Errno == "EINVAL"
 }
 
-// collapseApplicationSpecificDirs reduces file paths by identifying the shortest
-// application-specific directory that is not system-generic or excluded.
-// Example: For "/etc/nginx/conf.d", it checks:
-//   - "/etc" (generic)
-//   - "/etc/nginx" (application-specific)
-//
-// If "/etc/nginx" is valid, all subpaths collapse to it.
-func collapseApplicationSpecificDirs(filePaths []string) []string {
-	collapsed := make([]string, 0, len(filePaths))
-
-	for _, path := range filePaths {
-		// Split path into components
-		parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
-		if len(parts) <= 1 {
-			// Keep short paths like "/etc" or "/usr" as-is
-			collapsed = append(collapsed, path)
-			continue
-		}
-
-		// Find the first non-generic, non-excluded directory
-		candidate := "/"
-		collapsedPath := path // Default to original if no collapse possible
-		for i := 0; i < len(parts); i++ {
-			candidate = filepath.Join(candidate, parts[i])
-			if i > 0 && !isGenericOrExcluded(candidate) {
-				// Use this directory as the top-level application-specific path
-				collapsedPath = candidate
-				break
-			}
-		}
-
-		collapsed = append(collapsed, collapsedPath)
-	}
-
-	// Deduplicate and sort results
+// collapseApplicationSpecificDirs reduces file paths to the shortest application-specific
+// directory that is not system-generic or excluded (see FilterRules.CollapseTarget).
+func collapseApplicationSpecificDirs(filePaths []string, rules *FilterRules) []string {
+	// Collapse, deduplicate and sort results
 	seen := make(map[string]bool)
 	finalPaths := []string{}
-	for _, path := range collapsed {
-		if !seen[path] {
-			seen[path] = true
-			finalPaths = append(finalPaths, path)
+	for _, path := range filePaths {
+		collapsedPath := rules.CollapseTarget(path)
+		if !seen[collapsedPath] {
+			seen[collapsedPath] = true
+			finalPaths = append(finalPaths, collapsedPath)
 		}
 	}
 
@@ -13,20 +13,26 @@ import (
 
 // ProcessInfo represents the process metadata.
 type ProcessInfo struct {
-	PID                  int            `yaml:"pid"`                  // Process ID
-	ChildPIDs            []int          `yaml:"childpids"`            // Child process IDs
-	ProcessUser          string         `yaml:"processuser"`          // User running the process
-	ProcessGroup         string         `yaml:"processgroup"`         // Group running the process
-	ExecutablePath       string         `yaml:"executablepath"`       // Path to the executable
-	CommandLineArguments []FlagArgument `yaml:"commandlinearguments"` // Command-line arguments
-	ReconstructedCommand string         `yaml:"reconstructedcommand"` // Reconstructed command string
-	WorkingDirectory     string         `yaml:"workingdirectory"`     // Current working directory
-	EnvironmentVariables []string       `yaml:"environmentvariables"` // Environment variables
-	UnixSockets          []string       `yaml:"unixsockets"`          // Unix domain sockets in use
-	ListeningTCP         []int          `yaml:"listeningtcp"`         // TCP ports in use
-	ListeningUDP         []int          `yaml:"listeningudp"`         // UDP ports in use
-	OSImage              string         `yaml:"osimage"`              // Operating system information
-	ResourceUsage        *ProcessUsage  `yaml:"resourceusage"`        // Resource usage information
+	PID                  int              `yaml:"pid"`                  // Process ID
+	ChildPIDs            []int            `yaml:"childpids"`            // Child process IDs
+	ProcessUser          string           `yaml:"processuser"`          // User running the process
+	ProcessGroup         string           `yaml:"processgroup"`         // Group running the process
+	ExecutablePath       string           `yaml:"executablepath"`       // Path to the executable
+	CommandLineArguments []FlagArgument   `yaml:"commandlinearguments"` // Command-line arguments
+	ReconstructedCommand string           `yaml:"reconstructedcommand"` // Reconstructed command string
+	WorkingDirectory     string           `yaml:"workingdirectory"`     // Current working directory
+	EnvironmentVariables []string         `yaml:"environmentvariables"` // Environment variables
+	UnixSockets          []string         `yaml:"unixsockets"`          // Unix domain sockets in use
+	ListeningTCP         []int            `yaml:"listeningtcp"`         // TCP ports in use
+	ListeningUDP         []int            `yaml:"listeningudp"`         // UDP ports in use
+	ConnectedTCP         []int            `yaml:"connectedtcp"`         // Remote ports of outgoing TCP connections
+	ConnectedUnix        []string         `yaml:"connectedunix"`        // Unix domain sockets connected to as a client
+	OSImage              string           `yaml:"osimage"`              // Operating system information
+	Distributions        []string         `yaml:"distributions"`        // os-release ID followed by its ID_LIKE IDs
+	ResourceUsage        *ProcessUsage    `yaml:"resourceusage"`        // Resource usage information
+	SampledUsage         *ResourceSummary `yaml:"sampledusage"`         // Resource usage sampled during the trace window
+	StartupSeconds       float64          `yaml:"startupseconds"`       // Time until the restarted process listened again
+	SystemdUnit          *SystemdUnit     `yaml:"systemdunit"`          // Owning systemd service, if any
 }
 
 // FlagArgument represents a cmdline flag and its associated value.
@@ -43,8 +49,9 @@ type ProcessUsage struct {
 	DiskWriteMB float64 // Disk write in MB
 }
 
-// GetProcessInfo retrieves key information about a process by its Process ID (PID)
-func GetProcessInfo(processID int) *ProcessInfo {
+// GetProcessInfo retrieves key information about a process by its Process ID (PID).
+// The unit files of an owning systemd service are loaded below systemdRoot.
+func GetProcessInfo(processID int, systemdRoot string) *ProcessInfo {
 	// Initialize ProcessInfo object
 	info := &ProcessInfo{
 		PID: processID,
@@ -57,6 +64,8 @@ func GetProcessInfo(processID int) *ProcessInfo {
 	info.EnvironmentVariables = GetEnvironmentVariables(processID)
 	info.ProcessUser, info.ProcessGroup = GetProcessUserAndGroup(processID)
 	info.OSImage = GetOSRelease()
+	info.Distributions = GetDistributionIDs()
+	info.SystemdUnit = GetSystemdUnit(processID, systemdRoot)
 
 	// Reconstruct command line
 	rawCommandLineArguments := GetCommandLineArgs(processID)
@@ -69,6 +78,8 @@ func GetProcessInfo(processID int) *ProcessInfo {
 	info.UnixSockets = GetUnixDomainSockets(inodeSet)
 	info.ListeningTCP = GetListeningTCPPorts(inodeSet)
 	info.ListeningUDP = GetListeningUDPPorts(inodeSet)
+	info.ConnectedTCP = GetConnectedTCPPorts(inodeSet, info.ListeningTCP)
+	info.ConnectedUnix = GetConnectedUnixSockets(inodeSet)
 
 	return info
 }
@@ -223,6 +234,50 @@ func GetOSRelease() string {
 	return fmt.Sprintf("%s:%s", strings.ToLower(name), versionID)
 }
 
+// GetDistributionIDs returns the ID of the host distribution from /etc/os-release, followed by
+// the IDs of the distributions it is derived from (ID_LIKE), e.g. ["rocky", "rhel", "centos", "fedora"]
+func GetDistributionIDs() []string {
+	data, err := os.ReadFile("/etc/os-release")
+	if err != nil {
+		log.Error("Failed to read /etc/os-release", "error", err)
+		return nil
+	}
+	return parseDistributionIDs(string(data))
+}
+
+// parseDistributionIDs extracts the ID and ID_LIKE fields of an os-release file
+func parseDistributionIDs(osRelease string) []string {
+	var id string
+	var likeIDs []string
+	for _, line := range strings.Split(osRelease, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+		value = strings.ToLower(strings.Trim(value, "\"'"))
+		switch key {
+		case "ID":
+			id = value
+		case "ID_LIKE":
+			likeIDs = strings.Fields(value)
+		}
+	}
+
+	if id == "" {
+		return likeIDs
+	}
+	return append([]string{id}, likeIDs...)
+}
+
+// DistributionIDs returns the distribution IDs of the profiled host. Profiles saved before the
+// IDs were recorded fall back to the distribution name of the OS image.
+func (info *ProcessInfo) DistributionIDs() []string {
+	if len(info.Distributions) > 0 {
+		return info.Distributions
+	}
+	return []string{DistributionID(info.OSImage)}
+}
+
 // parseEnvironmentVariables parses environment variables from a null-byte separated string
 func parseEnvironmentVariables(rawData []byte) []string {
 	rawVariables := strings.Split(string(rawData), "\x00")
@@ -0,0 +1,48 @@
+package profiler
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseDistributionIDs(t *testing.T) {
+	tests := []struct {
+		name      string
+		osRelease string
+		want      []string
+	}{
+		{
+			name:      "ubuntu",
+			osRelease: "NAME=\"Ubuntu\"\nVERSION_ID=\"22.04\"\nID=ubuntu\nID_LIKE=debian\n",
+			want:      []string{"ubuntu", "debian"},
+		},
+		{
+			name:      "red hat with a NAME of several words",
+			osRelease: "NAME=\"Red Hat Enterprise Linux\"\nID=\"rhel\"\nID_LIKE=\"fedora\"\nVERSION_ID=\"9.3\"\n",
+			want:      []string{"rhel", "fedora"},
+		},
+		{
+			name:      "rocky with several ID_LIKE IDs",
+			osRelease: "NAME=\"Rocky Linux\"\nID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\n",
+			want:      []string{"rocky", "rhel", "centos", "fedora"},
+		},
+		{
+			name:      "no ID_LIKE",
+			osRelease: "NAME=\"Alpine Linux\"\nID=alpine\nVERSION_ID=3.19.1\n",
+			want:      []string{"alpine"},
+		},
+		{
+			name:      "no ID",
+			osRelease: "NAME=Custom\n",
+			want:      nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseDistributionIDs(test.osRelease); !slices.Equal(got, test.want) {
+				t.Errorf("parseDistributionIDs() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
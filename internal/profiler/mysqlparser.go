@@ -0,0 +1,103 @@
+package profiler
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// mysqlParser collects the paths referenced by a MySQL option file and its includes
+type mysqlParser struct {
+	visited map[string]bool
+	paths   []ConfigPath
+}
+
+// parseMySQLConfig returns the included option files, data directory, socket directory
+// and error log referenced by a MySQL or MariaDB option file (my.cnf)
+func parseMySQLConfig(configFile string, _ []string) []ConfigPath {
+	parser := &mysqlParser{visited: make(map[string]bool)}
+	parser.parseFile(configFile)
+	return parser.paths
+}
+
+// parseFile handles the options and include directives of one option file
+func (parser *mysqlParser) parseFile(configFile string) {
+	configFile = filepath.Clean(configFile)
+	if parser.visited[configFile] {
+		return
+	}
+	parser.visited[configFile] = true
+
+	file, err := os.Open(configFile)
+	if err != nil {
+		log.Warn("Failed to read MySQL option file", "file", configFile, "error", err)
+		return
+	}
+	defer file.Close()
+
+	baseDirectory := filepath.Dir(configFile)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		// Include directives: "!include file" and "!includedir directory" (reads its *.cnf files)
+		if directive, argument, found := strings.Cut(line, " "); found && strings.HasPrefix(directive, "!") {
+			// Relative includes are resolved against the directory of the including file
+			argument = strings.TrimSpace(argument)
+			if !filepath.IsAbs(argument) {
+				argument = filepath.Join(baseDirectory, argument)
+			}
+			var includedFiles []string
+			switch directive {
+			case "!include":
+				includedFiles = []string{argument}
+			case "!includedir":
+				parser.add(argument, "", directive, configFile, lineNumber)
+				includedFiles, _ = filepath.Glob(filepath.Join(argument, "*.cnf"))
+			}
+			for _, includedFile := range includedFiles {
+				parser.add(includedFile, "", directive, configFile, lineNumber)
+				parser.parseFile(includedFile)
+			}
+			continue
+		}
+
+		// Options: "key = value"; dashes and underscores are interchangeable in option names
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		key = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "-", "_")
+		value = strings.TrimSpace(value)
+		if isQuotedValue(value) {
+			value = value[1 : len(value)-1]
+		}
+		if value == "" {
+			continue
+		}
+
+		switch key {
+		case "datadir", "log_error":
+			parser.add(value, baseDirectory, key, configFile, lineNumber)
+		case "socket":
+			// The socket only exists while the server runs, its directory must exist to start it
+			parser.add(filepath.Dir(value), baseDirectory, key, configFile, lineNumber)
+		}
+	}
+}
+
+// add records a path referenced by an option or include directive
+func (parser *mysqlParser) add(path, baseDirectory, directive, configFile string, line int) {
+	parser.paths = append(parser.paths, newConfigPath(path, baseDirectory, directive, configFile, line))
+}
+
+// isQuotedValue checks if an option value is enclosed in matching quotes
+func isQuotedValue(value string) bool {
+	return len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0]
+}
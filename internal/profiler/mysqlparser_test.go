@@ -0,0 +1,75 @@
+package profiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMySQLParser(t *testing.T) {
+	type reference struct{ path, directive, origin string }
+
+	configPaths := parseMySQLConfig("testdata/mysql/my.cnf", nil)
+	got := make([]reference, 0, len(configPaths))
+	for _, configPath := range configPaths {
+		got = append(got, reference{configPath.Path, configPath.Directive, configPath.Origin})
+	}
+
+	// Includes and relative options are resolved against the including file, not the working directory.
+	// extra.cnf includes my.cnf back and is included twice, each file is parsed once.
+	want := []reference{
+		{"/var/lib/mysql", "datadir", "testdata/mysql/my.cnf:3"},
+		{"/run/mysqld", "socket", "testdata/mysql/my.cnf:4"},
+		{"testdata/mysql/logs/error.log", "log_error", "testdata/mysql/my.cnf:5"},
+		{"testdata/mysql/extra.cnf", "!include", "testdata/mysql/my.cnf:7"},
+		{"/var/log/mysql/safe.log", "log_error", "testdata/mysql/extra.cnf:2"},
+		{"testdata/mysql/my.cnf", "!include", "testdata/mysql/extra.cnf:3"},
+		{"testdata/mysql/conf.d", "!includedir", "testdata/mysql/my.cnf:8"},
+		{"testdata/mysql/conf.d/server.cnf", "!includedir", "testdata/mysql/my.cnf:8"},
+		{"/tmp", "socket", "testdata/mysql/conf.d/server.cnf:5"},
+		{"testdata/mysql/extra.cnf", "!include", "testdata/mysql/conf.d/server.cnf:6"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMySQLConfig() =\n%v\nwant\n%v", got, want)
+	}
+
+	for _, configPath := range configPaths {
+		if configPath.Directive == "!includedir" && !configPath.Exists {
+			t.Errorf("parseMySQLConfig() reports %s as missing", configPath.Path)
+		}
+	}
+}
+
+func TestDiscoverConfigPaths(t *testing.T) {
+	configFiles := map[string]string{
+		"testdata/mysql/my.cnf":     "mysql",
+		"testdata/mysql/extra.cnf":  "postgresql", // No such parser
+		"testdata/nginx/nginx.conf": "nginx",      // Not traced
+	}
+
+	configPaths := DiscoverConfigPaths([]string{"testdata/mysql/"}, configFiles, nil)
+	got := make([]string, 0, len(configPaths))
+	for _, configPath := range configPaths {
+		got = append(got, configPath.Path+" "+configPath.Origin)
+	}
+
+	// Sorted by path, then by the file and line referencing it
+	want := []string{
+		"/run/mysqld testdata/mysql/my.cnf:4",
+		"/tmp testdata/mysql/conf.d/server.cnf:5",
+		"/var/lib/mysql testdata/mysql/my.cnf:3",
+		"/var/log/mysql/safe.log testdata/mysql/extra.cnf:2",
+		"testdata/mysql/conf.d testdata/mysql/my.cnf:8",
+		"testdata/mysql/conf.d/server.cnf testdata/mysql/my.cnf:8",
+		"testdata/mysql/extra.cnf testdata/mysql/conf.d/server.cnf:6",
+		"testdata/mysql/extra.cnf testdata/mysql/my.cnf:7",
+		"testdata/mysql/logs/error.log testdata/mysql/my.cnf:5",
+		"testdata/mysql/my.cnf testdata/mysql/extra.cnf:3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiscoverConfigPaths() =\n%v\nwant\n%v", got, want)
+	}
+
+	if configPaths := DiscoverConfigPaths([]string{"/etc"}, configFiles, nil); len(configPaths) != 0 {
+		t.Errorf("DiscoverConfigPaths() without traced configuration files = %v, want none", configPaths)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -36,6 +37,42 @@ func GetListeningUDPPorts(inodeSet map[string]struct{}) []int {
 	return removeDuplicatePorts(append(udpPorts, udp6Ports...))
 }
 
+// GetConnectedTCPPorts retrieves the remote ports of the established TCP connections the process
+// opened, i.e. those whose local port is not one of its listening ports
+func GetConnectedTCPPorts(inodeSet map[string]struct{}, listeningPorts []int) []int {
+	tcpPorts := parseConnectedPortsFromNet(inodeSet, listeningPorts, "/proc/net/tcp")
+	tcp6Ports := parseConnectedPortsFromNet(inodeSet, listeningPorts, "/proc/net/tcp6")
+	ports := removeDuplicatePorts(append(tcpPorts, tcp6Ports...))
+	sort.Ints(ports)
+	return ports
+}
+
+// GetConnectedUnixSockets retrieves the paths of the Unix domain sockets the process is connected to as a client.
+// Client sockets have no path of their own, so the path is taken from the peer socket, via sock_diag.
+func GetConnectedUnixSockets(inodeSet map[string]struct{}) []string {
+	peers, names, err := queryUnixSocketPeers()
+	if err != nil {
+		log.Error("Failed to query Unix socket peers", "error", err)
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+	var socketPaths []string
+	for inode := range inodeSet {
+		if names[inode] != "" {
+			continue // Bound or accepted socket of the process itself
+		}
+		path := names[peers[inode]]
+		if _, exists := seen[path]; path == "" || exists {
+			continue
+		}
+		seen[path] = struct{}{}
+		socketPaths = append(socketPaths, path)
+	}
+	sort.Strings(socketPaths)
+	return socketPaths
+}
+
 // EnsureSocketDirectories ensures that the directories for the given socket paths exist
 // and sets their ownership to the specified user.
 func EnsureSocketDirectories(sockets []string, username string) {
@@ -115,7 +152,7 @@ func getProcessSocketInodes(processIDs []int) map[string]struct{} {
 // mapInodesToPaths maps inodes to their corresponding socket paths by parsing /proc/net/unix
 func mapInodesToPaths(inodeSet map[string]struct{}) []string {
 	var socketPaths []string
-	inodeToPath, err := parseProcNetUnix()
+	inodeToPath, err := parseProcNetUnix("/proc/net/unix")
 	if err != nil {
 		log.Error("Failed to parse /proc/net/unix", "error", err)
 	}
@@ -129,11 +166,11 @@ func mapInodesToPaths(inodeSet map[string]struct{}) []string {
 	return socketPaths
 }
 
-// parseProcNetUnix parses /proc/net/unix to build a map of inode to socket path
-func parseProcNetUnix() (map[string]string, error) {
+// parseProcNetUnix parses /proc/net/unix (or a file in its format) to build a map of inode to socket path
+func parseProcNetUnix(unixFilePath string) (map[string]string, error) {
 	inodeToPath := make(map[string]string)
 
-	file, err := os.Open("/proc/net/unix")
+	file, err := os.Open(unixFilePath)
 	if err != nil {
 		return nil, err
 	}
@@ -205,6 +242,45 @@ func parseListeningPortsFromNet(inodeSet map[string]struct{}, netFilePath string
 	return listeningPorts
 }
 
+// parseConnectedPortsFromNet parses a /proc/net/tcp* file for established connections of the process
+// and returns their remote ports, skipping connections accepted on one of the listening ports
+func parseConnectedPortsFromNet(inodeSet map[string]struct{}, listeningPorts []int, netFilePath string) []int {
+	file, err := os.Open(netFilePath)
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to open %s", netFilePath), "error", err)
+		return nil
+	}
+	defer file.Close()
+
+	var connectedPorts []int
+	scanner := bufio.NewScanner(file)
+
+	// Skip the header line
+	scanner.Scan()
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != "01" { // 01 == ESTABLISHED
+			continue
+		}
+		if _, exists := inodeSet[fields[9]]; !exists {
+			continue
+		}
+
+		// Connections to a listening port of the process are incoming
+		localPort := extractPortFromHex(fields[1])
+		incoming := false
+		for _, port := range listeningPorts {
+			incoming = incoming || port == localPort
+		}
+		if remotePort := extractPortFromHex(fields[2]); !incoming && remotePort > 0 {
+			connectedPorts = append(connectedPorts, remotePort)
+		}
+	}
+
+	return connectedPorts
+}
+
 // extractPortFromHex extracts the port from a hex-formatted "IP:PORT" string
 func extractPortFromHex(addrPort string) int {
 	parts := strings.Split(addrPort, ":")
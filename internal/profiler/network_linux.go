@@ -0,0 +1,92 @@
+//go:build linux
+
+package profiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// sock_diag constants for Unix sockets (linux/sock_diag.h, linux/unix_diag.h)
+const (
+	netlinkSockDiag   = 4  // NETLINK_SOCK_DIAG
+	sockDiagByFamily  = 20 // SOCK_DIAG_BY_FAMILY
+	unixDiagShowName  = 0x01
+	unixDiagShowPeer  = 0x04
+	unixDiagName      = 0 // UNIX_DIAG_NAME attribute
+	unixDiagPeer      = 2 // UNIX_DIAG_PEER attribute
+	unixDiagMsgLength = 16
+)
+
+// queryUnixSocketPeers dumps all Unix sockets with sock_diag and returns, by inode,
+// the inode of each connected socket's peer and the path of each named socket
+func queryUnixSocketPeers() (map[string]string, map[string]string, error) {
+	socket, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM, netlinkSockDiag)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer syscall.Close(socket)
+
+	// A netlink header followed by a unix_diag_req for all states
+	request := make([]byte, syscall.NLMSG_HDRLEN+24)
+	binary.LittleEndian.PutUint32(request[0:], uint32(len(request)))
+	binary.LittleEndian.PutUint16(request[4:], sockDiagByFamily)
+	binary.LittleEndian.PutUint16(request[6:], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	request[syscall.NLMSG_HDRLEN] = syscall.AF_UNIX
+	binary.LittleEndian.PutUint32(request[syscall.NLMSG_HDRLEN+4:], 0xffffffff)
+	binary.LittleEndian.PutUint32(request[syscall.NLMSG_HDRLEN+12:], unixDiagShowName|unixDiagShowPeer)
+	if err := syscall.Sendto(socket, request, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, nil, err
+	}
+
+	peers := make(map[string]string)
+	names := make(map[string]string)
+	buffer := make([]byte, 1<<16)
+	for {
+		length, _, err := syscall.Recvfrom(socket, buffer, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		messages, err := syscall.ParseNetlinkMessage(buffer[:length])
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, message := range messages {
+			switch message.Header.Type {
+			case syscall.NLMSG_DONE:
+				return peers, names, nil
+			case syscall.NLMSG_ERROR:
+				return nil, nil, fmt.Errorf("sock_diag request failed")
+			}
+			if len(message.Data) < unixDiagMsgLength {
+				continue
+			}
+
+			// unix_diag_msg, then route attributes
+			inode := strconv.FormatUint(uint64(binary.LittleEndian.Uint32(message.Data[4:])), 10)
+			attributes := message.Data[unixDiagMsgLength:]
+			for len(attributes) >= syscall.SizeofRtAttr {
+				attributeLength := int(binary.LittleEndian.Uint16(attributes))
+				if attributeLength < syscall.SizeofRtAttr || attributeLength > len(attributes) {
+					break
+				}
+				value := attributes[syscall.SizeofRtAttr:attributeLength]
+				switch binary.LittleEndian.Uint16(attributes[2:]) {
+				case unixDiagName:
+					// Abstract socket names start with a null byte and have no path
+					if len(value) > 0 && value[0] != 0 {
+						names[inode] = strings.TrimRight(string(value), "\x00")
+					}
+				case unixDiagPeer:
+					if len(value) >= 4 {
+						peers[inode] = strconv.FormatUint(uint64(binary.LittleEndian.Uint32(value)), 10)
+					}
+				}
+				attributes = attributes[(attributeLength+syscall.RTA_ALIGNTO-1)&^(syscall.RTA_ALIGNTO-1):]
+			}
+		}
+	}
+}
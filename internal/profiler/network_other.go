@@ -0,0 +1,13 @@
+//go:build !linux
+
+package profiler
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// queryUnixSocketPeers needs sock_diag, which only exists on Linux
+func queryUnixSocketPeers() (map[string]string, map[string]string, error) {
+	return nil, nil, fmt.Errorf("sock_diag is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,214 @@
+package profiler
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// nginxDirective is a directive of an nginx configuration file with its arguments
+type nginxDirective struct {
+	name      string
+	arguments []string
+	line      int
+}
+
+// defaultNginxPrefix is the prefix of nginx builds configured without --prefix
+const defaultNginxPrefix = "/usr/local/nginx"
+
+// nginxParser collects the paths referenced by an nginx configuration and its includes
+type nginxParser struct {
+	prefix          string // Prefix relative roots, aliases and logs are resolved against
+	configDirectory string // Directory relative includes and certificates are resolved against
+	visited         map[string]bool
+	paths           []ConfigPath
+}
+
+// parseNginxConfig returns the included files, document roots, aliases, certificates
+// and log files referenced by an nginx configuration. Relative paths use the prefix of the
+// profiled nginx executable.
+func parseNginxConfig(configFile string, executablePaths []string) []ConfigPath {
+	return newNginxParser(configFile, nginxPrefix(nginxExecutable(executablePaths))).parse(configFile)
+}
+
+// newNginxParser creates a parser for the configuration file of an nginx with the given prefix
+func newNginxParser(configFile, prefix string) *nginxParser {
+	return &nginxParser{prefix: prefix, configDirectory: filepath.Dir(configFile), visited: make(map[string]bool)}
+}
+
+// parse handles the configuration file and its includes and returns the referenced paths
+func (parser *nginxParser) parse(configFile string) []ConfigPath {
+	parser.parseFile(configFile)
+	return parser.paths
+}
+
+// nginxExecutable returns the profiled nginx executable, or "nginx" from the PATH if no
+// profiled process runs nginx
+func nginxExecutable(executablePaths []string) string {
+	for _, executablePath := range executablePaths {
+		if filepath.Base(executablePath) == "nginx" {
+			return executablePath
+		}
+	}
+	log.Debug("No profiled nginx executable, querying nginx from the PATH")
+	return "nginx"
+}
+
+// nginxPrefix returns the prefix of the given nginx executable, e.g. "/usr/share/nginx" on Debian
+func nginxPrefix(executablePath string) string {
+	output, err := exec.Command(executablePath, "-V").CombinedOutput()
+	if err != nil {
+		log.Warn("Failed to query the nginx prefix, using the default", "executable", executablePath, "prefix", defaultNginxPrefix, "error", err)
+		return defaultNginxPrefix
+	}
+	return parseNginxPrefix(string(output))
+}
+
+// parseNginxPrefix returns the --prefix configure argument shown by "nginx -V"
+func parseNginxPrefix(versionOutput string) string {
+	for _, field := range strings.Fields(versionOutput) {
+		if prefix, found := strings.CutPrefix(field, "--prefix="); found {
+			return strings.TrimSuffix(prefix, "/")
+		}
+	}
+	return defaultNginxPrefix
+}
+
+// parseFile handles the directives of one configuration file
+func (parser *nginxParser) parseFile(configFile string) {
+	if parser.visited[configFile] {
+		return
+	}
+	parser.visited[configFile] = true
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		log.Warn("Failed to read nginx configuration", "file", configFile, "error", err)
+		return
+	}
+
+	for _, directive := range tokenizeNginxConfig(string(data)) {
+		if len(directive.arguments) == 0 {
+			continue
+		}
+		argument := directive.arguments[0]
+
+		switch {
+		case directive.name == "include":
+			pattern := argument
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(parser.configDirectory, pattern)
+			}
+			matches, _ := filepath.Glob(pattern)
+			for _, match := range matches {
+				// The matches are resolved already
+				parser.add(match, "", directive, configFile)
+				parser.parseFile(match)
+			}
+
+		case directive.name == "root" || directive.name == "alias":
+			parser.add(stripNginxVariables(argument), parser.prefix, directive, configFile)
+
+		case strings.HasPrefix(directive.name, "ssl_certificate"):
+			// Certificates may also be given inline ("data:") or by an engine ("engine:")
+			if !strings.Contains(argument, ":") {
+				parser.add(stripNginxVariables(argument), parser.configDirectory, directive, configFile)
+			}
+
+		case directive.name == "error_log" || directive.name == "access_log":
+			// Skip disabled logs and targets that are not files, e.g. "stderr" or "syslog:server=..."
+			if argument != "off" && argument != "stderr" && !strings.Contains(argument, ":") {
+				parser.add(stripNginxVariables(argument), parser.prefix, directive, configFile)
+			}
+		}
+	}
+}
+
+// add records a path referenced by a directive, resolved against baseDirectory if it is relative,
+// unless it is empty after removing variables
+func (parser *nginxParser) add(path, baseDirectory string, directive nginxDirective, configFile string) {
+	if path != "" {
+		parser.paths = append(parser.paths, newConfigPath(path, baseDirectory, directive.name, configFile, directive.line))
+	}
+}
+
+// stripNginxVariables cuts a path before its first segment containing a variable,
+// e.g. "/var/www/$host/html" becomes "/var/www"
+func stripNginxVariables(path string) string {
+	index := strings.Index(path, "$")
+	if index < 0 {
+		return path
+	}
+	return strings.TrimSuffix(path[:strings.LastIndex(path[:index], "/")+1], "/")
+}
+
+// tokenizeNginxConfig splits an nginx configuration into directives.
+// Blocks are flattened: the directive opening a block ends at "{".
+func tokenizeNginxConfig(content string) []nginxDirective {
+	var directives []nginxDirective
+	var current nginxDirective
+	var token strings.Builder
+	inToken := false
+	line := 1
+
+	endToken := func() {
+		if !inToken {
+			return
+		}
+		if current.name == "" {
+			current.name = token.String()
+			current.line = line
+		} else {
+			current.arguments = append(current.arguments, token.String())
+		}
+		token.Reset()
+		inToken = false
+	}
+	endDirective := func() {
+		endToken()
+		if current.name != "" {
+			directives = append(directives, current)
+		}
+		current = nginxDirective{}
+	}
+
+	for i := 0; i < len(content); i++ {
+		character := content[i]
+		switch {
+		case character == '\n':
+			endToken()
+			line++
+		case character == ' ' || character == '\t' || character == '\r':
+			endToken()
+		case character == '#' && !inToken:
+			// Skip the comment up to the end of the line
+			for i+1 < len(content) && content[i+1] != '\n' {
+				i++
+			}
+		case character == ';' || character == '{':
+			endDirective()
+		case character == '}':
+			endDirective()
+		case (character == '"' || character == '\'') && !inToken:
+			// Quoted token, with backslash escapes
+			inToken = true
+			for i++; i < len(content) && content[i] != character; i++ {
+				if content[i] == '\\' && i+1 < len(content) {
+					i++
+				}
+				if content[i] == '\n' {
+					line++
+				}
+				token.WriteByte(content[i])
+			}
+		default:
+			token.WriteByte(character)
+			inToken = true
+		}
+	}
+	endDirective()
+	return directives
+}
@@ -0,0 +1,75 @@
+package profiler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNginxParser(t *testing.T) {
+	type reference struct{ path, directive, origin string }
+
+	configPaths := newNginxParser("testdata/nginx/nginx.conf", "/usr/share/nginx").parse("testdata/nginx/nginx.conf")
+	got := make([]reference, 0, len(configPaths))
+	for _, configPath := range configPaths {
+		got = append(got, reference{configPath.Path, configPath.Directive, configPath.Origin})
+	}
+
+	// Includes and certificates are relative to the configuration directory, roots, aliases and logs to the prefix
+	want := []reference{
+		{"/usr/share/nginx/logs/error.log", "error_log", "testdata/nginx/nginx.conf:2"},
+		{"testdata/nginx/mime.types", "include", "testdata/nginx/nginx.conf:5"},
+		{"testdata/nginx/conf.d/site.conf", "include", "testdata/nginx/nginx.conf:6"},
+		{"/usr/share/nginx/html", "root", "testdata/nginx/conf.d/site.conf:3"},
+		{"testdata/nginx/certs/site.pem", "ssl_certificate", "testdata/nginx/conf.d/site.conf:4"},
+		{"/srv/static", "alias", "testdata/nginx/conf.d/site.conf:9"},
+		{"/usr/share/nginx/media files", "alias", "testdata/nginx/conf.d/site.conf:12"},
+		{"/var/log/nginx/access.log", "access_log", "testdata/nginx/nginx.conf:7"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parse() =\n%v\nwant\n%v", got, want)
+	}
+
+	if !configPaths[4].Exists {
+		t.Errorf("parse() reports %s as missing", configPaths[4].Path)
+	}
+}
+
+func TestParseNginxPrefix(t *testing.T) {
+	tests := []struct {
+		versionOutput string
+		want          string
+	}{
+		{"nginx version: nginx/1.22.1\nconfigure arguments: --with-cc-opt='-O2' --prefix=/usr/share/nginx --conf-path=/etc/nginx/nginx.conf", "/usr/share/nginx"},
+		{"configure arguments: --prefix=/var/lib/nginx/ --sbin-path=/usr/sbin/nginx", "/var/lib/nginx"},
+		{"nginx version: nginx/1.25.3\nconfigure arguments: --with-http_ssl_module", defaultNginxPrefix},
+	}
+
+	for _, test := range tests {
+		if prefix := parseNginxPrefix(test.versionOutput); prefix != test.want {
+			t.Errorf("parseNginxPrefix(%q) = %q, want %q", test.versionOutput, prefix, test.want)
+		}
+	}
+}
+
+func TestNginxPrefixOfProfiledExecutable(t *testing.T) {
+	// A profiled nginx that is not on the PATH, built with its own prefix
+	executablePath := filepath.Join(t.TempDir(), "nginx")
+	script := "#!/bin/sh\necho 'nginx version: nginx/1.24.0' >&2\necho 'configure arguments: --prefix=/opt/nginx/' >&2\n"
+	if err := os.WriteFile(executablePath, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	executable := nginxExecutable([]string{"/usr/sbin/php-fpm8.2", executablePath})
+	if executable != executablePath {
+		t.Fatalf("nginxExecutable() = %q, want %q", executable, executablePath)
+	}
+	if prefix := nginxPrefix(executable); prefix != "/opt/nginx" {
+		t.Errorf("nginxPrefix(%q) = %q, want %q", executable, prefix, "/opt/nginx")
+	}
+
+	if executable := nginxExecutable([]string{"/usr/sbin/php-fpm8.2"}); executable != "nginx" {
+		t.Errorf("nginxExecutable() without a profiled nginx = %q, want %q", executable, "nginx")
+	}
+}
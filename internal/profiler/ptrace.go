@@ -0,0 +1,561 @@
+//go:build linux
+
+package profiler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// ptraceOptions follows forks, clones and execs and marks syscall stops with bit 0x80
+	ptraceOptions = syscall.PTRACE_O_TRACESYSGOOD | syscall.PTRACE_O_TRACECLONE |
+		syscall.PTRACE_O_TRACEFORK | syscall.PTRACE_O_TRACEVFORK | syscall.PTRACE_O_TRACEEXEC
+	// syscallStopSignal is the stop signal reported for syscall stops with PTRACE_O_TRACESYSGOOD
+	syscallStopSignal = syscall.SIGTRAP | 0x80
+	// maxPathLength bounds the number of bytes read for a single path argument
+	maxPathLength = 4096
+	// tracePollInterval is the pause between two rounds over the tracees in which none had stopped
+	tracePollInterval = time.Millisecond
+)
+
+// ptraceTracer is a pure-Go Tracer built on the ptrace system call.
+// All ptrace requests are issued from a single locked OS thread, as the kernel requires.
+type ptraceTracer struct {
+	logfilePath string
+	logWriter   *bufio.Writer
+	events      chan SyscallEvent
+	stopping    atomic.Bool
+	done        chan error
+	traceesLock sync.Mutex // Guards tracees, which Stop reads from another goroutine
+	tracees     map[int]*traceeState
+	launched    *exec.Cmd // Child started by Start, reaped once it is no longer traced
+}
+
+// traceeState tracks the syscall in progress for a single traced thread
+type traceeState struct {
+	inSyscall      bool
+	tracked        bool
+	event          SyscallEvent
+	pendingStartup bool // New child whose initial SIGSTOP has not been reported yet
+	stopSent       bool // SIGSTOP sent to detach the thread
+}
+
+// newPtraceTracer creates a ptrace-backed tracer writing its raw log to logfilePath.
+// The tracer requires root: the strace backend runs strace, and the application it starts,
+// through sudo, and both backends must start the application with the same privileges.
+func newPtraceTracer(logfilePath string) (*ptraceTracer, error) {
+	if !ptraceSupported {
+		return nil, fmt.Errorf("ptrace tracer is not supported on %s", runtime.GOARCH)
+	}
+	if os.Geteuid() != 0 {
+		return nil, errors.New("the ptrace tracer must run as root, as the strace backend does through sudo")
+	}
+	return &ptraceTracer{
+		logfilePath: logfilePath,
+		events:      make(chan SyscallEvent, 1024),
+		done:        make(chan error, 1),
+	}, nil
+}
+
+// Start launches the application as a ptrace child and traces it
+func (tracer *ptraceTracer) Start(info *ProcessInfo) error {
+	return tracer.run(func() (map[int]*traceeState, error) {
+		// Use setsid to start the process in a new session, mirroring the strace backend
+		command := exec.Command("bash", "-c", fmt.Sprintf("setsid %s", info.ReconstructedCommand))
+		command.Dir = info.WorkingDirectory
+		command.Env = info.EnvironmentVariables
+		command.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+		if err := command.Start(); err != nil {
+			return nil, err
+		}
+		tracer.launched = command
+
+		// The child stops with SIGTRAP on its first execve
+		processID := command.Process.Pid
+		if err := waitForStop(processID); err != nil {
+			return nil, err
+		}
+		if err := initializeTracee(processID); err != nil {
+			return nil, err
+		}
+		return map[int]*traceeState{processID: {}}, nil
+	})
+}
+
+// Attach attaches to every thread of the given running processes
+func (tracer *ptraceTracer) Attach(processIDs []int) error {
+	return tracer.run(func() (map[int]*traceeState, error) {
+		tracees := make(map[int]*traceeState)
+		for _, processID := range processIDs {
+			for _, threadID := range getThreadIDs(processID) {
+				if err := syscall.PtraceAttach(threadID); err != nil {
+					log.Error(fmt.Sprintf("Failed to attach to thread %d", threadID), "error", err)
+					continue
+				}
+				if err := waitForStop(threadID); err != nil {
+					log.Error(fmt.Sprintf("Failed to wait for thread %d", threadID), "error", err)
+					continue
+				}
+				if err := initializeTracee(threadID); err != nil {
+					log.Error(fmt.Sprintf("Failed to trace thread %d", threadID), "error", err)
+					continue
+				}
+				tracees[threadID] = &traceeState{}
+			}
+		}
+		if len(tracees) == 0 {
+			return nil, errors.New("failed to attach to any thread")
+		}
+		return tracees, nil
+	})
+}
+
+// Events returns the stream of observed syscall events
+func (tracer *ptraceTracer) Events() <-chan SyscallEvent {
+	return tracer.events
+}
+
+// Stop detaches from all tracees and waits for the tracing loop to finish.
+// Every tracee is sent a SIGSTOP, which the tracing loop suppresses when it detaches the tracee.
+// New children still waiting for their initial SIGSTOP are detached at that stop instead.
+func (tracer *ptraceTracer) Stop() error {
+	tracer.stopping.Store(true)
+	tracer.traceesLock.Lock()
+	for threadID, state := range tracer.tracees {
+		if !state.pendingStartup {
+			tracer.sendDetachStop(threadID, state)
+		}
+	}
+	tracer.traceesLock.Unlock()
+	return <-tracer.done
+}
+
+// sendDetachStop sends the SIGSTOP a tracee is detached at, once; the caller holds traceesLock.
+// A second SIGSTOP would be delivered after the detach and stop the application.
+func (tracer *ptraceTracer) sendDetachStop(threadID int, state *traceeState) {
+	if !state.stopSent {
+		state.stopSent = true
+		stopThread(threadID)
+	}
+}
+
+// setTracee adds or replaces the state of a tracee, or removes it for a nil state
+func (tracer *ptraceTracer) setTracee(threadID int, state *traceeState) {
+	tracer.traceesLock.Lock()
+	defer tracer.traceesLock.Unlock()
+	if state == nil {
+		delete(tracer.tracees, threadID)
+	} else {
+		tracer.tracees[threadID] = state
+	}
+}
+
+// run sets up the tracees on a locked OS thread and keeps that thread for the tracing loop
+func (tracer *ptraceTracer) run(setup func() (map[int]*traceeState, error)) error {
+	logFile, err := os.Create(tracer.logfilePath)
+	if err != nil {
+		return err
+	}
+	tracer.logWriter = bufio.NewWriter(logFile)
+
+	ready := make(chan error, 1)
+	go func() {
+		// The thread is never unlocked: it is discarded together with its ptrace state
+		runtime.LockOSThread()
+
+		defer logFile.Close()
+		defer tracer.logWriter.Flush()
+		defer close(tracer.events)
+
+		tracees, err := setup()
+		ready <- err
+		if err != nil {
+			tracer.done <- err
+			return
+		}
+		tracer.traceesLock.Lock()
+		tracer.tracees = tracees
+		tracer.traceesLock.Unlock()
+		err = tracer.traceLoop()
+		tracer.reapLaunched()
+		tracer.done <- err
+	}()
+
+	return <-ready
+}
+
+// traceLoop handles ptrace stops until all tracees have exited or been detached.
+// It waits for each known tracee rather than for any child, so the exit status of the other children
+// of the profiler (workload scripts, sudo helpers) is left to their exec.Cmd. New children become known
+// through the fork, vfork and clone events of their parent. Stop ends the loop with the SIGSTOPs
+// the tracees are detached at.
+func (tracer *ptraceTracer) traceLoop() error {
+	for {
+		threadIDs := tracer.traceeIDs()
+		if len(threadIDs) == 0 {
+			return nil
+		}
+
+		stopped := false
+		for _, threadID := range threadIDs {
+			var status syscall.WaitStatus
+			waitedID, err := syscall.Wait4(threadID, &status, syscall.WALL|syscall.WNOHANG, nil)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err == syscall.ECHILD {
+				// The thread is gone, e.g. replaced by its thread group leader on execve
+				tracer.setTracee(threadID, nil)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if waitedID == threadID {
+				stopped = true
+				tracer.handleWaitStatus(threadID, status)
+			}
+		}
+
+		// Sleep only when no tracee had anything to report, so busy tracees are not slowed down
+		if !stopped {
+			time.Sleep(tracePollInterval)
+		}
+	}
+}
+
+// reapLaunched waits for the child started by Start once it has been detached, so it does not stay
+// a zombie. A child that exited while traced was already reaped by the tracing loop.
+func (tracer *ptraceTracer) reapLaunched() {
+	if tracer.launched == nil {
+		return
+	}
+	go tracer.launched.Wait()
+}
+
+// traceeIDs returns the thread IDs of the current tracees
+func (tracer *ptraceTracer) traceeIDs() []int {
+	tracer.traceesLock.Lock()
+	defer tracer.traceesLock.Unlock()
+	threadIDs := make([]int, 0, len(tracer.tracees))
+	for threadID := range tracer.tracees {
+		threadIDs = append(threadIDs, threadID)
+	}
+	return threadIDs
+}
+
+// handleWaitStatus handles the exit or ptrace stop of a tracee and resumes it
+func (tracer *ptraceTracer) handleWaitStatus(threadID int, status syscall.WaitStatus) {
+	// Forget tracees that have exited
+	if status.Exited() || status.Signaled() {
+		tracer.setTracee(threadID, nil)
+		if tracer.launched != nil && threadID == tracer.launched.Process.Pid {
+			tracer.launched = nil
+		}
+		return
+	}
+	if !status.Stopped() {
+		return
+	}
+
+	detaching := tracer.stopping.Load()
+	tracer.traceesLock.Lock()
+	state := tracer.tracees[threadID]
+	tracer.traceesLock.Unlock()
+
+	signal := status.StopSignal()
+	switch {
+	case signal == syscallStopSignal:
+		tracer.handleSyscallStop(threadID, state)
+		syscall.PtraceSyscall(threadID, 0)
+
+	case signal == syscall.SIGTRAP && status.TrapCause() > 0:
+		tracer.handleEventStop(threadID, status.TrapCause(), detaching)
+		syscall.PtraceSyscall(threadID, 0)
+
+	case signal == syscall.SIGSTOP && detaching:
+		// Suppress the SIGSTOP and let the thread run untraced
+		syscall.PtraceDetach(threadID)
+		tracer.setTracee(threadID, nil)
+
+	case signal == syscall.SIGSTOP && state.pendingStartup:
+		// New children start with a SIGSTOP that must be suppressed
+		tracer.setTracee(threadID, &traceeState{})
+		syscall.PtraceSyscall(threadID, 0)
+
+	case isStopSignal(signal) && isGroupStop(threadID):
+		// A group-stop reports a stop signal that was already delivered; injecting it again would
+		// turn it into a new signal-delivery stop. Resume without it, as strace does without PTRACE_SEIZE.
+		syscall.PtraceSyscall(threadID, 0)
+
+	default:
+		// Deliver any other signal to the tracee
+		syscall.PtraceSyscall(threadID, int(signal))
+	}
+}
+
+// handleEventStop registers new children reported by fork, vfork and clone events
+func (tracer *ptraceTracer) handleEventStop(threadID, cause int, detaching bool) {
+	if cause != syscall.PTRACE_EVENT_CLONE && cause != syscall.PTRACE_EVENT_FORK && cause != syscall.PTRACE_EVENT_VFORK {
+		return
+	}
+	message, err := syscall.PtraceGetEventMsg(threadID)
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to read new child of thread %d", threadID), "error", err)
+		return
+	}
+	childID := int(message)
+	tracer.emitForkEvent(threadID, childID, cause)
+	tracer.traceesLock.Lock()
+	defer tracer.traceesLock.Unlock()
+	if state, known := tracer.tracees[childID]; !known {
+		// The child's initial SIGSTOP is still pending; it doubles as the detach stop
+		tracer.tracees[childID] = &traceeState{pendingStartup: true}
+	} else if detaching {
+		// The child already started running and needs its own SIGSTOP to be released
+		tracer.sendDetachStop(childID, state)
+	}
+}
+
+// emitForkEvent reports the creation of a child as a fork, vfork or clone event.
+// Threads (children in the same thread group) are flagged as sharing the parent's filesystem state.
+func (tracer *ptraceTracer) emitForkEvent(threadID, childID, cause int) {
+	event := SyscallEvent{PID: threadID, Timestamp: time.Now(), ReturnValue: int64(childID)}
+	switch cause {
+	case syscall.PTRACE_EVENT_FORK:
+		event.Syscall = "fork"
+	case syscall.PTRACE_EVENT_VFORK:
+		event.Syscall = "vfork"
+	default:
+		event.Syscall = "clone"
+		if getThreadGroupID(childID) == getThreadGroupID(threadID) {
+			event.Flags = []string{"CLONE_FS", "CLONE_THREAD"}
+		}
+		event.Arguments = []string{"flags=" + strings.Join(event.Flags, "|")}
+	}
+	tracer.writeRawLine(event)
+	tracer.events <- event
+}
+
+// handleSyscallStop records path arguments on syscall entry and emits the event on exit
+func (tracer *ptraceTracer) handleSyscallStop(threadID int, state *traceeState) {
+	var registers syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(threadID, &registers); err != nil {
+		return
+	}
+
+	// Syscall entry: decode the call and its arguments
+	if !state.inSyscall && !isSyscallExit(&registers) {
+		state.inSyscall = true
+		name, tracked := syscallNames[syscallNumber(&registers)]
+		state.tracked = tracked
+		if tracked {
+			state.event = decodeSyscallEntry(threadID, name, &registers)
+		}
+		return
+	}
+
+	// Syscall exit: complete and emit the event
+	state.inSyscall = false
+	if !state.tracked {
+		return
+	}
+	event := state.event
+	event.ReturnValue = syscallReturnValue(&registers)
+	if event.ReturnValue < 0 && event.ReturnValue > -4096 {
+		errno := uint64(-event.ReturnValue)
+		event.Errno = errnoNames[errno]
+		if event.Errno == "" {
+			event.Errno = "E" + strconv.FormatUint(errno, 10)
+		}
+		event.ReturnValue = -1
+	}
+	tracer.writeRawLine(event)
+	tracer.events <- event
+}
+
+// writeRawLine appends the event to the raw log in "strace -f -ttt" format, so it can be re-parsed
+func (tracer *ptraceTracer) writeRawLine(event SyscallEvent) {
+	timestamp := float64(event.Timestamp.UnixNano()) / 1e9
+	line := fmt.Sprintf("%d  %.6f %s(%s) = %d", event.PID, timestamp, event.Syscall, strings.Join(event.Arguments, ", "), event.ReturnValue)
+	if event.Errno != "" {
+		line += " " + event.Errno
+	}
+	tracer.logWriter.WriteString(line + "\n")
+}
+
+// decodeSyscallEntry builds an event from the registers at syscall entry, reading path arguments from memory
+func decodeSyscallEntry(threadID int, name string, registers *syscall.PtraceRegs) SyscallEvent {
+	event := SyscallEvent{PID: threadID, Timestamp: time.Now(), Syscall: name}
+	spec := syscallSpecs[name]
+
+	// Collect the file descriptor arguments, which are annotated with their paths like "strace -y"
+	descriptorArguments := slices.Clone(spec.dirfdArguments)
+	if fdArgument, found := fdArguments[name]; found {
+		descriptorArguments = append(descriptorArguments, fdArgument)
+	}
+
+	// Decode arguments up to the last path, descriptor or flags argument
+	argumentCount := spec.flagArgument + 1
+	for _, argumentIndex := range append(slices.Clone(spec.pathArguments), descriptorArguments...) {
+		argumentCount = max(argumentCount, argumentIndex+1)
+	}
+	for argumentIndex := 0; argumentIndex < argumentCount; argumentIndex++ {
+		value := syscallArgument(registers, argumentIndex)
+		switch {
+		case slices.Contains(descriptorArguments, argumentIndex):
+			event.Arguments = append(event.Arguments, formatDescriptorArgument(threadID, value))
+		case slices.Contains(spec.pathArguments, argumentIndex):
+			path := readString(threadID, uintptr(value))
+			event.Paths = append(event.Paths, path)
+			event.Arguments = append(event.Arguments, quoteStraceString(path))
+		case argumentIndex == spec.flagArgument && isOpenCall(name):
+			if name == "openat2" {
+				// openat2 passes a struct open_how whose first field holds the flags
+				value = readWord(threadID, uintptr(value))
+			}
+			event.Flags = decodeOpenFlags(value)
+			event.Arguments = append(event.Arguments, strings.Join(event.Flags, "|"))
+		default:
+			event.Arguments = append(event.Arguments, formatSyscallArgument(value))
+		}
+	}
+
+	return event
+}
+
+// formatDescriptorArgument prints a file descriptor with its path annotation, e.g. "3</var/lib/mysql>"
+func formatDescriptorArgument(threadID int, value uint64) string {
+	descriptor := int32(value)
+	if descriptor == -100 {
+		return "AT_FDCWD"
+	}
+	target, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", threadID, descriptor))
+	if err != nil {
+		return strconv.Itoa(int(descriptor))
+	}
+	return fmt.Sprintf("%d<%s>", descriptor, target)
+}
+
+// formatSyscallArgument prints an integer argument the way strace does for common values
+func formatSyscallArgument(value uint64) string {
+	if int32(value) == -100 {
+		return "AT_FDCWD"
+	}
+	if value < 1<<32 {
+		return strconv.FormatInt(int64(int32(value)), 10)
+	}
+	return fmt.Sprintf("0x%x", value)
+}
+
+// quoteStraceString quotes a string with C escapes, matching strace's output
+func quoteStraceString(value string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		character := value[i]
+		switch {
+		case character == '"' || character == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteByte(character)
+		case character == '\n':
+			quoted.WriteString("\\n")
+		case character == '\t':
+			quoted.WriteString("\\t")
+		case character < 0x20 || character >= 0x7f:
+			fmt.Fprintf(&quoted, "\\%03o", character)
+		default:
+			quoted.WriteByte(character)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+// initializeTracee sets the tracing options and resumes the tracee until its next syscall
+func initializeTracee(threadID int) error {
+	if err := syscall.PtraceSetOptions(threadID, ptraceOptions); err != nil {
+		return err
+	}
+	return syscall.PtraceSyscall(threadID, 0)
+}
+
+// waitForStop waits until the given thread enters a ptrace stop
+func waitForStop(threadID int) error {
+	var status syscall.WaitStatus
+	if _, err := syscall.Wait4(threadID, &status, syscall.WALL, nil); err != nil {
+		return err
+	}
+	if !status.Stopped() {
+		return fmt.Errorf("thread %d did not stop (status %v)", threadID, status)
+	}
+	return nil
+}
+
+// isStopSignal checks if the signal stops the thread group by default
+func isStopSignal(signal syscall.Signal) bool {
+	return signal == syscall.SIGSTOP || signal == syscall.SIGTSTP || signal == syscall.SIGTTIN || signal == syscall.SIGTTOU
+}
+
+// isGroupStop tells a group-stop apart from a signal-delivery stop of the same signal:
+// PTRACE_GETSIGINFO fails with EINVAL in a group-stop, as there is no signal to deliver.
+func isGroupStop(threadID int) bool {
+	var signalInfo [128]byte
+	_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_GETSIGINFO, uintptr(threadID), 0, uintptr(unsafe.Pointer(&signalInfo[0])), 0, 0)
+	return errno == syscall.EINVAL
+}
+
+// stopThread sends SIGSTOP to a single thread rather than to its whole thread group
+func stopThread(threadID int) {
+	syscall.Syscall(syscall.SYS_TKILL, uintptr(threadID), uintptr(syscall.SIGSTOP), 0)
+}
+
+// readWord reads a single machine word from the tracee's memory
+func readWord(threadID int, address uintptr) uint64 {
+	buffer := make([]byte, 8)
+	if _, err := syscall.PtracePeekData(threadID, address, buffer); err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(buffer)
+}
+
+// readString reads a NUL-terminated string from the tracee's memory.
+// Reads never cross a page boundary, so a string ending just before unmapped memory is still read.
+func readString(threadID int, address uintptr) string {
+	pageSize := uintptr(os.Getpagesize())
+	var result []byte
+
+	for len(result) < maxPathLength {
+		chunkSize := pageSize - address%pageSize
+		if chunkSize > 256 {
+			chunkSize = 256
+		}
+		buffer := make([]byte, chunkSize)
+		count, err := syscall.PtracePeekData(threadID, address, buffer)
+		if err != nil || count == 0 {
+			break
+		}
+		if end := strings.IndexByte(string(buffer[:count]), 0); end >= 0 {
+			return string(append(result, buffer[:end]...))
+		}
+		result = append(result, buffer[:count]...)
+		address += uintptr(count)
+	}
+	return string(result)
+}
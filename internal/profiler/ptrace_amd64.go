@@ -0,0 +1,56 @@
+//go:build linux && amd64
+
+package profiler
+
+import "syscall"
+
+// ptraceSupported reports whether the native ptrace tracer is available on this architecture
+const ptraceSupported = true
+
+// syscallNames maps x86_64 system call numbers to the names of traced file-related calls.
+var syscallNames = map[uint64]string{
+	2: "open", 4: "stat", 6: "lstat", 21: "access", 59: "execve", 76: "truncate", 80: "chdir", 81: "fchdir",
+	82: "rename", 83: "mkdir", 84: "rmdir", 85: "creat", 86: "link", 87: "unlink", 88: "symlink",
+	89: "readlink", 90: "chmod", 92: "chown", 94: "lchown", 132: "utime", 133: "mknod", 137: "statfs",
+	161: "chroot", 165: "mount", 166: "umount2", 188: "setxattr", 189: "lsetxattr", 191: "getxattr",
+	192: "lgetxattr", 194: "listxattr", 195: "llistxattr", 197: "removexattr", 198: "lremovexattr",
+	235: "utimes", 254: "inotify_add_watch", 257: "openat", 258: "mkdirat", 259: "mknodat",
+	260: "fchownat", 261: "futimesat", 262: "newfstatat", 263: "unlinkat", 264: "renameat",
+	265: "linkat", 266: "symlinkat", 267: "readlinkat", 268: "fchmodat", 269: "faccessat",
+	280: "utimensat", 303: "name_to_handle_at", 316: "renameat2", 322: "execveat", 332: "statx",
+	437: "openat2", 439: "faccessat2", 452: "fchmodat2",
+}
+
+// syscallNumber returns the system call number from the registers at a syscall stop
+func syscallNumber(registers *syscall.PtraceRegs) uint64 {
+	return registers.Orig_rax
+}
+
+// syscallArgument returns the n-th system call argument from the registers at syscall entry
+func syscallArgument(registers *syscall.PtraceRegs, n int) uint64 {
+	switch n {
+	case 0:
+		return registers.Rdi
+	case 1:
+		return registers.Rsi
+	case 2:
+		return registers.Rdx
+	case 3:
+		return registers.R10
+	case 4:
+		return registers.R8
+	default:
+		return registers.R9
+	}
+}
+
+// syscallReturnValue returns the system call result from the registers at syscall exit
+func syscallReturnValue(registers *syscall.PtraceRegs) int64 {
+	return int64(registers.Rax)
+}
+
+// isSyscallExit reports whether the registers definitely belong to a syscall-exit stop.
+// On x86_64 the kernel sets rax to -ENOSYS on entry, so any other value marks an exit.
+func isSyscallExit(registers *syscall.PtraceRegs) bool {
+	return int64(registers.Rax) != -int64(syscall.ENOSYS)
+}
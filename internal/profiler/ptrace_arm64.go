@@ -0,0 +1,40 @@
+//go:build linux && arm64
+
+package profiler
+
+import "syscall"
+
+// ptraceSupported reports whether the native ptrace tracer is available on this architecture
+const ptraceSupported = true
+
+// syscallNames maps arm64 system call numbers to the names of traced file-related calls.
+var syscallNames = map[uint64]string{
+	5: "setxattr", 6: "lsetxattr", 8: "getxattr", 9: "lgetxattr", 11: "listxattr", 12: "llistxattr",
+	14: "removexattr", 15: "lremovexattr", 27: "inotify_add_watch", 33: "mknodat", 34: "mkdirat",
+	35: "unlinkat", 36: "symlinkat", 37: "linkat", 38: "renameat", 39: "umount2", 40: "mount",
+	43: "statfs", 45: "truncate", 48: "faccessat", 49: "chdir", 50: "fchdir", 51: "chroot", 53: "fchmodat",
+	54: "fchownat", 56: "openat", 78: "readlinkat", 79: "newfstatat", 88: "utimensat", 221: "execve",
+	264: "name_to_handle_at", 276: "renameat2", 281: "execveat", 291: "statx", 437: "openat2",
+	439: "faccessat2", 452: "fchmodat2",
+}
+
+// syscallNumber returns the system call number from the registers at a syscall stop
+func syscallNumber(registers *syscall.PtraceRegs) uint64 {
+	return registers.Regs[8]
+}
+
+// syscallArgument returns the n-th system call argument from the registers at syscall entry
+func syscallArgument(registers *syscall.PtraceRegs, n int) uint64 {
+	return registers.Regs[n]
+}
+
+// syscallReturnValue returns the system call result from the registers at syscall exit
+func syscallReturnValue(registers *syscall.PtraceRegs) int64 {
+	return int64(registers.Regs[0])
+}
+
+// isSyscallExit reports whether the registers definitely belong to a syscall-exit stop.
+// arm64 offers no such marker, so entry and exit stops are told apart by alternation.
+func isSyscallExit(registers *syscall.PtraceRegs) bool {
+	return false
+}
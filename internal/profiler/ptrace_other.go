@@ -0,0 +1,31 @@
+//go:build linux && !amd64 && !arm64
+
+package profiler
+
+import "syscall"
+
+// ptraceSupported reports whether the native ptrace tracer is available on this architecture
+const ptraceSupported = false
+
+// syscallNames is empty on architectures without a syscall table.
+var syscallNames = map[uint64]string{}
+
+// syscallNumber is unavailable on this architecture
+func syscallNumber(registers *syscall.PtraceRegs) uint64 {
+	return 0
+}
+
+// syscallArgument is unavailable on this architecture
+func syscallArgument(registers *syscall.PtraceRegs, n int) uint64 {
+	return 0
+}
+
+// syscallReturnValue is unavailable on this architecture
+func syscallReturnValue(registers *syscall.PtraceRegs) int64 {
+	return 0
+}
+
+// isSyscallExit is unavailable on this architecture
+func isSyscallExit(registers *syscall.PtraceRegs) bool {
+	return false
+}
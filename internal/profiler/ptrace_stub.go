@@ -0,0 +1,13 @@
+//go:build !linux
+
+package profiler
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newPtraceTracer reports that the native ptrace tracer is only available on Linux
+func newPtraceTracer(logfilePath string) (Tracer, error) {
+	return nil, fmt.Errorf("ptrace tracer is not supported on %s", runtime.GOOS)
+}
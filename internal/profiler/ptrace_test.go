@@ -0,0 +1,129 @@
+//go:build linux
+
+package profiler
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPtraceTracerLeavesOtherChildren(t *testing.T) {
+	if !ptraceSupported {
+		t.Skip("ptrace tracer is not supported on this architecture")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("the ptrace tracer requires root")
+	}
+	tracer, err := newPtraceTracer(filepath.Join(t.TempDir(), "ptrace_raw.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &ProcessInfo{ReconstructedCommand: "sleep 5", WorkingDirectory: "/", EnvironmentVariables: os.Environ()}
+	if err := tracer.Start(info); err != nil {
+		t.Skipf("ptrace is not available: %v", err)
+	}
+	for _, threadID := range tracer.traceeIDs() {
+		t.Cleanup(func() { syscall.Kill(threadID, syscall.SIGKILL) })
+	}
+	drained := make(chan struct{})
+	go func() {
+		for range tracer.Events() {
+		}
+		close(drained)
+	}()
+
+	// Children of the profiler that are not traced keep their exit status, like workload scripts
+	for i := 0; i < 50; i++ {
+		if err := exec.Command("true").Run(); err != nil {
+			t.Fatalf("untraced child %d: %v", i, err)
+		}
+		if err := exec.Command("false").Run(); err == nil {
+			t.Fatalf("untraced child %d lost its exit status", i)
+		}
+	}
+
+	if err := tracer.Stop(); err != nil {
+		t.Errorf("Stop() = %v", err)
+	}
+	<-drained
+}
+
+func TestPtraceTracerReapsLaunchedChild(t *testing.T) {
+	if !ptraceSupported {
+		t.Skip("ptrace tracer is not supported on this architecture")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("the ptrace tracer requires root")
+	}
+	tracer, err := newPtraceTracer(filepath.Join(t.TempDir(), "ptrace_raw.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &ProcessInfo{ReconstructedCommand: "sleep 0.5", WorkingDirectory: "/", EnvironmentVariables: os.Environ()}
+	if err := tracer.Start(info); err != nil {
+		t.Skipf("ptrace is not available: %v", err)
+	}
+	processID := tracer.launched.Process.Pid
+	t.Cleanup(func() { syscall.Kill(processID, syscall.SIGKILL) })
+	go func() {
+		for range tracer.Events() {
+		}
+	}()
+
+	// The child exits after the tracer detached and must not stay a zombie
+	if err := tracer.Stop(); err != nil {
+		t.Fatalf("Stop() = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(fmt.Sprintf("/proc/%d", processID)); os.IsNotExist(err) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("launched child %d was not reaped", processID)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestPtraceTracerResumesGroupStop(t *testing.T) {
+	if !ptraceSupported {
+		t.Skip("ptrace tracer is not supported on this architecture")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("the ptrace tracer requires root")
+	}
+	tracer, err := newPtraceTracer(filepath.Join(t.TempDir(), "ptrace_raw.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The shell stops itself; a group-stop re-injected as a new signal would stop it over and over
+	info := &ProcessInfo{ReconstructedCommand: "bash -c 'kill -TSTP $$; exit 0'", WorkingDirectory: "/", EnvironmentVariables: os.Environ()}
+	if err := tracer.Start(info); err != nil {
+		t.Skipf("ptrace is not available: %v", err)
+	}
+	for _, threadID := range tracer.traceeIDs() {
+		t.Cleanup(func() { syscall.Kill(threadID, syscall.SIGKILL) })
+	}
+	drained := make(chan struct{})
+	go func() {
+		for range tracer.Events() {
+		}
+		close(drained)
+	}()
+
+	select {
+	case err := <-tracer.done:
+		if err != nil {
+			t.Errorf("trace loop = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the traced process did not exit after its group-stop")
+	}
+	<-drained
+}
@@ -0,0 +1,194 @@
+package profiler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// readinessPollInterval is the pause between two checks of a process or its endpoints
+const readinessPollInterval = 100 * time.Millisecond
+
+// settleDuration is how long to wait for an application without recorded endpoints to start
+const settleDuration = 1 * time.Second
+
+// socketTables names the files that list the sockets of the host, in the format of /proc/net
+type socketTables struct {
+	tcp  []string
+	udp  []string
+	unix string
+}
+
+// procSocketTables are the socket tables the readiness checks read
+var procSocketTables = socketTables{
+	tcp:  []string{"/proc/net/tcp", "/proc/net/tcp6"},
+	udp:  []string{"/proc/net/udp", "/proc/net/udp6"},
+	unix: "/proc/net/unix",
+}
+
+// stopProcess sends SIGTERM to the processes and waits until they are gone.
+// Processes still running after the timeout are killed with SIGKILL.
+func stopProcess(processIDs []int, timeout time.Duration) error {
+	signalProcesses(processIDs, syscall.SIGTERM)
+	if waitForExit(processIDs, timeout) {
+		return nil
+	}
+
+	// Escalate to SIGKILL
+	log.Warn(fmt.Sprintf("Processes %v still running after %s, sending SIGKILL...", runningProcesses(processIDs), timeout))
+	signalProcesses(runningProcesses(processIDs), syscall.SIGKILL)
+	if waitForExit(processIDs, timeout) {
+		return nil
+	}
+	return fmt.Errorf("processes %v did not exit", runningProcesses(processIDs))
+}
+
+// signalProcesses sends a signal to each of the processes, through sudo for processes of other users
+func signalProcesses(processIDs []int, signal syscall.Signal) {
+	for _, processID := range processIDs {
+		err := syscall.Kill(processID, signal)
+		if err == syscall.EPERM {
+			err = exec.Command("sudo", "kill", "-"+strconv.Itoa(int(signal)), strconv.Itoa(processID)).Run()
+		}
+		if err != nil && isProcessRunning(processID) {
+			log.Error("Failed to signal process", "pid", processID, "signal", signal, "error", err)
+		}
+	}
+}
+
+// waitForExit polls until none of the processes is running, or the timeout expires
+func waitForExit(processIDs []int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for len(runningProcesses(processIDs)) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(readinessPollInterval)
+	}
+	return true
+}
+
+// runningProcesses returns the processes that are still running
+func runningProcesses(processIDs []int) []int {
+	var running []int
+	for _, processID := range processIDs {
+		if isProcessRunning(processID) {
+			running = append(running, processID)
+		}
+	}
+	return running
+}
+
+// isProcessRunning checks if a process exists and is not a zombie waiting to be reaped
+func isProcessRunning(processID int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", processID))
+	if err != nil {
+		return false
+	}
+
+	// The state follows the command name, which is enclosed in parentheses
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	return len(fields) > 0 && fields[0] != "Z" && fields[0] != "X"
+}
+
+// waitForReadiness waits until the relaunched application listens on the TCP and UDP ports
+// and Unix sockets recorded before the restart. It returns the time it waited, and whether
+// readiness was observed at all: without recorded endpoints it only waits for the application to settle.
+func waitForReadiness(info *ProcessInfo, timeout time.Duration) (time.Duration, bool, error) {
+	startTime := time.Now()
+
+	// Without recorded endpoints there is nothing to observe: give the application a moment
+	if len(info.ListeningTCP) == 0 && len(info.ListeningUDP) == 0 && len(info.UnixSockets) == 0 {
+		log.Info("No recorded ports or sockets, waiting for the application to settle...")
+		time.Sleep(settleDuration)
+		return time.Since(startTime), false, nil
+	}
+
+	log.Info("Waiting for the application to become ready...", "timeout", timeout)
+	deadline := startTime.Add(timeout)
+	for {
+		missing := missingEndpoints(info, procSocketTables)
+		if len(missing) == 0 {
+			return time.Since(startTime), true, nil
+		}
+		if time.Now().After(deadline) {
+			return time.Since(startTime), true, fmt.Errorf("not listening on %s after %s", strings.Join(missing, ", "), timeout)
+		}
+		time.Sleep(readinessPollInterval)
+	}
+}
+
+// missingEndpoints lists the recorded endpoints that are not listening yet in the socket tables
+func missingEndpoints(info *ProcessInfo, tables socketTables) []string {
+	var missing []string
+
+	tcpPorts := readBoundPorts(tables.tcp, "0A") // 0A == LISTEN
+	for _, port := range info.ListeningTCP {
+		if !tcpPorts[port] {
+			missing = append(missing, fmt.Sprintf("%d/tcp", port))
+		}
+	}
+
+	udpPorts := readBoundPorts(tables.udp, "07") // 07 == bound, unconnected
+	for _, port := range info.ListeningUDP {
+		if !udpPorts[port] {
+			missing = append(missing, fmt.Sprintf("%d/udp", port))
+		}
+	}
+
+	unixSockets := readUnixSocketPaths(tables.unix)
+	for _, socketPath := range info.UnixSockets {
+		if !unixSockets[socketPath] {
+			missing = append(missing, socketPath)
+		}
+	}
+
+	return missing
+}
+
+// readBoundPorts returns the local ports of all sockets in the given state in /proc/net/* files
+func readBoundPorts(netFilePaths []string, state string) map[int]bool {
+	ports := make(map[int]bool)
+	for _, netFilePath := range netFilePaths {
+		file, err := os.Open(netFilePath)
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Scan() // Skip the header
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 4 && fields[3] == state {
+				if port := extractPortFromHex(fields[1]); port > 0 {
+					ports[port] = true
+				}
+			}
+		}
+		file.Close()
+	}
+	return ports
+}
+
+// readUnixSocketPaths returns the paths of all Unix domain sockets listed in a /proc/net/unix file
+func readUnixSocketPaths(unixFilePath string) map[string]bool {
+	paths := make(map[string]bool)
+	inodeToPath, err := parseProcNetUnix(unixFilePath)
+	if err != nil {
+		return paths
+	}
+	for _, path := range inodeToPath {
+		if path != "" {
+			paths[path] = true
+		}
+	}
+	return paths
+}
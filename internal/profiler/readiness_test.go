@@ -0,0 +1,159 @@
+package profiler
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fixtureSocketTables are the socket tables of testdata/proc/net
+var fixtureSocketTables = socketTables{
+	tcp:  []string{"testdata/proc/net/tcp", "testdata/proc/net/tcp6"},
+	udp:  []string{"testdata/proc/net/udp", "testdata/proc/net/udp6"},
+	unix: "testdata/proc/net/unix",
+}
+
+func TestReadBoundPorts(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     []string
+		state     string
+		wantPorts map[int]bool
+	}{
+		// Established connections (01) do not count as listening
+		{name: "tcp listen", files: []string{"testdata/proc/net/tcp"}, state: "0A", wantPorts: map[int]bool{80: true, 3306: true}},
+		{name: "tcp6 listen", files: []string{"testdata/proc/net/tcp6"}, state: "0A", wantPorts: map[int]bool{443: true}},
+		{name: "tcp established", files: []string{"testdata/proc/net/tcp", "testdata/proc/net/tcp6"}, state: "01", wantPorts: map[int]bool{40000: true, 8080: true}},
+		{name: "udp bound", files: []string{"testdata/proc/net/udp", "testdata/proc/net/udp6"}, state: "07", wantPorts: map[int]bool{53: true, 514: true}},
+		{name: "missing file", files: []string{"testdata/proc/net/missing"}, state: "0A", wantPorts: map[int]bool{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := readBoundPorts(test.files, test.state); !reflect.DeepEqual(got, test.wantPorts) {
+				t.Errorf("readBoundPorts() = %v, want %v", got, test.wantPorts)
+			}
+		})
+	}
+}
+
+func TestReadUnixSocketPaths(t *testing.T) {
+	// Unnamed sockets have no path
+	want := map[string]bool{"/run/mysqld/mysqld.sock": true, "@/tmp/.X11-unix/X0": true}
+	if got := readUnixSocketPaths(fixtureSocketTables.unix); !reflect.DeepEqual(got, want) {
+		t.Errorf("readUnixSocketPaths() = %v, want %v", got, want)
+	}
+	if got := readUnixSocketPaths("testdata/proc/net/missing"); len(got) != 0 {
+		t.Errorf("readUnixSocketPaths() of a missing file = %v, want none", got)
+	}
+}
+
+func TestMissingEndpoints(t *testing.T) {
+	tests := []struct {
+		name string
+		info *ProcessInfo
+		want []string
+	}{
+		{
+			name: "all listening",
+			info: &ProcessInfo{ListeningTCP: []int{80, 443}, ListeningUDP: []int{53, 514}, UnixSockets: []string{"/run/mysqld/mysqld.sock"}},
+			want: nil,
+		},
+		{
+			name: "connected but not listening",
+			info: &ProcessInfo{ListeningTCP: []int{3306, 8080}, ListeningUDP: []int{41394}},
+			want: []string{"8080/tcp", "41394/udp"},
+		},
+		{
+			name: "socket not open",
+			info: &ProcessInfo{UnixSockets: []string{"/run/app/app.sock"}},
+			want: []string{"/run/app/app.sock"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := missingEndpoints(test.info, fixtureSocketTables); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("missingEndpoints() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWaitForReadiness(t *testing.T) {
+	procTables := procSocketTables
+	procSocketTables = fixtureSocketTables
+	t.Cleanup(func() { procSocketTables = procTables })
+
+	if _, observed, err := waitForReadiness(&ProcessInfo{ListeningTCP: []int{80}}, time.Second); !observed || err != nil {
+		t.Errorf("waitForReadiness() = %v, %v, want observed readiness", observed, err)
+	}
+	if _, observed, err := waitForReadiness(&ProcessInfo{ListeningTCP: []int{8080}}, 200*time.Millisecond); !observed || err == nil {
+		t.Errorf("waitForReadiness() = %v, %v, want a timeout", observed, err)
+	}
+	if _, observed, err := waitForReadiness(&ProcessInfo{}, time.Second); observed || err != nil {
+		t.Errorf("waitForReadiness() without endpoints = %v, %v, want no observed readiness", observed, err)
+	}
+}
+
+func TestIsProcessRunning(t *testing.T) {
+	if !isProcessRunning(os.Getpid()) {
+		t.Error("isProcessRunning() of the test process = false")
+	}
+
+	// An exited child that has not been reaped is a zombie
+	command := exec.Command("true")
+	if err := command.Start(); err != nil {
+		t.Fatal(err)
+	}
+	processID := command.Process.Pid
+	deadline := time.Now().Add(5 * time.Second)
+	for isProcessRunning(processID) {
+		if time.Now().After(deadline) {
+			t.Fatal("the exited child is still running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	command.Wait()
+	if isProcessRunning(processID) {
+		t.Error("isProcessRunning() of a reaped child = true")
+	}
+}
+
+func TestStopProcess(t *testing.T) {
+	// A process that exits on SIGTERM
+	terminating := exec.Command("sleep", "60")
+	// A process that ignores SIGTERM and needs SIGKILL
+	ignoring := exec.Command("sh", "-c", `trap "" TERM; while :; do sleep 1; done`)
+	for _, command := range []*exec.Cmd{terminating, ignoring} {
+		if err := command.Start(); err != nil {
+			t.Fatal(err)
+		}
+		// Reap the children, so they do not stay zombies
+		go command.Wait()
+		t.Cleanup(func() { command.Process.Kill() })
+	}
+	// Give the shell time to install its trap
+	time.Sleep(200 * time.Millisecond)
+
+	startTime := time.Now()
+	if err := stopProcess([]int{terminating.Process.Pid}, 5*time.Second); err != nil {
+		t.Errorf("stopProcess() of a terminating process = %v", err)
+	}
+	if elapsed := time.Since(startTime); elapsed > 2*time.Second {
+		t.Errorf("stopProcess() of a terminating process took %s", elapsed)
+	}
+
+	startTime = time.Now()
+	if err := stopProcess([]int{ignoring.Process.Pid}, 500*time.Millisecond); err != nil {
+		t.Errorf("stopProcess() of a process ignoring SIGTERM = %v", err)
+	}
+	if elapsed := time.Since(startTime); elapsed < 500*time.Millisecond {
+		t.Errorf("stopProcess() returned after %s, before the SIGTERM timeout", elapsed)
+	}
+	if isProcessRunning(ignoring.Process.Pid) {
+		t.Error("the process ignoring SIGTERM is still running")
+	}
+}
@@ -0,0 +1,207 @@
+package profiler
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// descriptorRegex matches an fd argument with an optional "strace -y" path annotation, e.g. "3</var/lib/mysql>"
+var descriptorRegex = regexp.MustCompile(`^(-?\d+|AT_FDCWD)(?:<(.*)>)?$`)
+
+// PathResolver resolves the path arguments of traced calls to absolute paths.
+// It tracks the working directory of every traced process: inherited on fork and clone,
+// shared between threads, and updated on chdir and fchdir. Paths relative to a directory
+// fd are resolved through the fd annotations of "strace -y" or the fds opened during the trace.
+type PathResolver struct {
+	defaultWorkingDirectory string
+	initialDirectories      map[int]string
+	parents                 map[int]int
+	sharesFilesystem        map[int]bool
+	workingDirectories      map[int]*string
+	descriptors             map[int]map[int]string
+}
+
+// NewPathResolver creates a resolver for the given events.
+// initialDirectories holds the known working directories of already-running processes (attach mode);
+// any other process without a traced parent starts in defaultWorkingDirectory.
+func NewPathResolver(events []SyscallEvent, defaultWorkingDirectory string, initialDirectories map[int]string) *PathResolver {
+	resolver := &PathResolver{
+		defaultWorkingDirectory: defaultWorkingDirectory,
+		initialDirectories:      initialDirectories,
+		parents:                 make(map[int]int),
+		sharesFilesystem:        make(map[int]bool),
+		workingDirectories:      make(map[int]*string),
+		descriptors:             make(map[int]map[int]string),
+	}
+
+	// Learn the process tree up front: with "strace -f", a child's first calls
+	// are often logged before the parent's fork returns
+	for _, event := range events {
+		if isForkCall(event.Syscall) && event.ReturnValue > 0 {
+			childID := int(event.ReturnValue)
+			resolver.parents[childID] = event.PID
+			resolver.sharesFilesystem[childID] = slices.Contains(event.Flags, "CLONE_FS")
+		}
+	}
+
+	return resolver
+}
+
+// Observe updates the tracked state with a completed call.
+// It must be called for every event, in trace order, after the event's paths were resolved.
+func (resolver *PathResolver) Observe(event SyscallEvent) {
+	if event.Errno != "" || event.ReturnValue < 0 {
+		return
+	}
+
+	switch {
+	case event.Syscall == "chdir" && len(event.Paths) > 0:
+		resolver.setWorkingDirectory(event.PID, resolver.resolve(event.PID, event.Paths[0], "AT_FDCWD"))
+
+	case event.Syscall == "fchdir" && len(event.Arguments) > 0:
+		if directory := resolver.descriptorPath(event.PID, event.Arguments[0]); directory != "" {
+			resolver.setWorkingDirectory(event.PID, directory)
+		}
+
+	case isForkCall(event.Syscall) && event.ReturnValue > 0:
+		// Materialize the child's working directory as it is at fork time
+		resolver.workingDirectoryOf(int(event.ReturnValue))
+
+	case isOpenCall(event.Syscall) && event.ReturnValue > 0:
+		// Remember opened fds so later *at() calls relative to them can be resolved
+		if paths := resolver.ResolvePaths(event); len(paths) > 0 {
+			if resolver.descriptors[event.PID] == nil {
+				resolver.descriptors[event.PID] = make(map[int]string)
+			}
+			resolver.descriptors[event.PID][int(event.ReturnValue)] = paths[0]
+		}
+	}
+}
+
+// ResolvePaths returns the absolute, cleaned paths named by an event.
+// Paths that cannot be resolved (e.g., relative to an unknown fd) are omitted.
+func (resolver *PathResolver) ResolvePaths(event SyscallEvent) []string {
+	var resolvedPaths []string
+	for _, resolvedPath := range resolver.ResolvePathArguments(event) {
+		if resolvedPath != "" {
+			resolvedPaths = append(resolvedPaths, resolvedPath)
+		}
+	}
+	return resolvedPaths
+}
+
+// ResolvePathArguments resolves every path argument of an event, keeping their positions.
+// Paths that cannot be resolved are returned as empty strings.
+func (resolver *PathResolver) ResolvePathArguments(event SyscallEvent) []string {
+	spec := syscallSpecs[event.Syscall]
+	resolvedPaths := make([]string, len(event.Paths))
+
+	for pathIndex, path := range event.Paths {
+		// Find the directory fd the path is relative to, if any
+		directoryArgument := "AT_FDCWD"
+		if pathIndex < len(spec.dirfdArguments) {
+			if argumentIndex := spec.dirfdArguments[pathIndex]; argumentIndex >= 0 && argumentIndex < len(event.Arguments) {
+				directoryArgument = event.Arguments[argumentIndex]
+			}
+		}
+		resolvedPaths[pathIndex] = resolver.resolve(event.PID, path, directoryArgument)
+	}
+
+	return resolvedPaths
+}
+
+// WorkingDirectory returns the current working directory of a process
+func (resolver *PathResolver) WorkingDirectory(processID int) string {
+	return *resolver.workingDirectoryOf(processID)
+}
+
+// resolve turns a path into an absolute path, relative to the given directory fd argument
+func (resolver *PathResolver) resolve(processID int, path, directoryArgument string) string {
+	if path == "" {
+		return ""
+	}
+	if strings.HasPrefix(path, "/") {
+		return filepath.Clean(path)
+	}
+
+	baseDirectory := resolver.descriptorPath(processID, directoryArgument)
+	if baseDirectory == "" {
+		return ""
+	}
+	return filepath.Join(baseDirectory, path)
+}
+
+// descriptorPath returns the path behind an fd argument such as "AT_FDCWD" or "3</etc/nginx>"
+func (resolver *PathResolver) descriptorPath(processID int, argument string) string {
+	match := descriptorRegex.FindStringSubmatch(argument)
+	if match == nil {
+		return ""
+	}
+	// Prefer the annotation printed by the tracer, unless the fd is not a file (e.g. "socket:[41231]")
+	if match[2] != "" {
+		if !strings.HasPrefix(match[2], "/") {
+			return ""
+		}
+		return match[2]
+	}
+	if match[1] == "AT_FDCWD" {
+		return resolver.WorkingDirectory(processID)
+	}
+
+	// Fall back to fds opened during the trace, which children inherit from their parents
+	descriptor, _ := strconv.Atoi(match[1])
+	for {
+		if path, found := resolver.descriptors[processID][descriptor]; found {
+			return path
+		}
+		parentID, hasParent := resolver.parents[processID]
+		if !hasParent {
+			return ""
+		}
+		processID = parentID
+	}
+}
+
+// workingDirectoryOf returns the (possibly shared) working directory slot of a process,
+// inheriting it from the parent on first use
+func (resolver *PathResolver) workingDirectoryOf(processID int) *string {
+	if directory, found := resolver.workingDirectories[processID]; found {
+		return directory
+	}
+
+	var directory *string
+	parentID, hasParent := resolver.parents[processID]
+	switch {
+	case hasParent && resolver.sharesFilesystem[processID]:
+		// Threads created with CLONE_FS share the working directory with their parent
+		directory = resolver.workingDirectoryOf(parentID)
+	case hasParent:
+		inherited := *resolver.workingDirectoryOf(parentID)
+		directory = &inherited
+	case resolver.initialDirectories[processID] != "":
+		initial := resolver.initialDirectories[processID]
+		directory = &initial
+	default:
+		initial := resolver.defaultWorkingDirectory
+		directory = &initial
+	}
+
+	resolver.workingDirectories[processID] = directory
+	return directory
+}
+
+// setWorkingDirectory changes the working directory of a process (and of all threads sharing it)
+func (resolver *PathResolver) setWorkingDirectory(processID int, directory string) {
+	if directory == "" {
+		return
+	}
+	*resolver.workingDirectoryOf(processID) = directory
+}
+
+// isForkCall checks if a system call creates a new process or thread
+func isForkCall(name string) bool {
+	return name == "clone" || name == "clone3" || name == "fork" || name == "vfork"
+}
@@ -1,87 +1,101 @@
 package profiler
 
 import (
-	"bytes"
 	"fmt"
-	"os/exec"
-	"strconv"
 	"time"
 
 	"github.com/charmbracelet/log"
 )
 
-// RestartProcess handles restarting a process using its ProcessInfo
-func RestartProcess(processInfo *ProcessInfo, sleepDuration time.Duration) {
-	// Restart process with monitoring
-	terminateProcess(processInfo.PID)
-	startProcessWithStrace(processInfo, sleepDuration)
-}
+// RestartProcess restarts a process under the configured tracer and returns the collected trace data.
+// The measured startup time is recorded in processInfo.
+func RestartProcess(processInfo *ProcessInfo, options TraceOptions) TraceResult {
+	// Let the unit manager restart services, so it does not race the tracer
+	if processInfo.SystemdUnit != nil {
+		return restartSystemdUnit(processInfo, options)
+	}
 
-// terminateProcess stops the process with the given PID
-func terminateProcess(processID int) {
-	log.Info(fmt.Sprintf("Terminating process with PID %d...", processID))
-	err := exec.Command("sudo", "kill", strconv.Itoa(processID)).Run()
+	// Create the tracer first, so a tracer that cannot run fails before the process is stopped
+	logfilePath := BuildFilePath(fmt.Sprintf("output/%d/profile", processInfo.PID), "strace_raw.log")
+	tracer, err := NewTracer(options.Backend, logfilePath)
 	if err != nil {
+		log.Error("Failed to create tracer", "error", err)
+		return TraceResult{}
+	}
+
+	// Restart process with monitoring
+	if options.Restarting != nil {
+		options.Restarting()
+	}
+	if err := terminateProcess(processInfo, options.StopTimeout); err != nil {
 		log.Error("Failed to terminate process", "error", err)
+		return TraceResult{}
 	}
-	// Sleep for a few seconds to allow the process to terminate
-	time.Sleep(5 * time.Second)
+	return startProcessWithTracer(processInfo, tracer, options)
 }
 
-// startProcessWithStrace starts a process with strace monitoring
-func startProcessWithStrace(info *ProcessInfo, sleepDuration time.Duration) {
+// terminateProcess stops the process and its children, and waits until they are gone
+func terminateProcess(info *ProcessInfo, timeout time.Duration) error {
+	log.Info(fmt.Sprintf("Terminating process with PID %d...", info.PID))
+	return stopProcess(append([]int{info.PID}, info.ChildPIDs...), timeout)
+}
+
+// startProcessWithTracer starts a process under the tracer and collects its events
+func startProcessWithTracer(info *ProcessInfo, tracer Tracer, options TraceOptions) TraceResult {
 	// Ensure the directories for the sockets exist
 	EnsureSocketDirectories(info.UnixSockets, info.ProcessUser)
 
-	// Get the output file path for strace
-	logfilePath := BuildFilePath(fmt.Sprintf("output/%d/profile", info.PID), "strace_raw.log")
-
-	// Prepare the strace command
-	command := prepareStraceCommand(info, logfilePath)
-	var stderrBuffer bytes.Buffer
-	command.Stderr = &stderrBuffer
-
-	// Start the process with strace
-	log.Info(fmt.Sprintf("Starting process with strace: %s...", info.ReconstructedCommand))
-	err := command.Start()
-	if err != nil {
-		log.Error("Failed to start process with strace", "stderr", stderrBuffer.String(), "error", err)
+	// Start the process under the tracer
+	log.Info(fmt.Sprintf("Starting process with tracer: %s...", info.ReconstructedCommand))
+	if err := tracer.Start(info); err != nil {
+		log.Error("Failed to start process with tracer", "error", err)
+		return TraceResult{}
 	}
-	log.Info("Monitoring process with strace...")
-	// Sleep to allow the process to start
-	time.Sleep(1 * time.Second)
+	log.Info("Monitoring process with tracer...")
 
-	// Trigger a GET request to the application to simulate traffic
-	exec.Command("curl", "http://localhost").Run()
-
-	// Sleep for the specified duration to allow strace to capture initial syscalls
-	time.Sleep(sleepDuration)
+	// The restarted processes are known from the events of the tracer
+	events, samples := collectTraceEvents(tracer, info, options, nil, readinessWaiter(info, options))
+	return TraceResult{Events: events, ResourceSamples: samples}
+}
 
-	// Terminate the strace process after data collection
-	err = command.Process.Kill()
-	if err != nil {
-		log.Error("Failed to kill strace process", "error", err)
+// restartSystemdUnit restarts the unit owning the process with its main command under strace
+func restartSystemdUnit(info *ProcessInfo, options TraceOptions) TraceResult {
+	if options.Backend == "ptrace" {
+		log.Warn("Systemd units are restarted under strace, ignoring the ptrace backend")
 	}
-	log.Info("Tracing complete.")
-}
 
-// prepareStraceCommand constructs the strace command to execute
-func prepareStraceCommand(info *ProcessInfo, logfilePath string) *exec.Cmd {
-	// Use setsid to start the process in a new session (detach from strace)
-	commandline := fmt.Sprintf("setsid %s", info.ReconstructedCommand)
+	// Get the output file path for the raw trace log
+	logfilePath := BuildFilePath(fmt.Sprintf("output/%d/profile", info.PID), "strace_raw.log")
 
-	// Prepare the strace command arguments
-	commandArguments := []string{
-		"strace",
-		"-f",
-		"-e", "trace=file",
-		"-o", logfilePath,
-		"bash", "-c", commandline,
+	// Restart the unit with the tracing drop-in
+	tracer := newSystemdTracer(info.SystemdUnit, logfilePath)
+	tracer.restarting = options.Restarting
+	if err := tracer.Start(info); err != nil {
+		log.Error("Failed to restart systemd unit with tracer", "unit", info.SystemdUnit.Name, "error", err)
+		return TraceResult{}
 	}
+	log.Info("Monitoring process with tracer...")
 
-	command := exec.Command("sudo", commandArguments...)
-	command.Dir = info.WorkingDirectory
-	command.Env = info.EnvironmentVariables
+	// The restarted processes are known from the events of the tracer
+	events, samples := collectTraceEvents(tracer, info, options, nil, readinessWaiter(info, options))
+	return TraceResult{Events: events, ResourceSamples: samples}
+}
 
-	return command
+// readinessWaiter returns a function that waits until the application listens again
+// before traffic is sent, and records how long it took. The startup time stays unset
+// if the application has no recorded endpoints to observe.
+func readinessWaiter(info *ProcessInfo, options TraceOptions) func() {
+	return func() {
+		startupTime, observed, err := waitForReadiness(info, options.ReadyTimeout)
+		if err != nil {
+			log.Warn("Application did not become ready, tracing anyway", "error", err)
+			return
+		}
+		if !observed {
+			log.Info("Startup time not measured, the application has no recorded ports or sockets.")
+			return
+		}
+		info.StartupSeconds = startupTime.Seconds()
+		log.Info(fmt.Sprintf("Application ready after %.2fs.", info.StartupSeconds))
+	}
 }
@@ -0,0 +1,187 @@
+package profiler
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/charmbracelet/log"
+)
+
+// Restorer brings a restarted application back to the state recorded before profiling:
+// running the same command as the same user, in the same working directory and environment,
+// and no longer under a tracer. An application that profiling never stopped is left alone.
+type Restorer struct {
+	info        *ProcessInfo
+	options     TraceOptions
+	preexisting map[int]bool
+	restarted   atomic.Bool
+	once        sync.Once
+	err         error
+}
+
+// NewRestorer prepares the restoration of an application. It must be created before the
+// application is restarted: every instance of the executable started afterwards is treated
+// as started by the profiler.
+func NewRestorer(info *ProcessInfo, options TraceOptions) *Restorer {
+	preexisting := preexistingProcesses(info, findProcessesByExecutable(info.ExecutablePath))
+	return &Restorer{info: info, options: options, preexisting: preexisting}
+}
+
+// preexistingProcesses returns the running instances of the executable that are not part of the
+// profiled process tree, which the restart stops
+func preexistingProcesses(info *ProcessInfo, processIDs []int) map[int]bool {
+	preexisting := make(map[int]bool)
+	for _, processID := range processIDs {
+		preexisting[processID] = true
+	}
+	delete(preexisting, info.PID)
+	for _, childID := range info.ChildPIDs {
+		delete(preexisting, childID)
+	}
+	return preexisting
+}
+
+// MarkRestarted records that the original process is about to be stopped, or its unit restarted.
+// It is meant as the Restarting hook of the TraceOptions.
+func (restorer *Restorer) MarkRestarted() {
+	restorer.restarted.Store(true)
+}
+
+// Restore stops the instances started during profiling, relaunches the application and
+// verifies that it listens on its ports and sockets again. Only the first call has an effect.
+func (restorer *Restorer) Restore() error {
+	restorer.once.Do(func() {
+		restorer.err = restorer.restore()
+	})
+	return restorer.err
+}
+
+// restore performs the restoration steps
+func (restorer *Restorer) restore() error {
+	info := restorer.info
+
+	// Profiling failed before the process was stopped (e.g. the tracer cannot run), so it is still the original
+	if !restorer.restarted.Load() {
+		log.Info("The original process was not restarted, nothing to restore.")
+		return nil
+	}
+	log.Info("Restoring the original process...")
+
+	// Services are restored by their unit manager
+	if info.SystemdUnit != nil {
+		return restoreSystemdUnit(info, restorer.options)
+	}
+
+	// 1. Stop the instances started by the profiler (e.g., still running after the tracer detached)
+	instances := restorer.profiledInstances(findProcessesByExecutable(info.ExecutablePath))
+	if len(instances) > 0 {
+		log.Info(fmt.Sprintf("Stopping profiled instances %v...", instances))
+		if err := stopProcess(instances, restorer.options.StopTimeout); err != nil {
+			return fmt.Errorf("failed to stop profiled instances: %w", err)
+		}
+	}
+
+	// 2. Relaunch the application as it ran before profiling
+	log.Info(fmt.Sprintf("Relaunching %s as %s:%s...", info.ReconstructedCommand, info.ProcessUser, info.ProcessGroup))
+	EnsureSocketDirectories(info.UnixSockets, info.ProcessUser)
+	if err := launchOriginalProcess(info); err != nil {
+		return fmt.Errorf("failed to relaunch process: %w", err)
+	}
+
+	// 3. Verify that the application is listening again
+	startupTime, observed, err := waitForReadiness(info, restorer.options.ReadyTimeout)
+	if err != nil {
+		return fmt.Errorf("restored process is not ready: %w", err)
+	}
+	if !observed {
+		log.Info("Original process restored.")
+		return nil
+	}
+	log.Info(fmt.Sprintf("Original process restored and ready after %.2fs.", startupTime.Seconds()))
+	return nil
+}
+
+// profiledInstances returns the running instances of the executable that were started during profiling
+func (restorer *Restorer) profiledInstances(processIDs []int) []int {
+	var instances []int
+	for _, processID := range processIDs {
+		if !restorer.preexisting[processID] {
+			instances = append(instances, processID)
+		}
+	}
+	return instances
+}
+
+// restoreSystemdUnit restarts the unit without the tracing drop-in and verifies that it is ready
+func restoreSystemdUnit(info *ProcessInfo, options TraceOptions) error {
+	// 1. Make sure the unit definition is untraced again (e.g., after an interrupted restart)
+	removeTraceDropIn(info.SystemdUnit)
+
+	// 2. Restart the unit, which stops any process still running under strace
+	log.Info(fmt.Sprintf("Restarting systemd unit %s...", info.SystemdUnit.Name))
+	if err := runSystemctl("restart", info.SystemdUnit.Name); err != nil {
+		return fmt.Errorf("failed to restart unit: %w", err)
+	}
+
+	// 3. Verify that the application is listening again
+	startupTime, observed, err := waitForReadiness(info, options.ReadyTimeout)
+	if err != nil {
+		return fmt.Errorf("restored unit is not ready: %w", err)
+	}
+	if !observed {
+		log.Info(fmt.Sprintf("Systemd unit %s restored.", info.SystemdUnit.Name))
+		return nil
+	}
+	log.Info(fmt.Sprintf("Systemd unit %s restored and ready after %.2fs.", info.SystemdUnit.Name, startupTime.Seconds()))
+	return nil
+}
+
+// launchOriginalProcess starts the recorded command in a new session as the original user and group,
+// with exactly the recorded environment and working directory
+func launchOriginalProcess(info *ProcessInfo) error {
+	command := buildLaunchCommand(info)
+	if err := command.Start(); err != nil {
+		return err
+	}
+
+	// Reap the launcher once the application detaches or exits
+	go command.Wait()
+	return nil
+}
+
+// buildLaunchCommand builds the command that relaunches the application:
+// sudo -u <user> -g <group> -- env -i <environment> setsid bash -c <command>
+func buildLaunchCommand(info *ProcessInfo) *exec.Cmd {
+	commandArguments := []string{"-u", info.ProcessUser, "-g", info.ProcessGroup, "--", "env", "-i"}
+	commandArguments = append(commandArguments, info.EnvironmentVariables...)
+	commandArguments = append(commandArguments, "setsid", "bash", "-c", info.ReconstructedCommand)
+
+	command := exec.Command("sudo", commandArguments...)
+	command.Dir = info.WorkingDirectory
+	return command
+}
+
+// findProcessesByExecutable returns the IDs of all processes running the given executable
+func findProcessesByExecutable(executablePath string) []int {
+	procEntries, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return nil
+	}
+
+	var processIDs []int
+	for _, procEntry := range procEntries {
+		processID, err := strconv.Atoi(filepath.Base(procEntry))
+		if err != nil {
+			continue
+		}
+		if target, err := os.Readlink(filepath.Join(procEntry, "exe")); err == nil && target == executablePath && isProcessRunning(processID) {
+			processIDs = append(processIDs, processID)
+		}
+	}
+	return processIDs
+}
@@ -0,0 +1,96 @@
+package profiler
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBuildLaunchCommand(t *testing.T) {
+	info := &ProcessInfo{
+		ProcessUser:          "www-data",
+		ProcessGroup:         "www-data",
+		EnvironmentVariables: []string{"PATH=/usr/bin:/bin", "GREETING=hello world"},
+		ReconstructedCommand: "/usr/sbin/nginx -g 'daemon on; master_process on;'",
+		WorkingDirectory:     "/var/www",
+	}
+
+	command := buildLaunchCommand(info)
+	want := []string{
+		"sudo", "-u", "www-data", "-g", "www-data", "--",
+		"env", "-i", "PATH=/usr/bin:/bin", "GREETING=hello world",
+		"setsid", "bash", "-c", "/usr/sbin/nginx -g 'daemon on; master_process on;'",
+	}
+	if !slices.Equal(command.Args, want) {
+		t.Errorf("Args = %q, want %q", command.Args, want)
+	}
+	if command.Dir != "/var/www" {
+		t.Errorf("Dir = %q, want /var/www", command.Dir)
+	}
+	// The environment is passed through env -i rather than inherited from the profiler
+	if command.Env != nil {
+		t.Errorf("Env = %q, want the environment of sudo", command.Env)
+	}
+}
+
+func TestRestorerProfiledInstances(t *testing.T) {
+	info := &ProcessInfo{PID: 100, ChildPIDs: []int{101, 102}}
+
+	// Instances running before the restart, other than the profiled tree, are left alone
+	restorer := &Restorer{info: info, preexisting: preexistingProcesses(info, []int{50, 100, 101, 102})}
+	if want := map[int]bool{50: true}; !maps.Equal(restorer.preexisting, want) {
+		t.Errorf("preexisting = %v, want %v", restorer.preexisting, want)
+	}
+
+	// Everything else running the executable was started during profiling
+	if got, want := restorer.profiledInstances([]int{50, 200, 201}), []int{200, 201}; !slices.Equal(got, want) {
+		t.Errorf("profiledInstances() = %v, want %v", got, want)
+	}
+	if got := restorer.profiledInstances([]int{50}); got != nil {
+		t.Errorf("profiledInstances() = %v, want none", got)
+	}
+}
+
+func TestRestoreAfterTracerFailedBeforeStop(t *testing.T) {
+	// The profile output is written below the working directory
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(workingDirectory) })
+
+	// The original process, which a failed profile must leave running
+	original := exec.Command("sleep", "60")
+	if err := original.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		original.Process.Kill()
+		original.Wait()
+	})
+	executablePath, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", original.Process.Pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &ProcessInfo{PID: original.Process.Pid, ExecutablePath: executablePath, ReconstructedCommand: "sleep 60"}
+
+	options := TraceOptions{Backend: "unknown", StopTimeout: time.Second, ReadyTimeout: time.Second}
+	restorer := NewRestorer(info, options)
+	options.Restarting = restorer.MarkRestarted
+
+	// The tracer cannot be created, so the process is never stopped
+	RestartProcess(info, options)
+	if err := restorer.Restore(); err != nil {
+		t.Errorf("Restore() = %v", err)
+	}
+	if !isProcessRunning(original.Process.Pid) {
+		t.Error("Restore() stopped the original process, which profiling never restarted")
+	}
+}
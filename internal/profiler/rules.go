@@ -0,0 +1,310 @@
+package profiler
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed rules/default.yaml
+var defaultRulesData []byte
+
+// Verdicts of a path against the filter rules
+const (
+	VerdictKept     = "kept"
+	VerdictGeneric  = "generic"
+	VerdictExcluded = "excluded"
+	VerdictIncluded = "included"
+)
+
+// RuleMatcher matches paths by prefix, glob or regular expression (exactly one is set).
+type RuleMatcher struct {
+	Prefix string `yaml:"prefix,omitempty"`
+	Glob   string `yaml:"glob,omitempty"`
+	Regex  string `yaml:"regex,omitempty"`
+}
+
+// RuleSet holds the filter rules of one rules file or distribution.
+type RuleSet struct {
+	Generic    []string      `yaml:"generic"`
+	Exclude    []RuleMatcher `yaml:"exclude"`
+	Include    []RuleMatcher `yaml:"include"`
+	Boundaries []string      `yaml:"boundaries"`
+}
+
+// RulesFile is the layout of a filter rules YAML file.
+type RulesFile struct {
+	RuleSet `yaml:",inline"`
+	Distros map[string]RuleSet `yaml:"distros"`
+}
+
+// FilterRules decides which traced paths are system-generic, excluded or kept,
+// and how far application paths may be collapsed.
+type FilterRules struct {
+	generic    []compiledRule
+	exclude    []compiledRule
+	include    []compiledRule
+	boundaries []compiledRule
+}
+
+// compiledRule is a matcher ready for use, with a description for "rules test"
+type compiledRule struct {
+	description string
+	match       func(path string) bool
+}
+
+// RuleMatch is the outcome of checking a path against the filter rules.
+type RuleMatch struct {
+	Verdict string
+	Rule    string
+}
+
+// LoadFilterRules loads the built-in rules, adds the rule set of the host distribution, and then
+// the rules of the user file, if given. distributions holds the os-release ID of the host followed
+// by its ID_LIKE IDs (e.g. ["rocky", "rhel", "fedora"]); the first one with a rule set is used.
+func LoadFilterRules(userRulesPath string, distributions []string) (*FilterRules, error) {
+	rules := &FilterRules{}
+
+	// Start with the built-in defaults
+	if err := rules.addRulesData(defaultRulesData, "default", distributions); err != nil {
+		return nil, fmt.Errorf("invalid default rules: %w", err)
+	}
+
+	// Add user overrides
+	if userRulesPath != "" {
+		data, err := os.ReadFile(userRulesPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := rules.addRulesData(data, userRulesPath, distributions); err != nil {
+			return nil, fmt.Errorf("invalid rules file %s: %w", userRulesPath, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// DistributionID guesses the distribution ID from an OS image name, e.g. "debian" for "debian gnu/linux:12".
+// It is only used for profiles without the os-release IDs, see ProcessInfo.DistributionIDs.
+func DistributionID(osImage string) string {
+	name, _, _ := strings.Cut(strings.ToLower(osImage), ":")
+	fields := strings.Fields(name)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// addRulesData parses a rules file and adds its base rule set and the rule set of the first
+// listed distribution it has one for
+func (rules *FilterRules) addRulesData(data []byte, source string, distributions []string) error {
+	var rulesFile RulesFile
+	if err := yaml.UnmarshalStrict(data, &rulesFile); err != nil {
+		return err
+	}
+
+	if err := rules.addRuleSet(rulesFile.RuleSet, source); err != nil {
+		return err
+	}
+	for _, distribution := range distributions {
+		if distroRules, found := rulesFile.Distros[distribution]; found {
+			return rules.addRuleSet(distroRules, fmt.Sprintf("%s, %s", source, distribution))
+		}
+	}
+	return nil
+}
+
+// addRuleSet compiles the rules of a rule set and appends them
+func (rules *FilterRules) addRuleSet(ruleSet RuleSet, source string) error {
+	for _, pattern := range ruleSet.Generic {
+		rule, err := compilePathPattern(pattern, "generic", source)
+		if err != nil {
+			return err
+		}
+		rules.generic = append(rules.generic, rule)
+	}
+	for _, pattern := range ruleSet.Boundaries {
+		rule, err := compilePathPattern(pattern, "boundary", source)
+		if err != nil {
+			return err
+		}
+		rules.boundaries = append(rules.boundaries, rule)
+	}
+	for _, matcher := range ruleSet.Exclude {
+		rule, err := compileMatcher(matcher, "exclude", source)
+		if err != nil {
+			return err
+		}
+		rules.exclude = append(rules.exclude, rule)
+	}
+	for _, matcher := range ruleSet.Include {
+		rule, err := compileMatcher(matcher, "include", source)
+		if err != nil {
+			return err
+		}
+		rules.include = append(rules.include, rule)
+	}
+	return nil
+}
+
+// compilePathPattern compiles an exact path or, if it contains wildcards, a glob
+func compilePathPattern(pattern, section, source string) (compiledRule, error) {
+	// "/*" stays literal: it appears in traces as an unexpanded shell glob
+	if strings.ContainsAny(pattern, "*?") && pattern != "/*" {
+		return compileMatcher(RuleMatcher{Glob: pattern}, section, source)
+	}
+	path := pattern
+	if path != "/" {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return compiledRule{
+		description: fmt.Sprintf("%s path %q (%s)", section, pattern, source),
+		match:       func(candidate string) bool { return candidate == path },
+	}, nil
+}
+
+// Compile returns a function that checks paths against the matcher
+func (matcher RuleMatcher) Compile() (func(path string) bool, error) {
+	rule, err := compileMatcher(matcher, "path", "")
+	return rule.match, err
+}
+
+// compileMatcher compiles a prefix, glob or regex matcher
+func compileMatcher(matcher RuleMatcher, section, source string) (compiledRule, error) {
+	switch {
+	case matcher.Prefix != "":
+		prefix := matcher.Prefix
+		return compiledRule{
+			description: fmt.Sprintf("%s prefix %q (%s)", section, prefix, source),
+			match:       func(path string) bool { return strings.HasPrefix(path, prefix) },
+		}, nil
+
+	case matcher.Glob != "":
+		expression, err := regexp.Compile(globToRegex(matcher.Glob))
+		if err != nil {
+			return compiledRule{}, fmt.Errorf("invalid glob %q: %w", matcher.Glob, err)
+		}
+		return compiledRule{
+			description: fmt.Sprintf("%s glob %q (%s)", section, matcher.Glob, source),
+			match:       expression.MatchString,
+		}, nil
+
+	case matcher.Regex != "":
+		expression, err := regexp.Compile(matcher.Regex)
+		if err != nil {
+			return compiledRule{}, fmt.Errorf("invalid regex %q: %w", matcher.Regex, err)
+		}
+		return compiledRule{
+			description: fmt.Sprintf("%s regex %q (%s)", section, matcher.Regex, source),
+			match:       expression.MatchString,
+		}, nil
+	}
+
+	return compiledRule{}, fmt.Errorf("%s rule needs a prefix, glob or regex", section)
+}
+
+// globToRegex converts a path glob into an anchored regular expression.
+// "**" matches across path segments, "*" and "?" stay within one segment.
+func globToRegex(glob string) string {
+	var expression strings.Builder
+	expression.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch character := glob[i]; character {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				expression.WriteString(".*")
+				i++
+			} else {
+				expression.WriteString("[^/]*")
+			}
+		case '?':
+			expression.WriteString("[^/]")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(character)))
+		}
+	}
+	expression.WriteString("$")
+	return expression.String()
+}
+
+// Match checks a path against the rules and reports the verdict with the deciding rule.
+// Include rules take precedence over generic and exclude rules.
+func (rules *FilterRules) Match(path string) RuleMatch {
+	if rule, found := findRule(rules.include, path); found {
+		return RuleMatch{Verdict: VerdictIncluded, Rule: rule.description}
+	}
+	if rule, found := findRule(rules.generic, normalizeRulePath(path)); found {
+		return RuleMatch{Verdict: VerdictGeneric, Rule: rule.description}
+	}
+	if rule, found := findRule(rules.exclude, path); found {
+		return RuleMatch{Verdict: VerdictExcluded, Rule: rule.description}
+	}
+	return RuleMatch{Verdict: VerdictKept}
+}
+
+// IsGenericOrExcluded checks if a file path is generic or excluded
+func (rules *FilterRules) IsGenericOrExcluded(path string) bool {
+	verdict := rules.Match(path).Verdict
+	return verdict == VerdictGeneric || verdict == VerdictExcluded
+}
+
+// IsGeneric checks if a file path is system-generic
+func (rules *FilterRules) IsGeneric(path string) bool {
+	return rules.Match(path).Verdict == VerdictGeneric
+}
+
+// CollapseTarget returns the directory a path collapses to: the shortest application-specific
+// directory below the top level that is neither generic nor excluded, and not above a boundary.
+// Example: For "/etc/nginx/conf.d", it checks:
+//   - "/etc" (generic)
+//   - "/etc/nginx" (application-specific)
+//
+// If "/etc/nginx" is valid, all subpaths collapse to it.
+func (rules *FilterRules) CollapseTarget(path string) string {
+	// Split path into components
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) <= 1 {
+		// Keep short paths like "/etc" or "/usr" as-is
+		return path
+	}
+
+	// Build the candidate directories and find the deepest boundary among them
+	candidates := make([]string, len(parts))
+	lowestLevel := 1
+	for i := range parts {
+		candidates[i] = "/" + strings.Join(parts[:i+1], "/")
+		if _, found := findRule(rules.boundaries, candidates[i]); found {
+			lowestLevel = max(lowestLevel, i)
+		}
+	}
+
+	// Find the first non-generic, non-excluded directory at or below the boundary
+	for _, candidate := range candidates[lowestLevel:] {
+		if !rules.IsGenericOrExcluded(candidate) {
+			return candidate
+		}
+	}
+	return path // Default to original if no collapse possible
+}
+
+// findRule returns the first rule matching the path
+func findRule(compiledRules []compiledRule, path string) (compiledRule, bool) {
+	for _, rule := range compiledRules {
+		if rule.match(path) {
+			return rule, true
+		}
+	}
+	return compiledRule{}, false
+}
+
+// normalizeRulePath removes a trailing slash, keeping the root
+func normalizeRulePath(path string) string {
+	if path == "/" {
+		return path
+	}
+	return strings.TrimSuffix(path, "/")
+}
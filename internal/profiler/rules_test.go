@@ -0,0 +1,34 @@
+package profiler
+
+import "testing"
+
+func TestLoadFilterRulesDistributions(t *testing.T) {
+	tests := []struct {
+		name          string
+		distributions []string
+		path          string
+		want          string
+	}{
+		{"distribution with its own rule set", []string{"rhel", "fedora"}, "/var/lib/rpm", VerdictGeneric},
+		{"rule set of an ID_LIKE distribution", []string{"linuxmint", "ubuntu", "debian"}, "/var/lib/dpkg", VerdictGeneric},
+		{"rule set of another distribution", []string{"alpine"}, "/var/lib/dpkg", VerdictKept},
+		{"unknown distribution", []string{"custom"}, "/var/lib/rpm", VerdictKept},
+		// Multiarch library directories are generic whatever the distribution
+		{"multiarch directory on debian", []string{"debian"}, "/usr/lib/x86_64-linux-gnu", VerdictGeneric},
+		{"multiarch directory on a red hat distribution", []string{"rhel", "fedora"}, "/usr/lib/x86_64-linux-gnu", VerdictGeneric},
+		{"multiarch directory on alpine", []string{"alpine"}, "/lib/aarch64-linux-gnu", VerdictGeneric},
+		{"multiarch directory on an unknown distribution", nil, "/usr/lib/aarch64-linux-gnu", VerdictGeneric},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := LoadFilterRules("", test.distributions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if match := rules.Match(test.path); match.Verdict != test.want {
+				t.Errorf("%s is %s (%s), want %s", test.path, match.Verdict, match.Rule, test.want)
+			}
+		})
+	}
+}
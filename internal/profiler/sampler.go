@@ -0,0 +1,359 @@
+package profiler
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResourceSample is the resource usage of the whole process tree at one point in time.
+// CPU and disk I/O are rates over the time since the previous sample.
+type ResourceSample struct {
+	Timestamp       time.Time `json:"timestamp"`
+	ProcessIDs      []int     `json:"pids"`            // Processes of the tree at the time of the sample
+	CPUCores        float64   `json:"cpu_cores"`       // CPU cores used
+	RSSMB           float64   `json:"rss_mb"`          // Resident memory in MB
+	PSSMB           float64   `json:"pss_mb"`          // Proportional set size in MB, shared pages divided among their users
+	DiskReadMBps    float64   `json:"disk_read_mbps"`  // Disk reads in MB per second
+	DiskWriteMBps   float64   `json:"disk_write_mbps"` // Disk writes in MB per second
+	Threads         int       `json:"threads"`         // Number of threads
+	FileDescriptors int       `json:"fds"`             // Number of open file descriptors
+}
+
+// MetricSummary holds the minimum, average, 95th percentile and maximum of a sampled metric.
+type MetricSummary struct {
+	Min float64 `yaml:"min"`
+	Avg float64 `yaml:"avg"`
+	P95 float64 `yaml:"p95"`
+	Max float64 `yaml:"max"`
+}
+
+// ResourceSummary summarizes the resource samples taken during the trace window.
+type ResourceSummary struct {
+	Samples         int           `yaml:"samples"`         // Number of samples
+	IntervalSeconds float64       `yaml:"intervalseconds"` // Time between two samples
+	CPUCores        MetricSummary `yaml:"cpucores"`
+	RSSMB           MetricSummary `yaml:"rssmb"`
+	PSSMB           MetricSummary `yaml:"pssmb"`
+	DiskReadMBps    MetricSummary `yaml:"diskreadmbps"`
+	DiskWriteMBps   MetricSummary `yaml:"diskwritembps"`
+	Threads         MetricSummary `yaml:"threads"`
+	FileDescriptors MetricSummary `yaml:"filedescriptors"`
+}
+
+// processCounters holds the cumulative counters of a process at the previous sample
+type processCounters struct {
+	cpuTicks   float64
+	readBytes  float64
+	writeBytes float64
+}
+
+// resourceSampler polls the resource usage of a process tree at a fixed interval.
+// The tree consists of the root processes and all of their descendants.
+type resourceSampler struct {
+	interval     time.Duration
+	clockTicks   float64
+	mutex        sync.Mutex
+	roots        map[int]bool
+	seenThreads  map[int]bool
+	previous     map[int]processCounters
+	previousTime time.Time
+	previousBoot float64 // Seconds since boot at the previous sample
+	samples      []ResourceSample
+	stopSampling chan struct{}
+	samplingDone chan struct{}
+}
+
+// newResourceSampler creates a sampler for the trees of the given processes
+func newResourceSampler(interval time.Duration, processIDs []int) *resourceSampler {
+	sampler := &resourceSampler{
+		interval:     interval,
+		clockTicks:   getClockTicks(),
+		roots:        make(map[int]bool),
+		seenThreads:  make(map[int]bool),
+		stopSampling: make(chan struct{}),
+		samplingDone: make(chan struct{}),
+	}
+	for _, processID := range processIDs {
+		sampler.roots[processID] = true
+	}
+	return sampler
+}
+
+// AddThread adds the process of a traced thread to the sampled processes.
+// A restarted application is only known from the threads the tracer reports.
+func (sampler *resourceSampler) AddThread(threadID int) {
+	sampler.mutex.Lock()
+	defer sampler.mutex.Unlock()
+	if sampler.seenThreads[threadID] {
+		return
+	}
+	sampler.seenThreads[threadID] = true
+	sampler.roots[getThreadGroupID(threadID)] = true
+}
+
+// Start polls the process tree in the background until Stop is called
+func (sampler *resourceSampler) Start() {
+	go func() {
+		defer close(sampler.samplingDone)
+		ticker := time.NewTicker(sampler.interval)
+		defer ticker.Stop()
+
+		// The first poll only records the counters the rates of the next sample start from
+		sampler.poll()
+		for {
+			select {
+			case <-sampler.stopSampling:
+				return
+			case <-ticker.C:
+				sampler.poll()
+			}
+		}
+	}()
+}
+
+// Stop ends the sampling and returns the samples taken
+func (sampler *resourceSampler) Stop() []ResourceSample {
+	close(sampler.stopSampling)
+	<-sampler.samplingDone
+	return sampler.samples
+}
+
+// poll measures every process of the tree and records a sample
+func (sampler *resourceSampler) poll() {
+	now := time.Now()
+	secondsSinceBoot := getSystemUptime()
+	counters := make(map[int]processCounters)
+	sample := ResourceSample{Timestamp: now}
+
+	for _, processID := range sampler.processTree() {
+		stat, ok := readProcessStat(processID)
+		if !ok {
+			continue
+		}
+		current := processCounters{cpuTicks: stat.cpuTicks}
+		current.readBytes, current.writeBytes = readProcessIO(processID)
+		counters[processID] = current
+
+		sample.ProcessIDs = append(sample.ProcessIDs, processID)
+		sample.RSSMB += convertBytesToMB(float64(readResidentPages(processID) * int64(os.Getpagesize())))
+		sample.PSSMB += convertBytesToMB(float64(readProportionalSetKB(processID) * 1024))
+		sample.Threads += stat.threads
+		sample.FileDescriptors += countFileDescriptors(processID)
+
+		// Processes started since the previous sample used all of their CPU time and I/O within the interval
+		previous, found := sampler.previous[processID]
+		if !found && stat.startTicks/sampler.clockTicks < sampler.previousBoot {
+			previous = current
+		}
+		sample.CPUCores += max(current.cpuTicks-previous.cpuTicks, 0) / sampler.clockTicks
+		sample.DiskReadMBps += convertBytesToMB(max(current.readBytes-previous.readBytes, 0))
+		sample.DiskWriteMBps += convertBytesToMB(max(current.writeBytes-previous.writeBytes, 0))
+	}
+
+	// Turn the CPU time and I/O since the previous sample into rates
+	if sampler.previous != nil {
+		elapsedSeconds := now.Sub(sampler.previousTime).Seconds()
+		sample.CPUCores = roundToTwoDecimalPlaces(sample.CPUCores / elapsedSeconds)
+		sample.DiskReadMBps = roundToTwoDecimalPlaces(sample.DiskReadMBps / elapsedSeconds)
+		sample.DiskWriteMBps = roundToTwoDecimalPlaces(sample.DiskWriteMBps / elapsedSeconds)
+		sample.RSSMB = roundToTwoDecimalPlaces(sample.RSSMB)
+		sample.PSSMB = roundToTwoDecimalPlaces(sample.PSSMB)
+		sampler.samples = append(sampler.samples, sample)
+	}
+	sampler.previous = counters
+	sampler.previousTime = now
+	sampler.previousBoot = secondsSinceBoot
+}
+
+// processTree returns the running root processes and all of their descendants
+func (sampler *resourceSampler) processTree() []int {
+	sampler.mutex.Lock()
+	var roots []int
+	for processID := range sampler.roots {
+		if isProcessRunning(processID) {
+			roots = append(roots, processID)
+		} else {
+			delete(sampler.roots, processID)
+		}
+	}
+	sampler.mutex.Unlock()
+
+	// Map every process to its children
+	children := make(map[int][]int)
+	entries, _ := os.ReadDir("/proc")
+	for _, entry := range entries {
+		processID, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if stat, ok := readProcessStat(processID); ok {
+			children[stat.parentID] = append(children[stat.parentID], processID)
+		}
+	}
+
+	// Walk the tree below every root, counting a process only once
+	var tree []int
+	visited := make(map[int]bool)
+	pending := roots
+	for len(pending) > 0 {
+		processID := pending[0]
+		pending = pending[1:]
+		if visited[processID] {
+			continue
+		}
+		visited[processID] = true
+		tree = append(tree, processID)
+		pending = append(pending, children[processID]...)
+	}
+	sort.Ints(tree)
+	return tree
+}
+
+// processStat holds the fields of /proc/<pid>/stat used by the sampler
+type processStat struct {
+	parentID   int
+	cpuTicks   float64 // User and system time
+	threads    int
+	startTicks float64 // Start time after boot
+}
+
+// readProcessStat parses /proc/<pid>/stat, skipping zombies
+func readProcessStat(processID int) (processStat, bool) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", processID))
+	if err != nil {
+		return processStat{}, false
+	}
+
+	// The fields after the command name, which is enclosed in parentheses, start with the state
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 20 || fields[0] == "Z" || fields[0] == "X" {
+		return processStat{}, false
+	}
+	parentID, _ := strconv.Atoi(fields[1])
+	userTicks, _ := strconv.ParseFloat(fields[11], 64)
+	systemTicks, _ := strconv.ParseFloat(fields[12], 64)
+	threads, _ := strconv.Atoi(fields[17])
+	startTicks, _ := strconv.ParseFloat(fields[19], 64)
+	return processStat{parentID: parentID, cpuTicks: userTicks + systemTicks, threads: threads, startTicks: startTicks}, true
+}
+
+// readProcessIO returns the bytes a process read from and wrote to disk, or zero if they are not readable
+func readProcessIO(processID int) (float64, float64) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/io", processID))
+	if err != nil {
+		return 0, 0
+	}
+	var readBytes, writeBytes float64
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, found := strings.CutPrefix(line, "read_bytes:"); found {
+			readBytes, _ = strconv.ParseFloat(strings.TrimSpace(value), 64)
+		}
+		if value, found := strings.CutPrefix(line, "write_bytes:"); found {
+			writeBytes, _ = strconv.ParseFloat(strings.TrimSpace(value), 64)
+		}
+	}
+	return readBytes, writeBytes
+}
+
+// readResidentPages returns the number of resident pages of a process from /proc/<pid>/statm
+func readResidentPages(processID int) int64 {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", processID))
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, _ := strconv.ParseInt(fields[1], 10, 64)
+	return pages
+}
+
+// readProportionalSetKB returns the proportional set size of a process in kB from /proc/<pid>/smaps_rollup
+func readProportionalSetKB(processID int) int64 {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/smaps_rollup", processID))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, found := strings.CutPrefix(line, "Pss:"); found {
+			kilobytes, _ := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			return kilobytes
+		}
+	}
+	return 0
+}
+
+// countFileDescriptors returns the number of open file descriptors of a process
+func countFileDescriptors(processID int) int {
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", processID))
+	if err != nil {
+		return 0
+	}
+	return len(entries)
+}
+
+// getThreadGroupID reads the thread group (process) ID of a thread from /proc/<TID>/status
+func getThreadGroupID(threadID int) int {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", threadID))
+	if err != nil {
+		return threadID
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, found := strings.CutPrefix(line, "Tgid:"); found {
+			if threadGroupID, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+				return threadGroupID
+			}
+		}
+	}
+	return threadID
+}
+
+// SummarizeResourceSamples computes the minimum, average, 95th percentile and maximum of every metric
+func SummarizeResourceSamples(samples []ResourceSample, interval time.Duration) *ResourceSummary {
+	if len(samples) == 0 {
+		return nil
+	}
+	metric := func(value func(ResourceSample) float64) MetricSummary {
+		values := make([]float64, len(samples))
+		for i, sample := range samples {
+			values[i] = value(sample)
+		}
+		return summarizeValues(values)
+	}
+	return &ResourceSummary{
+		Samples:         len(samples),
+		IntervalSeconds: interval.Seconds(),
+		CPUCores:        metric(func(sample ResourceSample) float64 { return sample.CPUCores }),
+		RSSMB:           metric(func(sample ResourceSample) float64 { return sample.RSSMB }),
+		PSSMB:           metric(func(sample ResourceSample) float64 { return sample.PSSMB }),
+		DiskReadMBps:    metric(func(sample ResourceSample) float64 { return sample.DiskReadMBps }),
+		DiskWriteMBps:   metric(func(sample ResourceSample) float64 { return sample.DiskWriteMBps }),
+		Threads:         metric(func(sample ResourceSample) float64 { return float64(sample.Threads) }),
+		FileDescriptors: metric(func(sample ResourceSample) float64 { return float64(sample.FileDescriptors) }),
+	}
+}
+
+// summarizeValues computes the summary of a non-empty list of values, using the nearest-rank percentile
+func summarizeValues(values []float64) MetricSummary {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, value := range sorted {
+		sum += value
+	}
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	return MetricSummary{
+		Min: roundToTwoDecimalPlaces(sorted[0]),
+		Avg: roundToTwoDecimalPlaces(sum / float64(len(sorted))),
+		P95: roundToTwoDecimalPlaces(sorted[rank]),
+		Max: roundToTwoDecimalPlaces(sorted[len(sorted)-1]),
+	}
+}
@@ -0,0 +1,84 @@
+package profiler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarizeValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   MetricSummary
+	}{
+		{
+			name:   "single value",
+			values: []float64{2.5},
+			want:   MetricSummary{Min: 2.5, Avg: 2.5, P95: 2.5, Max: 2.5},
+		},
+		{
+			name:   "unsorted values",
+			values: []float64{3, 1, 2},
+			want:   MetricSummary{Min: 1, Avg: 2, P95: 3, Max: 3},
+		},
+		{
+			// The nearest rank of the 95th percentile of 20 values is the 19th
+			name:   "twenty values",
+			values: []float64{20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1},
+			want:   MetricSummary{Min: 1, Avg: 10.5, P95: 19, Max: 20},
+		},
+		{
+			// Of 21 values it is the 20th, ceil(0.95*21) = 20
+			name:   "twenty-one values",
+			values: []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 100},
+			want:   MetricSummary{Min: 1, Avg: 14.76, P95: 20, Max: 100},
+		},
+		{
+			name:   "rounded to two decimal places",
+			values: []float64{0.111, 0.222, 0.333},
+			want:   MetricSummary{Min: 0.11, Avg: 0.22, P95: 0.33, Max: 0.33},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := append([]float64(nil), test.values...)
+			if got := summarizeValues(values); got != test.want {
+				t.Errorf("summarizeValues(%v) = %+v, want %+v", test.values, got, test.want)
+			}
+			// The input is left in its order
+			for i := range values {
+				if values[i] != test.values[i] {
+					t.Fatalf("summarizeValues() reordered its input to %v", values)
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizeResourceSamples(t *testing.T) {
+	if summary := SummarizeResourceSamples(nil, time.Second); summary != nil {
+		t.Errorf("SummarizeResourceSamples(nil) = %+v, want nil", summary)
+	}
+
+	samples := []ResourceSample{
+		{CPUCores: 0.5, RSSMB: 100, Threads: 4, FileDescriptors: 10},
+		{CPUCores: 1.5, RSSMB: 120, Threads: 6, FileDescriptors: 12},
+	}
+	summary := SummarizeResourceSamples(samples, 500*time.Millisecond)
+	if summary.Samples != 2 || summary.IntervalSeconds != 0.5 {
+		t.Errorf("Samples, IntervalSeconds = %d, %v, want 2, 0.5", summary.Samples, summary.IntervalSeconds)
+	}
+	if want := (MetricSummary{Min: 0.5, Avg: 1, P95: 1.5, Max: 1.5}); summary.CPUCores != want {
+		t.Errorf("CPUCores = %+v, want %+v", summary.CPUCores, want)
+	}
+	if want := (MetricSummary{Min: 100, Avg: 110, P95: 120, Max: 120}); summary.RSSMB != want {
+		t.Errorf("RSSMB = %+v, want %+v", summary.RSSMB, want)
+	}
+	if want := (MetricSummary{Min: 4, Avg: 5, P95: 6, Max: 6}); summary.Threads != want {
+		t.Errorf("Threads = %+v, want %+v", summary.Threads, want)
+	}
+	if want := (MetricSummary{Min: 10, Avg: 11, P95: 12, Max: 12}); summary.FileDescriptors != want {
+		t.Errorf("FileDescriptors = %+v, want %+v", summary.FileDescriptors, want)
+	}
+}
@@ -1,6 +1,8 @@
 package profiler
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -34,6 +36,40 @@ func (info *ProcessInfo) SaveAsYAML() {
 	}
 }
 
+// SaveEventsAsJSONL saves the traced syscall events as JSON Lines next to the raw trace log
+func SaveEventsAsJSONL(info *ProcessInfo, events []SyscallEvent) {
+	saveJSONL(BuildFilePath(fmt.Sprintf("output/%d/profile", info.PID), "strace_events.jsonl"), events)
+}
+
+// SaveResourceSamplesAsJSONL saves the resource samples of the trace window as JSON Lines
+func SaveResourceSamplesAsJSONL(info *ProcessInfo, samples []ResourceSample) {
+	saveJSONL(BuildFilePath(fmt.Sprintf("output/%d/profile", info.PID), "resource_samples.jsonl"), samples)
+}
+
+// saveJSONL writes the records to a JSON Lines file, one record per line
+func saveJSONL[T any](filePath string, records []T) {
+	// Create or overwrite the specified file
+	file, err := os.Create(filePath)
+	if err != nil {
+		log.Error("Failed to create JSON Lines file", "filePath", filePath, "error", err)
+		return
+	}
+	defer file.Close()
+
+	// Encode one record per line
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			log.Error("Failed to write record to JSON Lines file", "filePath", filePath, "error", err)
+			return
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		log.Error("Failed to write JSON Lines file", "filePath", filePath, "error", err)
+	}
+}
+
 // LoadFromYAML loads process info from a YAML file.
 func LoadFromYAML(path string) *ProcessInfo {
 	data, err := os.ReadFile(path)
@@ -0,0 +1,137 @@
+package profiler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// GetStaticPaths collects the files already in use by the given processes from /proc.
+// It covers mapped files (executables, shared libraries) and open file descriptors,
+// which an attached tracer cannot observe because they were opened before it attached.
+func GetStaticPaths(processIDs []int) []string {
+	seenPaths := make(map[string]bool)
+	var staticPaths []string
+
+	for _, processID := range processIDs {
+		paths := append(GetMappedFiles(processID), GetOpenFiles(processID)...)
+		for _, path := range paths {
+			if !seenPaths[path] {
+				seenPaths[path] = true
+				staticPaths = append(staticPaths, path)
+			}
+		}
+	}
+
+	sort.Strings(staticPaths)
+	return staticPaths
+}
+
+// GetMappedFiles retrieves the file-backed memory mappings of the process from /proc/<PID>/maps
+func GetMappedFiles(processID int) []string {
+	mappedFiles, err := readMappedFiles(fmt.Sprintf("/proc/%d/maps", processID))
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to read memory maps for PID %d", processID), "error", err)
+		return []string{}
+	}
+	return mappedFiles
+}
+
+// GetOpenFiles retrieves the files and directories held open by the process from /proc/<PID>/fd
+func GetOpenFiles(processID int) []string {
+	openFiles, err := readOpenFiles(fmt.Sprintf("/proc/%d/fd", processID))
+	if err != nil {
+		log.Error(fmt.Sprintf("Reading file descriptors for PID %d", processID), "error", err)
+		return []string{}
+	}
+	return openFiles
+}
+
+// readMappedFiles returns the files on disk mapped in a maps file (format of /proc/<PID>/maps)
+func readMappedFiles(mapsFilePath string) ([]string, error) {
+	file, err := os.Open(mapsFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var mappedFiles []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if path, found := parseMapsLine(scanner.Text()); found {
+			mappedFiles = append(mappedFiles, path)
+		}
+	}
+	return mappedFiles, scanner.Err()
+}
+
+// readOpenFiles returns the files on disk targeted by the links in a file descriptor
+// directory (format of /proc/<PID>/fd)
+func readOpenFiles(fdPath string) ([]string, error) {
+	fds, err := os.ReadDir(fdPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var openFiles []string
+	for _, fd := range fds {
+		linkTarget, err := os.Readlink(filepath.Join(fdPath, fd.Name()))
+		if err != nil {
+			continue
+		}
+		if path, found := parseFdTarget(linkTarget); found {
+			openFiles = append(openFiles, path)
+		}
+	}
+	return openFiles, nil
+}
+
+// parseMapsLine returns the file on disk backing a memory mapping, if any.
+// Format: address perms offset dev inode [pathname], e.g.
+// "7f2c1a600000-7f2c1a628000 r--p 00000000 08:01 1835 /usr/lib/x86_64-linux-gnu/libc.so.6"
+func parseMapsLine(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 6 {
+		// Anonymous mapping
+		return "", false
+	}
+
+	// Pathnames may contain spaces, so rejoin the remaining fields
+	path := strings.Join(fields[5:], " ")
+	return path, isStaticFilePath(path)
+}
+
+// parseFdTarget returns the file on disk a file descriptor link points to, if any.
+// Sockets, pipes and anonymous inodes (e.g., "socket:[12345]") are not files on disk.
+func parseFdTarget(linkTarget string) (string, bool) {
+	return linkTarget, isStaticFilePath(linkTarget)
+}
+
+// SaveStaticPaths writes the statically discovered paths to static_paths.log in the profile directory
+func SaveStaticPaths(info *ProcessInfo, staticPaths []string) {
+	filePath := BuildFilePath(fmt.Sprintf("output/%d/profile", info.PID), "static_paths.log")
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		log.Error("Failed to create static paths file", "filePath", filePath, "error", err)
+		return
+	}
+	defer file.Close()
+
+	for _, path := range staticPaths {
+		if _, err := file.WriteString(path + "\n"); err != nil {
+			log.Error("Failed to write static path", "filePath", filePath, "error", err)
+			return
+		}
+	}
+}
+
+// isStaticFilePath checks if a /proc entry refers to a real file on disk
+func isStaticFilePath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasSuffix(path, " (deleted)") && !strings.HasPrefix(path, "/memfd:")
+}
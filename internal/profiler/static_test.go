@@ -0,0 +1,91 @@
+package profiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMapsLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		wantPath  string
+		wantFound bool
+	}{
+		{"shared library", "7f2c1a600000-7f2c1a628000 r--p 00000000 08:01 1835                       /usr/lib/x86_64-linux-gnu/libc.so.6", "/usr/lib/x86_64-linux-gnu/libc.so.6", true},
+		{"path with spaces", "7f2c1a800000-7f2c1a810000 r--s 00000000 08:01 2211 /usr/share/app/icon theme.cache", "/usr/share/app/icon theme.cache", true},
+		{"deleted file", "7f2c1a510000-7f2c1a520000 r--p 00000000 08:01 1835 /var/lib/app/plugin.so (deleted)", "/var/lib/app/plugin.so (deleted)", false},
+		{"memfd", "7f2c1a500000-7f2c1a510000 rw-s 00000000 00:01 4097 /memfd:pulseaudio (deleted)", "/memfd:pulseaudio (deleted)", false},
+		{"anonymous", "7f2c1a000000-7f2c1a021000 rw-p 00000000 00:00 0 ", "", false},
+		{"heap", "55d0c2f3e000-55d0c2f9c000 rw-p 00000000 00:00 0                          [heap]", "[heap]", false},
+		{"vdso", "7ffd5b9ca000-7ffd5b9cc000 r-xp 00000000 00:00 0                          [vdso]", "[vdso]", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, found := parseMapsLine(test.line)
+			if path != test.wantPath || found != test.wantFound {
+				t.Errorf("parseMapsLine(%q) = (%q, %v), want (%q, %v)", test.line, path, found, test.wantPath, test.wantFound)
+			}
+		})
+	}
+}
+
+func TestParseFdTarget(t *testing.T) {
+	tests := []struct {
+		linkTarget string
+		wantFound  bool
+	}{
+		{"/var/log/nginx/error.log", true},
+		{"/etc/nginx", true},
+		{"/dev/null", true},
+		{"socket:[27182]", false},
+		{"pipe:[31415]", false},
+		{"anon_inode:[eventpoll]", false},
+		{"anon_inode:inotify", false},
+		{"/var/lib/app/cache.db (deleted)", false},
+		{"/memfd:snapshot (deleted)", false},
+	}
+
+	for _, test := range tests {
+		path, found := parseFdTarget(test.linkTarget)
+		if path != test.linkTarget || found != test.wantFound {
+			t.Errorf("parseFdTarget(%q) = (%q, %v), want (%q, %v)", test.linkTarget, path, found, test.linkTarget, test.wantFound)
+		}
+	}
+}
+
+func TestReadMappedFiles(t *testing.T) {
+	mappedFiles, err := readMappedFiles("testdata/proc/1234/maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted files, memfds, anonymous and special regions are skipped
+	want := []string{
+		"/usr/sbin/nginx",
+		"/usr/sbin/nginx",
+		"/usr/lib/x86_64-linux-gnu/libc.so.6",
+		"/usr/share/app/icon theme.cache",
+	}
+	if !reflect.DeepEqual(mappedFiles, want) {
+		t.Errorf("readMappedFiles() = %q, want %q", mappedFiles, want)
+	}
+
+	if _, err := readMappedFiles("testdata/proc/1234/missing"); err == nil {
+		t.Error("readMappedFiles() of a missing file returned no error")
+	}
+}
+
+func TestReadOpenFiles(t *testing.T) {
+	openFiles, err := readOpenFiles("testdata/proc/1234/fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sockets, pipes, anonymous inodes, deleted files and memfds are skipped
+	want := []string{"/dev/null", "/var/log/nginx/error.log", "/etc/nginx"}
+	if !reflect.DeepEqual(openFiles, want) {
+		t.Errorf("readOpenFiles() = %q, want %q", openFiles, want)
+	}
+}
@@ -0,0 +1,202 @@
+package profiler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// straceDetachTimeout is how long strace may take to detach from its tracees after SIGINT
+const straceDetachTimeout = 5 * time.Second
+
+// straceTracer is a Tracer backed by the strace binary.
+// strace writes its raw log to disk, which is followed and parsed into events.
+type straceTracer struct {
+	logfilePath   string
+	parser        *StraceParser
+	command       *exec.Cmd
+	stderrBuffer  bytes.Buffer
+	events        chan SyscallEvent
+	stopFollowing chan struct{}
+	followDone    chan struct{}
+}
+
+// newStraceTracer creates a strace-backed tracer writing its raw log to logfilePath
+func newStraceTracer(logfilePath string) *straceTracer {
+	return &straceTracer{
+		logfilePath:   logfilePath,
+		parser:        NewStraceParser(),
+		events:        make(chan SyscallEvent, 1024),
+		stopFollowing: make(chan struct{}),
+		followDone:    make(chan struct{}),
+	}
+}
+
+// Start launches the application under strace
+func (tracer *straceTracer) Start(info *ProcessInfo) error {
+	return tracer.run(prepareStraceCommand(info, tracer.logfilePath))
+}
+
+// Attach attaches strace to the given running processes
+func (tracer *straceTracer) Attach(processIDs []int) error {
+	return tracer.run(prepareStraceAttachCommand(processIDs, tracer.logfilePath))
+}
+
+// Events returns the stream of parsed strace events
+func (tracer *straceTracer) Events() <-chan SyscallEvent {
+	return tracer.events
+}
+
+// Stop detaches strace and waits until the remaining log lines have been parsed
+func (tracer *straceTracer) Stop() error {
+	if tracer.command == nil || tracer.command.Process == nil {
+		return errors.New("strace is not running")
+	}
+	err := detachStrace(tracer.command, tracer.logfilePath)
+	close(tracer.stopFollowing)
+	<-tracer.followDone
+	return err
+}
+
+// run starts the strace command and begins following its log file
+func (tracer *straceTracer) run(command *exec.Cmd) error {
+	// Create the log file up front so it can be followed immediately
+	logFile, err := os.Create(tracer.logfilePath)
+	if err != nil {
+		return err
+	}
+
+	command.Stderr = &tracer.stderrBuffer
+	tracer.command = command
+	if err := command.Start(); err != nil {
+		logFile.Close()
+		return fmt.Errorf("%w: %s", err, tracer.stderrBuffer.String())
+	}
+
+	go tracer.followLog(logFile)
+	return nil
+}
+
+// followLog reads the strace log as it grows and emits an event for every parsed line
+func (tracer *straceTracer) followLog(logFile *os.File) {
+	defer close(tracer.followDone)
+	defer close(tracer.events)
+	defer logFile.Close()
+
+	reader := bufio.NewReader(logFile)
+	var partialLine string
+	for {
+		chunk, err := reader.ReadString('\n')
+		partialLine += chunk
+		if err == nil {
+			tracer.emit(partialLine)
+			partialLine = ""
+			continue
+		}
+		if err != io.EOF {
+			log.Error("Failed to read strace log", "error", err)
+			return
+		}
+
+		// At the end of the file: finish once stopped, otherwise wait for more output
+		select {
+		case <-tracer.stopFollowing:
+			if _, err := reader.Peek(1); err == io.EOF {
+				tracer.emit(partialLine)
+				return
+			}
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// emit parses a strace log line and sends it as an event
+func (tracer *straceTracer) emit(line string) {
+	if event, ok := tracer.parser.ParseLine(line); ok {
+		tracer.events <- event
+	}
+}
+
+// prepareStraceCommand constructs the strace command to execute
+func prepareStraceCommand(info *ProcessInfo, logfilePath string) *exec.Cmd {
+	// Use setsid to start the process in a new session (detach from strace)
+	commandline := fmt.Sprintf("setsid %s", info.ReconstructedCommand)
+
+	// Prepare the strace command arguments
+	commandArguments := append([]string{"strace"}, straceArguments(logfilePath)...)
+	commandArguments = append(commandArguments, "bash", "-c", commandline)
+
+	command := exec.Command("sudo", commandArguments...)
+	command.Dir = info.WorkingDirectory
+	command.Env = info.EnvironmentVariables
+
+	return command
+}
+
+// prepareStraceAttachCommand constructs the strace command that attaches to the given PIDs
+func prepareStraceAttachCommand(processIDs []int, logfilePath string) *exec.Cmd {
+	// Prepare the strace command arguments; -f also attaches to all threads of each PID
+	commandArguments := append([]string{"strace"}, straceArguments(logfilePath)...)
+	for _, processID := range processIDs {
+		commandArguments = append(commandArguments, "-p", strconv.Itoa(processID))
+	}
+
+	return exec.Command("sudo", commandArguments...)
+}
+
+// straceArguments returns the strace options shared by all tracing modes:
+// follow forks, timestamp every call, decode fds to paths and log file-related calls.
+// -I1 keeps SIGINT deliverable, so strace detaches on Stop even when it launched the program
+// itself (default -I3) or runs detached with -D (default -I4), which both ignore SIGINT.
+func straceArguments(logfilePath string) []string {
+	return []string{
+		"-I1",
+		"-f",
+		"-ttt",
+		"-y",
+		"-e", "trace=%file,%process,fchdir",
+		"-o", logfilePath,
+	}
+}
+
+// detachStrace interrupts strace so it detaches cleanly from the traced processes,
+// and waits for the sudo command running it to exit
+func detachStrace(command *exec.Cmd, logfilePath string) error {
+	// Signal strace itself instead of relying on sudo to relay the signal
+	var err error
+	if straceIDs := findStraceProcesses(logfilePath); len(straceIDs) > 0 {
+		err = interruptStrace(straceIDs)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- command.Wait() }()
+
+	select {
+	case <-done:
+		return err
+	case <-time.After(straceDetachTimeout):
+		return errors.Join(err, fmt.Errorf("strace command did not exit within %s", straceDetachTimeout))
+	}
+}
+
+// interruptStrace sends SIGINT to the strace processes, which detach from their tracees and exit.
+// strace still running after straceDetachTimeout is killed and reported as an error,
+// as the application may have stayed traced until then.
+func interruptStrace(straceIDs []int) error {
+	signalProcesses(straceIDs, syscall.SIGINT)
+	if waitForExit(straceIDs, straceDetachTimeout) {
+		return nil
+	}
+	running := runningProcesses(straceIDs)
+	signalProcesses(running, syscall.SIGKILL)
+	return fmt.Errorf("strace processes %v did not detach within %s and were killed", running, straceDetachTimeout)
+}
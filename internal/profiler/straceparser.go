@@ -0,0 +1,312 @@
+package profiler
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// straceLineRegex matches an optional "[pid N]" or "N" prefix, an optional timestamp and the remainder
+	straceLineRegex = regexp.MustCompile(`^(?:\[pid\s+(\d+)\]\s*|(\d+)\s+)?(?:(\d+\.\d+|\d{2}:\d{2}:\d{2}(?:\.\d+)?)\s+)?(.*)$`)
+	// straceResumedRegex matches the start of a resumed call, e.g. "<... openat resumed>"
+	straceResumedRegex = regexp.MustCompile(`^<\.\.\. (\w+) resumed>\s?(.*)$`)
+	// straceResultRegex matches the result of a call, e.g. "= -1 ENOENT (No such file or directory)"
+	straceResultRegex = regexp.MustCompile(`^\s*=\s*(-?\d+|0x[0-9a-f]+|\?)(?:<[^>]*>)?(?:\s+(E[A-Z0-9]+))?`)
+)
+
+const straceUnfinishedSuffix = "<unfinished ...>"
+
+// StraceParser converts "strace -f" output lines into SyscallEvents.
+// It joins calls that strace splits into "<unfinished ...>" and "<... resumed>" lines
+// when another process issues a syscall in between.
+type StraceParser struct {
+	pendingCalls map[int]pendingCall
+}
+
+// pendingCall holds the first half of an unfinished system call
+type pendingCall struct {
+	timestamp time.Time
+	text      string
+}
+
+// NewStraceParser creates a parser with no pending calls
+func NewStraceParser() *StraceParser {
+	return &StraceParser{pendingCalls: make(map[int]pendingCall)}
+}
+
+// ParseLine parses a single strace output line.
+// It returns false for signal and exit notices and for the first half of unfinished calls.
+func (parser *StraceParser) ParseLine(line string) (SyscallEvent, bool) {
+	match := straceLineRegex.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if match == nil {
+		return SyscallEvent{}, false
+	}
+	processID, _ := strconv.Atoi(match[1] + match[2])
+	timestamp := parseStraceTimestamp(match[3])
+	body := match[4]
+
+	// Skip signal deliveries ("--- SIGCHLD ...") and exit notices ("+++ exited with 0 +++")
+	if body == "" || strings.HasPrefix(body, "---") || strings.HasPrefix(body, "+++") {
+		return SyscallEvent{}, false
+	}
+
+	// Keep the first half of an unfinished call until it is resumed
+	if strings.HasSuffix(body, straceUnfinishedSuffix) {
+		text := strings.TrimSpace(strings.TrimSuffix(body, straceUnfinishedSuffix))
+		parser.pendingCalls[processID] = pendingCall{timestamp: timestamp, text: text}
+		return SyscallEvent{}, false
+	}
+
+	// Join a resumed call with its pending first half
+	if resumed := straceResumedRegex.FindStringSubmatch(body); resumed != nil {
+		pending, found := parser.pendingCalls[processID]
+		delete(parser.pendingCalls, processID)
+		if !found {
+			// The first half was lost (e.g., tracing started mid-call): keep only the result
+			pending = pendingCall{timestamp: timestamp, text: resumed[1] + "("}
+		}
+		body = joinResumedCall(pending.text, resumed[2])
+		timestamp = pending.timestamp
+	}
+
+	event, ok := parseStraceCall(body)
+	if !ok {
+		return SyscallEvent{}, false
+	}
+	event.PID = processID
+	event.Timestamp = timestamp
+	return event, true
+}
+
+// joinResumedCall concatenates the two halves of a split call, restoring the argument separator.
+// strace usually splits after the input arguments, e.g. "read(3, <unfinished ...>".
+func joinResumedCall(firstHalf, secondHalf string) string {
+	switch {
+	case strings.HasSuffix(firstHalf, ","):
+		return firstHalf + " " + secondHalf
+	case strings.HasPrefix(secondHalf, ",") || strings.HasPrefix(secondHalf, ")") || strings.HasSuffix(firstHalf, "("):
+		return firstHalf + secondHalf
+	}
+	return firstHalf + ", " + secondHalf
+}
+
+// parseStraceCall parses "name(arguments) = result" into a SyscallEvent
+func parseStraceCall(text string) (SyscallEvent, bool) {
+	openIndex := strings.IndexByte(text, '(')
+	if openIndex <= 0 {
+		return SyscallEvent{}, false
+	}
+	name := text[:openIndex]
+	if strings.ContainsAny(name, " \t<>") {
+		return SyscallEvent{}, false
+	}
+
+	// Split the argument list and locate the closing parenthesis
+	arguments, closeIndex := splitStraceArguments(text[openIndex+1:])
+	event := SyscallEvent{Syscall: name, Arguments: arguments}
+
+	// Parse the result, if the call completed
+	if closeIndex >= 0 {
+		result := text[openIndex+1+closeIndex+1:]
+		if resultMatch := straceResultRegex.FindStringSubmatch(result); resultMatch != nil {
+			event.ReturnValue = parseStraceReturnValue(resultMatch[1])
+			event.Errno = resultMatch[2]
+		}
+	}
+
+	// Decode path and flag arguments
+	event.Paths = extractPathArguments(name, arguments)
+	event.Flags = extractFlagArgument(name, arguments)
+	return event, true
+}
+
+// splitStraceArguments splits a strace argument list at top-level commas.
+// It honours quoted strings, nested brackets and fd annotations, and returns the
+// index of the closing parenthesis (or -1 if the list is incomplete).
+func splitStraceArguments(text string) ([]string, int) {
+	var arguments []string
+	var current strings.Builder
+	depth := 0
+	inQuotes := false
+
+	for i := 0; i < len(text); i++ {
+		character := text[i]
+		switch {
+		case inQuotes:
+			if character == '\\' && i+1 < len(text) {
+				current.WriteByte(character)
+				i++
+				character = text[i]
+			} else if character == '"' {
+				inQuotes = false
+			}
+		case character == '"':
+			inQuotes = true
+		case character == '(' || character == '[' || character == '{' || character == '<':
+			depth++
+		case (character == ']' || character == '}' || character == '>') && depth > 0:
+			depth--
+		case character == ')' && depth > 0:
+			depth--
+		case character == ')':
+			arguments = appendArgument(arguments, current.String())
+			return arguments, i
+		case character == ',' && depth == 0:
+			arguments = appendArgument(arguments, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteByte(character)
+	}
+
+	return appendArgument(arguments, current.String()), -1
+}
+
+// appendArgument appends a trimmed, non-empty argument
+func appendArgument(arguments []string, argument string) []string {
+	argument = strings.TrimSpace(argument)
+	if argument == "" {
+		return arguments
+	}
+	return append(arguments, argument)
+}
+
+// extractPathArguments decodes the path arguments of a call.
+// Calls missing from the syscall table fall back to every quoted string argument.
+func extractPathArguments(name string, arguments []string) []string {
+	var paths []string
+	spec, known := syscallSpecs[name]
+	if !known {
+		for _, argument := range arguments {
+			if path, ok := decodeStraceString(argument); ok {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	}
+
+	for _, argumentIndex := range spec.pathArguments {
+		if argumentIndex >= len(arguments) {
+			continue
+		}
+		if path, ok := decodeStraceString(arguments[argumentIndex]); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// extractFlagArgument splits the flags argument of a call into symbolic names
+func extractFlagArgument(name string, arguments []string) []string {
+	spec, known := syscallSpecs[name]
+	if !known || spec.flagArgument < 0 || spec.flagArgument >= len(arguments) {
+		return nil
+	}
+	argument := arguments[spec.flagArgument]
+
+	// openat2 and clone3 pass their flags in a struct: {flags=O_RDONLY|O_CLOEXEC, mode=0, resolve=0}
+	if strings.HasPrefix(argument, "{") {
+		for _, field := range strings.Split(strings.Trim(argument, "{}"), ",") {
+			if value, found := strings.CutPrefix(strings.TrimSpace(field), "flags="); found {
+				argument = value
+			}
+		}
+	}
+	// clone names its flags argument: flags=CLONE_VM|CLONE_FS|...
+	argument = strings.TrimPrefix(argument, "flags=")
+
+	var flags []string
+	for _, flag := range strings.Split(argument, "|") {
+		flag = strings.TrimSpace(flag)
+		if flag != "" && flag != "0" {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+// decodeStraceString decodes a quoted, C-escaped strace string argument.
+// Truncated strings (followed by "...") are returned as far as they were printed.
+func decodeStraceString(argument string) (string, bool) {
+	if !strings.HasPrefix(argument, "\"") {
+		return "", false
+	}
+	var decoded strings.Builder
+	for i := 1; i < len(argument); i++ {
+		character := argument[i]
+		if character == '"' {
+			return decoded.String(), true
+		}
+		if character != '\\' || i+1 >= len(argument) {
+			decoded.WriteByte(character)
+			continue
+		}
+
+		i++
+		switch escape := argument[i]; escape {
+		case 'n':
+			decoded.WriteByte('\n')
+		case 't':
+			decoded.WriteByte('\t')
+		case 'r':
+			decoded.WriteByte('\r')
+		case 'v':
+			decoded.WriteByte('\v')
+		case 'f':
+			decoded.WriteByte('\f')
+		case 'x':
+			end := min(i+3, len(argument))
+			value, err := strconv.ParseUint(argument[i+1:end], 16, 8)
+			if err != nil {
+				decoded.WriteByte(escape)
+				continue
+			}
+			decoded.WriteByte(byte(value))
+			i = end - 1
+		default:
+			if escape < '0' || escape > '7' {
+				decoded.WriteByte(escape)
+				continue
+			}
+			// Octal escapes have one to three digits
+			end := i + 1
+			for end < len(argument) && end < i+3 && argument[end] >= '0' && argument[end] <= '7' {
+				end++
+			}
+			value, _ := strconv.ParseUint(argument[i:end], 8, 8)
+			decoded.WriteByte(byte(value))
+			i = end - 1
+		}
+	}
+	return decoded.String(), true
+}
+
+// parseStraceReturnValue parses a decimal or hexadecimal return value ("?" yields 0)
+func parseStraceReturnValue(value string) int64 {
+	if hexValue, found := strings.CutPrefix(value, "0x"); found {
+		parsed, _ := strconv.ParseUint(hexValue, 16, 64)
+		return int64(parsed)
+	}
+	parsed, _ := strconv.ParseInt(value, 10, 64)
+	return parsed
+}
+
+// parseStraceTimestamp parses "-ttt" (epoch seconds) or "-tt" (time of day) timestamps
+func parseStraceTimestamp(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if strings.Contains(value, ":") {
+		parsed, _ := time.ParseInLocation("15:04:05.999999", value, time.Local)
+		return parsed
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9))
+}
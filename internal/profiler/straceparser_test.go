@@ -0,0 +1,193 @@
+package profiler
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// expectedEvent holds the fields of a parsed event checked by the tests, and its resolved paths
+type expectedEvent struct {
+	pid      int
+	syscall  string
+	paths    []string
+	flags    []string
+	result   int64
+	errno    string
+	resolved []string
+}
+
+func TestStraceParser(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []expectedEvent
+	}{
+		{
+			name: "interleaved unfinished and resumed calls",
+			lines: []string{
+				`1200  1700000000.000100 openat(AT_FDCWD, "/etc/nginx/nginx.conf", O_RDONLY|O_CLOEXEC <unfinished ...>`,
+				`1201  1700000000.000150 stat("/var/www/html", {st_mode=S_IFDIR|0755, st_size=4096, ...}) = 0`,
+				`1202  1700000000.000160 readlink("/proc/self/exe", <unfinished ...>`,
+				`1200  1700000000.000200 <... openat resumed>) = 3`,
+				`1201  1700000000.000250 --- SIGCHLD {si_signo=SIGCHLD, si_code=CLD_EXITED, si_pid=1203} ---`,
+				`1202  1700000000.000300 <... readlink resumed>"/usr/sbin/nginx", 4095) = 15`,
+				`1201  1700000000.000350 +++ exited with 0 +++`,
+			},
+			want: []expectedEvent{
+				{pid: 1201, syscall: "stat", paths: []string{"/var/www/html"}, resolved: []string{"/var/www/html"}},
+				{pid: 1200, syscall: "openat", paths: []string{"/etc/nginx/nginx.conf"}, flags: []string{"O_RDONLY", "O_CLOEXEC"},
+					result: 3, resolved: []string{"/etc/nginx/nginx.conf"}},
+				{pid: 1202, syscall: "readlink", paths: []string{"/proc/self/exe"}, result: 15,
+					resolved: []string{"/proc/self/exe"}},
+			},
+		},
+		{
+			name: "unfinished calls split inside the argument list",
+			lines: []string{
+				`[pid  1300] openat(AT_FDCWD, "/etc/hosts", <unfinished ...>`,
+				`[pid  1301] openat(AT_FDCWD, "/etc/resolv.conf", O_RDONLY <unfinished ...>`,
+				`[pid  1300] <... openat resumed>O_RDONLY|O_CLOEXEC) = 4`,
+				`[pid  1301] <... openat resumed>) = -1 ENOENT (No such file or directory)`,
+			},
+			want: []expectedEvent{
+				{pid: 1300, syscall: "openat", paths: []string{"/etc/hosts"}, flags: []string{"O_RDONLY", "O_CLOEXEC"},
+					result: 4, resolved: []string{"/etc/hosts"}},
+				{pid: 1301, syscall: "openat", paths: []string{"/etc/resolv.conf"}, flags: []string{"O_RDONLY"},
+					result: -1, errno: "ENOENT", resolved: []string{"/etc/resolv.conf"}},
+			},
+		},
+		{
+			name: "resumed call whose first half was not traced",
+			lines: []string{
+				`1400  <... accept4 resumed>{sa_family=AF_INET, sin_port=htons(51234), sin_addr=inet_addr("127.0.0.1")}, [16], SOCK_CLOEXEC) = 9`,
+				`1400  <... openat resumed>) = 5`,
+			},
+			want: []expectedEvent{
+				{pid: 1400, syscall: "accept4", result: 9},
+				{pid: 1400, syscall: "openat", result: 5},
+			},
+		},
+		{
+			name: "strace -y path annotations",
+			lines: []string{
+				`1500  openat(3</etc/nginx>, "conf.d/default.conf", O_RDONLY) = 4</etc/nginx/conf.d/default.conf>`,
+				`1500  newfstatat(AT_FDCWD</srv/app>, "static/index.html", {st_mode=S_IFREG|0644, st_size=612, ...}, 0) = 0`,
+				`1500  fchdir(6</var/lib/mysql>) = 0`,
+				`1500  openat(AT_FDCWD, "ibdata1", O_RDWR|O_CREAT, 0640) = 7</var/lib/mysql/ibdata1>`,
+				`1500  openat(8<socket:[41231]>, "relative", O_RDONLY) = -1 ENOTDIR (Not a directory)`,
+			},
+			want: []expectedEvent{
+				{pid: 1500, syscall: "openat", paths: []string{"conf.d/default.conf"}, flags: []string{"O_RDONLY"},
+					result: 4, resolved: []string{"/etc/nginx/conf.d/default.conf"}},
+				{pid: 1500, syscall: "newfstatat", paths: []string{"static/index.html"},
+					resolved: []string{"/srv/app/static/index.html"}},
+				{pid: 1500, syscall: "fchdir"},
+				{pid: 1500, syscall: "openat", paths: []string{"ibdata1"}, flags: []string{"O_RDWR", "O_CREAT"},
+					result: 7, resolved: []string{"/var/lib/mysql/ibdata1"}},
+				{pid: 1500, syscall: "openat", paths: []string{"relative"}, flags: []string{"O_RDONLY"},
+					result: -1, errno: "ENOTDIR"},
+			},
+		},
+		{
+			name: "calls with several paths",
+			lines: []string{
+				`1600  rename("/run/nginx.pid.new", "/run/nginx.pid") = 0`,
+				`1600  symlinkat("/usr/share/zoneinfo/UTC", AT_FDCWD, "/etc/localtime") = 0`,
+				`1601  symlinkat("../lib/app.so.1", 5</opt/app/bin>, "app.so") = 0`,
+				`1601  renameat2(AT_FDCWD, "state.tmp", 9</var/lib/app>, "state", RENAME_NOREPLACE) = 0`,
+				`1601  linkat(AT_FDCWD, "/srv/a", AT_FDCWD, "/srv/b", 0) = -1 EEXIST (File exists)`,
+			},
+			want: []expectedEvent{
+				{pid: 1600, syscall: "rename", paths: []string{"/run/nginx.pid.new", "/run/nginx.pid"},
+					resolved: []string{"/run/nginx.pid.new", "/run/nginx.pid"}},
+				{pid: 1600, syscall: "symlinkat", paths: []string{"/usr/share/zoneinfo/UTC", "/etc/localtime"},
+					resolved: []string{"/usr/share/zoneinfo/UTC", "/etc/localtime"}},
+				{pid: 1601, syscall: "symlinkat", paths: []string{"../lib/app.so.1", "app.so"},
+					resolved: []string{"/lib/app.so.1", "/opt/app/bin/app.so"}},
+				{pid: 1601, syscall: "renameat2", paths: []string{"state.tmp", "state"}, flags: []string{"RENAME_NOREPLACE"},
+					resolved: []string{"/state.tmp", "/var/lib/app/state"}},
+				{pid: 1601, syscall: "linkat", paths: []string{"/srv/a", "/srv/b"}, result: -1, errno: "EEXIST",
+					resolved: []string{"/srv/a", "/srv/b"}},
+			},
+		},
+		{
+			name: "escaped and truncated path strings",
+			lines: []string{
+				`1700  openat(AT_FDCWD, "/srv/caf\303\251 \"menu\".txt", O_RDONLY) = 3`,
+				`1700  stat("/srv/tab\there\x41", 0x7ffd5c9e1e10) = 0`,
+				`1700  execve("/usr/bin/python3", ["python3", "-c", "import sys; print(sys.path)"...], 0x7ffd /* 12 vars */) = 0`,
+			},
+			want: []expectedEvent{
+				{pid: 1700, syscall: "openat", paths: []string{"/srv/café \"menu\".txt"}, flags: []string{"O_RDONLY"},
+					result: 3, resolved: []string{"/srv/café \"menu\".txt"}},
+				{pid: 1700, syscall: "stat", paths: []string{"/srv/tab\thereA"}, resolved: []string{"/srv/tab\thereA"}},
+				{pid: 1700, syscall: "execve", paths: []string{"/usr/bin/python3"}, resolved: []string{"/usr/bin/python3"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parser := NewStraceParser()
+			var events []SyscallEvent
+			for _, line := range test.lines {
+				if event, ok := parser.ParseLine(line); ok {
+					events = append(events, event)
+				}
+			}
+			if len(events) != len(test.want) {
+				t.Fatalf("parsed %d events, want %d: %+v", len(events), len(test.want), events)
+			}
+
+			resolver := NewPathResolver(events, "/", nil)
+			for index, event := range events {
+				want := test.want[index]
+				if event.PID != want.pid || event.Syscall != want.syscall {
+					t.Errorf("event %d is %d %s, want %d %s", index, event.PID, event.Syscall, want.pid, want.syscall)
+				}
+				if !slices.Equal(event.Paths, want.paths) {
+					t.Errorf("event %d paths = %q, want %q", index, event.Paths, want.paths)
+				}
+				if !slices.Equal(event.Flags, want.flags) {
+					t.Errorf("event %d flags = %q, want %q", index, event.Flags, want.flags)
+				}
+				if event.ReturnValue != want.result || event.Errno != want.errno {
+					t.Errorf("event %d result = %d %s, want %d %s", index, event.ReturnValue, event.Errno, want.result, want.errno)
+				}
+				if resolved := resolver.ResolvePaths(event); !slices.Equal(resolved, want.resolved) {
+					t.Errorf("event %d resolved paths = %q, want %q", index, resolved, want.resolved)
+				}
+				resolver.Observe(event)
+			}
+		})
+	}
+}
+
+func TestStraceParserKeepsTimestampOfFirstHalf(t *testing.T) {
+	parser := NewStraceParser()
+	lines := []string{
+		`[pid  1800] 10:15:30.250000 connect(4, {sa_family=AF_UNIX, sun_path="/run/mysqld/mysqld.sock"}, 110 <unfinished ...>`,
+		`[pid  1801] 10:15:30.260000 openat(AT_FDCWD, "/tmp/x", O_RDONLY) = 5`,
+		`[pid  1800] 10:15:30.900000 <... connect resumed>) = 0`,
+	}
+
+	var events []SyscallEvent
+	for _, line := range lines {
+		if event, ok := parser.ParseLine(line); ok {
+			events = append(events, event)
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("parsed %d events, want 2", len(events))
+	}
+
+	connect := events[1]
+	want := time.Date(0, 1, 1, 10, 15, 30, 250000000, time.Local)
+	if connect.Syscall != "connect" || !connect.Timestamp.Equal(want) {
+		t.Errorf("got %s at %s, want connect at %s", connect.Syscall, connect.Timestamp, want)
+	}
+	if len(connect.Arguments) != 3 || connect.Arguments[2] != "110" {
+		t.Errorf("connect arguments = %q", connect.Arguments)
+	}
+}
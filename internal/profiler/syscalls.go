@@ -0,0 +1,87 @@
+package profiler
+
+import "syscall"
+
+// syscallSpec describes the arguments of a file-related system call.
+type syscallSpec struct {
+	pathArguments  []int // Positions of the path arguments
+	dirfdArguments []int // Positions of the directory fd each path is relative to (-1: working directory)
+	flagArgument   int   // Position of the flags (or mode) argument, -1 if none
+}
+
+// syscallSpecs maps file-related system calls to the layout of their arguments.
+var syscallSpecs = map[string]syscallSpec{
+	"open": {[]int{0}, []int{-1}, 1}, "creat": {[]int{0}, []int{-1}, -1}, "stat": {[]int{0}, []int{-1}, -1},
+	"lstat": {[]int{0}, []int{-1}, -1}, "access": {[]int{0}, []int{-1}, 1}, "execve": {[]int{0}, []int{-1}, -1},
+	"truncate": {[]int{0}, []int{-1}, -1}, "chdir": {[]int{0}, []int{-1}, -1},
+	"rename": {[]int{0, 1}, []int{-1, -1}, -1}, "mkdir": {[]int{0}, []int{-1}, -1}, "rmdir": {[]int{0}, []int{-1}, -1},
+	"link": {[]int{0, 1}, []int{-1, -1}, -1}, "unlink": {[]int{0}, []int{-1}, -1},
+	"symlink": {[]int{0, 1}, []int{-1, -1}, -1}, "readlink": {[]int{0}, []int{-1}, -1},
+	"chmod": {[]int{0}, []int{-1}, -1}, "chown": {[]int{0}, []int{-1}, -1}, "lchown": {[]int{0}, []int{-1}, -1},
+	"utime": {[]int{0}, []int{-1}, -1}, "utimes": {[]int{0}, []int{-1}, -1}, "mknod": {[]int{0}, []int{-1}, -1},
+	"statfs": {[]int{0}, []int{-1}, -1}, "chroot": {[]int{0}, []int{-1}, -1}, "mount": {[]int{1}, []int{-1}, -1},
+	"umount2": {[]int{0}, []int{-1}, 1}, "setxattr": {[]int{0}, []int{-1}, -1}, "lsetxattr": {[]int{0}, []int{-1}, -1},
+	"getxattr": {[]int{0}, []int{-1}, -1}, "lgetxattr": {[]int{0}, []int{-1}, -1},
+	"listxattr": {[]int{0}, []int{-1}, -1}, "llistxattr": {[]int{0}, []int{-1}, -1},
+	"removexattr": {[]int{0}, []int{-1}, -1}, "lremovexattr": {[]int{0}, []int{-1}, -1},
+	"inotify_add_watch": {[]int{1}, []int{-1}, 2},
+	"openat":            {[]int{1}, []int{0}, 2}, "openat2": {[]int{1}, []int{0}, 2}, "mkdirat": {[]int{1}, []int{0}, -1},
+	"mknodat": {[]int{1}, []int{0}, -1}, "fchownat": {[]int{1}, []int{0}, 4}, "futimesat": {[]int{1}, []int{0}, -1},
+	"newfstatat": {[]int{1}, []int{0}, 3}, "unlinkat": {[]int{1}, []int{0}, 2},
+	"renameat": {[]int{1, 3}, []int{0, 2}, -1}, "renameat2": {[]int{1, 3}, []int{0, 2}, 4},
+	"linkat": {[]int{1, 3}, []int{0, 2}, 4}, "symlinkat": {[]int{0, 2}, []int{-1, 1}, -1},
+	"readlinkat": {[]int{1}, []int{0}, -1}, "fchmodat": {[]int{1}, []int{0}, -1}, "fchmodat2": {[]int{1}, []int{0}, 3},
+	"faccessat": {[]int{1}, []int{0}, 2}, "faccessat2": {[]int{1}, []int{0}, 2}, "utimensat": {[]int{1}, []int{0}, 3},
+	"name_to_handle_at": {[]int{1}, []int{0}, 4}, "execveat": {[]int{1}, []int{0}, 4}, "statx": {[]int{1}, []int{0}, 2},
+	"fchdir": {nil, nil, -1}, "clone": {nil, nil, 1}, "clone3": {nil, nil, 0}, "fork": {nil, nil, -1},
+	"vfork": {nil, nil, -1},
+}
+
+// fdArguments maps calls that operate on a plain file descriptor to the position of that descriptor.
+var fdArguments = map[string]int{
+	"fchdir": 0,
+}
+
+// errnoNames maps common error numbers to their symbolic names, as printed by strace.
+var errnoNames = map[uint64]string{
+	1: "EPERM", 2: "ENOENT", 3: "ESRCH", 4: "EINTR", 5: "EIO", 6: "ENXIO", 9: "EBADF", 11: "EAGAIN",
+	12: "ENOMEM", 13: "EACCES", 14: "EFAULT", 16: "EBUSY", 17: "EEXIST", 18: "EXDEV", 19: "ENODEV",
+	20: "ENOTDIR", 21: "EISDIR", 22: "EINVAL", 24: "EMFILE", 25: "ENOTTY", 26: "ETXTBSY", 28: "ENOSPC",
+	30: "EROFS", 36: "ENAMETOOLONG", 38: "ENOSYS", 39: "ENOTEMPTY", 40: "ELOOP", 61: "ENODATA",
+	95: "EOPNOTSUPP",
+}
+
+// openFlagNames lists the open(2) flags decoded by the native tracer, in strace's print order.
+var openFlagNames = []struct {
+	value int
+	name  string
+}{
+	{syscall.O_CREAT, "O_CREAT"}, {syscall.O_EXCL, "O_EXCL"}, {syscall.O_NOCTTY, "O_NOCTTY"},
+	{syscall.O_TRUNC, "O_TRUNC"}, {syscall.O_APPEND, "O_APPEND"}, {syscall.O_NONBLOCK, "O_NONBLOCK"},
+	{syscall.O_DIRECTORY, "O_DIRECTORY"}, {syscall.O_NOFOLLOW, "O_NOFOLLOW"},
+	{syscall.O_CLOEXEC, "O_CLOEXEC"},
+}
+
+// isOpenCall checks if a system call takes open(2) flags
+func isOpenCall(name string) bool {
+	return name == "open" || name == "openat" || name == "openat2"
+}
+
+// decodeOpenFlags converts an open(2) flags value into its symbolic names
+func decodeOpenFlags(value uint64) []string {
+	var flags []string
+	switch int(value) & syscall.O_ACCMODE {
+	case syscall.O_WRONLY:
+		flags = append(flags, "O_WRONLY")
+	case syscall.O_RDWR:
+		flags = append(flags, "O_RDWR")
+	default:
+		flags = append(flags, "O_RDONLY")
+	}
+	for _, flag := range openFlagNames {
+		if int(value)&flag.value == flag.value {
+			flags = append(flags, flag.name)
+		}
+	}
+	return flags
+}
@@ -0,0 +1,369 @@
+package profiler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// unitSearchDirectories are the directories system units are loaded from, highest precedence first
+var unitSearchDirectories = []string{
+	"/etc/systemd/system",
+	"/run/systemd/system",
+	"/usr/local/lib/systemd/system",
+	"/usr/lib/systemd/system",
+	"/lib/systemd/system",
+}
+
+// SystemdUnit holds the service settings of the systemd unit that owns a process.
+type SystemdUnit struct {
+	Name             string   `yaml:"name"`                       // Unit name, e.g. "nginx.service"
+	UnitFile         string   `yaml:"unitfile"`                   // Path of the unit file
+	DropIns          []string `yaml:"dropins,omitempty"`          // Drop-in files applied on top of the unit file
+	ExecStart        []string `yaml:"execstart"`                  // Main command lines
+	ExecStartPre     []string `yaml:"execstartpre,omitempty"`     // Command lines run before the main command
+	User             string   `yaml:"user,omitempty"`             // User the service runs as
+	Group            string   `yaml:"group,omitempty"`            // Group the service runs as
+	Environment      []string `yaml:"environment,omitempty"`      // Variables set with Environment=, as KEY=value
+	EnvironmentFiles []string `yaml:"environmentfiles,omitempty"` // Files read with EnvironmentFile= ("-" prefix: optional)
+	WorkingDirectory string   `yaml:"workingdirectory,omitempty"` // Working directory of the service
+	KillSignal       string   `yaml:"killsignal,omitempty"`       // Signal that stops the service
+	LimitNOFILE      string   `yaml:"limitnofile,omitempty"`      // Open file limit
+	LimitNPROC       string   `yaml:"limitnproc,omitempty"`       // Process limit of the user
+	Restart          string   `yaml:"restart,omitempty"`          // Restart policy, e.g. "on-failure"
+	RestartSec       string   `yaml:"restartsec,omitempty"`       // Delay before a restart
+	TimeoutStopSec   string   `yaml:"timeoutstopsec,omitempty"`   // Time to wait for the service to stop
+	MemoryMax        string   `yaml:"memorymax,omitempty"`        // Memory limit, from MemoryMax= or MemoryLimit=
+	CPUQuota         string   `yaml:"cpuquota,omitempty"`         // CPU time limit, e.g. "150%"
+	TasksMax         string   `yaml:"tasksmax,omitempty"`         // Limit of tasks (processes and threads)
+	Hardening        []string `yaml:"hardening,omitempty"`        // Sandboxing settings that can block tracing, as Key=value
+}
+
+// tracingHardeningSettings are the sandboxing settings that can keep strace from running inside a unit
+var tracingHardeningSettings = []string{"SystemCallFilter", "ProtectHome", "InaccessiblePaths", "NoExecPaths", "ExecPaths"}
+
+// GetSystemdUnit detects the service unit owning the process and parses its unit file.
+// Unit files are loaded below rootDirectory ("/" on a live system). It returns nil
+// if the process does not belong to a service or its unit file cannot be loaded.
+func GetSystemdUnit(processID int, rootDirectory string) *SystemdUnit {
+	unitName := GetSystemdUnitName(processID)
+	if unitName == "" {
+		log.Info("Process is not managed by a systemd service.")
+		return nil
+	}
+
+	unit, err := LoadSystemdUnit(unitName, rootDirectory)
+	if err != nil {
+		log.Warn("Failed to load systemd unit, restarting the process directly", "unit", unitName, "error", err)
+		return nil
+	}
+	log.Info(fmt.Sprintf("Process is managed by systemd unit %s (%s).", unit.Name, unit.UnitFile))
+	return unit
+}
+
+// GetSystemdUnitName returns the service unit in the cgroup path of the process, e.g. "nginx.service"
+func GetSystemdUnitName(processID int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", processID))
+	if err != nil {
+		log.Error("Failed to read process cgroup", "error", err)
+		return ""
+	}
+
+	// Lines look like "0::/system.slice/nginx.service" (v2) or "1:name=systemd:/system.slice/nginx.service" (v1)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		// The innermost service wins, e.g. for "/system.slice/foo.service/payload"
+		components := strings.Split(fields[2], "/")
+		for i := len(components) - 1; i >= 0; i-- {
+			if strings.HasSuffix(components[i], ".service") {
+				return components[i]
+			}
+		}
+	}
+	return ""
+}
+
+// LoadSystemdUnit finds and parses a service unit with its drop-ins below rootDirectory.
+// Template instances (e.g. "getty@tty1.service") fall back to the template unit file.
+func LoadSystemdUnit(unitName, rootDirectory string) (*SystemdUnit, error) {
+	unitNames := []string{unitName}
+	if templateName := unitTemplateName(unitName); templateName != "" {
+		unitNames = append(unitNames, templateName)
+	}
+
+	// Find the unit file in the first search directory that has it
+	unit := &SystemdUnit{Name: unitName}
+	for _, directory := range unitSearchDirectories {
+		for _, name := range unitNames {
+			candidate := filepath.Join(rootDirectory, directory, name)
+			if fileInfo, err := os.Stat(candidate); err == nil && !fileInfo.IsDir() {
+				unit.UnitFile = candidate
+				break
+			}
+		}
+		if unit.UnitFile != "" {
+			break
+		}
+	}
+	if unit.UnitFile == "" {
+		return nil, fmt.Errorf("unit file not found in %v", unitSearchDirectories)
+	}
+
+	// Apply the unit file, then the drop-ins in the order systemd applies them
+	unit.DropIns = findUnitDropIns(unitNames, rootDirectory)
+	for _, unitFile := range append([]string{unit.UnitFile}, unit.DropIns...) {
+		if err := parseUnitFile(unitFile, unit); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", unitFile, err)
+		}
+	}
+
+	if len(unit.ExecStart) == 0 {
+		return nil, fmt.Errorf("unit %s has no ExecStart", unitName)
+	}
+	return unit, nil
+}
+
+// unitTemplateName returns the template of a unit instance, e.g. "getty@.service" for "getty@tty1.service"
+func unitTemplateName(unitName string) string {
+	prefix, rest, found := strings.Cut(unitName, "@")
+	if !found {
+		return ""
+	}
+	_, suffix, _ := strings.Cut(rest, ".")
+	return prefix + "@." + suffix
+}
+
+// findUnitDropIns lists the *.conf drop-ins of the unit, sorted by file name.
+// A drop-in in a higher-precedence directory hides one with the same name in a lower one.
+func findUnitDropIns(unitNames []string, rootDirectory string) []string {
+	dropInsByName := make(map[string]string)
+	for _, directory := range unitSearchDirectories {
+		for _, name := range unitNames {
+			matches, _ := filepath.Glob(filepath.Join(rootDirectory, directory, name+".d", "*.conf"))
+			for _, match := range matches {
+				if _, found := dropInsByName[filepath.Base(match)]; !found {
+					dropInsByName[filepath.Base(match)] = match
+				}
+			}
+		}
+	}
+
+	fileNames := make([]string, 0, len(dropInsByName))
+	for fileName := range dropInsByName {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	var dropIns []string
+	for _, fileName := range fileNames {
+		dropIns = append(dropIns, dropInsByName[fileName])
+	}
+	return dropIns
+}
+
+// parseUnitFile applies the [Service] settings of a unit file or drop-in to the unit
+func parseUnitFile(unitFile string, unit *SystemdUnit) error {
+	file, err := os.Open(unitFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var section, pendingLine string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Join continuation lines ending with a backslash
+		if strings.HasSuffix(line, "\\") {
+			pendingLine += strings.TrimSpace(strings.TrimSuffix(line, "\\")) + " "
+			continue
+		}
+		line, pendingLine = pendingLine+line, ""
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = line
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found || section != "[Service]" {
+			continue
+		}
+		applyServiceSetting(unit, strings.TrimSpace(key), expandUnitSpecifiers(strings.TrimSpace(value), unit.Name))
+	}
+	return scanner.Err()
+}
+
+// applyServiceSetting stores a [Service] setting. Like systemd, an empty value resets a list setting.
+func applyServiceSetting(unit *SystemdUnit, key, value string) {
+	switch key {
+	case "ExecStart":
+		unit.ExecStart = appendOrReset(unit.ExecStart, value)
+	case "ExecStartPre":
+		unit.ExecStartPre = appendOrReset(unit.ExecStartPre, value)
+	case "EnvironmentFile":
+		unit.EnvironmentFiles = appendOrReset(unit.EnvironmentFiles, value)
+	case "Environment":
+		if value == "" {
+			unit.Environment = nil
+		}
+		// Several assignments may share a line: Environment="A=1" "B=two words"
+		for _, assignment := range SplitUnitWords(value) {
+			if strings.Contains(assignment, "=") {
+				unit.Environment = append(unit.Environment, assignment)
+			}
+		}
+	case "User":
+		unit.User = value
+	case "Group":
+		unit.Group = value
+	case "WorkingDirectory":
+		unit.WorkingDirectory = value
+	case "KillSignal":
+		unit.KillSignal = value
+	case "LimitNOFILE":
+		unit.LimitNOFILE = value
+	case "LimitNPROC":
+		unit.LimitNPROC = value
+	case "Restart":
+		unit.Restart = value
+	case "RestartSec":
+		unit.RestartSec = value
+	case "TimeoutStopSec", "TimeoutSec":
+		unit.TimeoutStopSec = value
+	case "MemoryMax":
+		unit.MemoryMax = value
+	case "MemoryLimit":
+		// The deprecated setting only applies without MemoryMax=
+		if unit.MemoryMax == "" {
+			unit.MemoryMax = value
+		}
+	case "CPUQuota":
+		unit.CPUQuota = value
+	case "TasksMax":
+		unit.TasksMax = value
+	default:
+		// Keep the assignments in order: list settings accumulate and empty values reset them
+		if slices.Contains(tracingHardeningSettings, key) {
+			unit.Hardening = append(unit.Hardening, key+"="+value)
+		}
+	}
+}
+
+// appendOrReset appends a value to a list setting, or clears the list for an empty value
+func appendOrReset(values []string, value string) []string {
+	if value == "" {
+		return nil
+	}
+	return append(values, value)
+}
+
+// expandUnitSpecifiers replaces the unit name specifiers (%n, %N, %p, %i, %I) and "%%" in a setting
+func expandUnitSpecifiers(value, unitName string) string {
+	nameWithoutSuffix := strings.TrimSuffix(unitName, filepath.Ext(unitName))
+	prefix, instance, _ := strings.Cut(nameWithoutSuffix, "@")
+
+	var expanded strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' || i+1 == len(value) {
+			expanded.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			expanded.WriteString(unitName)
+		case 'N':
+			expanded.WriteString(nameWithoutSuffix)
+		case 'p':
+			expanded.WriteString(prefix)
+		case 'i', 'I':
+			expanded.WriteString(instance)
+		case '%':
+			expanded.WriteByte('%')
+		default:
+			// Leave other specifiers as they are
+			expanded.WriteByte('%')
+			expanded.WriteByte(value[i])
+		}
+	}
+	return expanded.String()
+}
+
+// SplitUnitWords splits a unit file value into words, honoring single and double quotes
+// and backslash escapes
+func SplitUnitWords(value string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote byte
+
+	for i := 0; i < len(value); i++ {
+		character := value[i]
+		switch {
+		case character == '\\' && i+1 < len(value):
+			i++
+			word.WriteByte(value[i])
+			inWord = true
+		case quote != 0:
+			if character == quote {
+				quote = 0
+			} else {
+				word.WriteByte(character)
+			}
+		case character == '"' || character == '\'':
+			quote = character
+			inWord = true
+		case character == ' ' || character == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(character)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// ParseExecCommand splits an Exec*= command line into its special prefixes (e.g. "-" to ignore
+// failures) and its arguments. With the "@" prefix the second word is argv[0]; it is dropped.
+func ParseExecCommand(commandLine string) (string, []string) {
+	trimmed := strings.TrimLeft(commandLine, "-@:+!")
+	prefixes := commandLine[:len(commandLine)-len(trimmed)]
+
+	arguments := SplitUnitWords(trimmed)
+	if strings.Contains(prefixes, "@") && len(arguments) > 1 {
+		arguments = append(arguments[:1], arguments[2:]...)
+		prefixes = strings.ReplaceAll(prefixes, "@", "")
+	}
+	return prefixes, arguments
+}
+
+// QuoteUnitWord quotes a word for use in a unit file command line or assignment
+func QuoteUnitWord(word string) string {
+	word = strings.ReplaceAll(word, "%", "%%")
+	if word != "" && !strings.ContainsAny(word, " \t\"'\\") {
+		return word
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(word) + `"`
+}
@@ -0,0 +1,184 @@
+package profiler
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// systemdFixtureRoot holds unit files and drop-ins laid out like a live system
+const systemdFixtureRoot = "testdata/systemd"
+
+func TestLoadSystemdUnit(t *testing.T) {
+	fixture := func(path string) string { return filepath.Join(systemdFixtureRoot, path) }
+
+	tests := []struct {
+		name     string
+		unitName string
+		want     *SystemdUnit
+	}{
+		{
+			name:     "unit file with drop-ins from several directories",
+			unitName: "nginx.service",
+			want: &SystemdUnit{
+				Name:     "nginx.service",
+				UnitFile: fixture("lib/systemd/system/nginx.service"),
+				DropIns: []string{
+					fixture("lib/systemd/system/nginx.service.d/20-user.conf"),
+					fixture("etc/systemd/system/nginx.service.d/override.conf"),
+				},
+				ExecStart:        []string{`/usr/sbin/nginx -c /etc/nginx/nginx.conf -g "daemon off; error_log /var/log/nginx/nginx.service.log;"`},
+				ExecStartPre:     []string{`/usr/sbin/nginx -t -q -g 'daemon on; master_process on;'`},
+				User:             "www-data",
+				Group:            "www-data",
+				Environment:      []string{"NGINX_WORKERS=4", "GREETING=hello world", "TZ=UTC"},
+				EnvironmentFiles: []string{"-/etc/default/nginx", "/etc/nginx/nginx.env"},
+				LimitNOFILE:      "65536",
+				TimeoutStopSec:   "5",
+				MemoryMax:        "1G",
+				Hardening:        []string{"ProtectHome=yes", "SystemCallFilter=@system-service"},
+			},
+		},
+		{
+			name:     "template instance with exec prefixes and specifiers",
+			unitName: "app@web.service",
+			want: &SystemdUnit{
+				Name:     "app@web.service",
+				UnitFile: fixture("lib/systemd/system/app@.service"),
+				DropIns:  []string{fixture("lib/systemd/system/app@.service.d/10-environment.conf")},
+				ExecStart: []string{
+					`@/opt/app/bin/server app-server --name "web" --motd "say \"hi\"" --rate 100%`,
+				},
+				ExecStartPre: []string{
+					"-/usr/bin/install -d -o app /run/app",
+					"+/usr/local/bin/prepare --instance web",
+					`!!/usr/bin/touch "/run/app/web ready"`,
+				},
+				User:             "app",
+				Environment:      []string{"APP_MODE=production"},
+				EnvironmentFiles: []string{"-/etc/app/web.env"},
+				WorkingDirectory: "-/srv/web",
+				KillSignal:       "SIGINT",
+				Restart:          "on-failure",
+				RestartSec:       "2s",
+				TimeoutStopSec:   "30",
+				CPUQuota:         "150%",
+				TasksMax:         "512",
+			},
+		},
+		{
+			name:     "reset list settings and sandboxing",
+			unitName: "redis.service",
+			want: &SystemdUnit{
+				Name:        "redis.service",
+				UnitFile:    fixture("usr/lib/systemd/system/redis.service"),
+				DropIns:     []string{fixture("etc/systemd/system/redis.service.d/limits.conf")},
+				ExecStart:   []string{"/usr/bin/redis-server /etc/redis/redis.conf --supervised systemd --daemonize no"},
+				User:        "redis",
+				Group:       "redis",
+				LimitNOFILE: "65535",
+				TasksMax:    "infinity",
+				Hardening: []string{
+					"NoExecPaths=/",
+					"ExecPaths=/usr/bin/redis-server /usr/lib /lib",
+					"InaccessiblePaths=-/root",
+					"SystemCallFilter=~@privileged",
+					"SystemCallFilter=~@debug",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unit, err := LoadSystemdUnit(test.unitName, systemdFixtureRoot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(unit, test.want) {
+				t.Errorf("LoadSystemdUnit() =\n%+v\nwant\n%+v", unit, test.want)
+			}
+		})
+	}
+
+	for _, unitName := range []string{"missing.service", "oneshot.service"} {
+		if _, err := LoadSystemdUnit(unitName, systemdFixtureRoot); err == nil {
+			t.Errorf("LoadSystemdUnit(%q) succeeded, want an error", unitName)
+		}
+	}
+}
+
+func TestLoadSystemdUnitTracingBlockers(t *testing.T) {
+	unit, err := LoadSystemdUnit("redis.service", systemdFixtureRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tracingBlockers(unit, "/usr/bin/strace", "/run/vm2container/redis.service")
+	want := []string{
+		"SystemCallFilter= does not allow ptrace (@debug)",
+		"NoExecPaths=/ prevents running /usr/bin/strace",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("tracingBlockers() = %q, want %q", got, want)
+	}
+}
+
+func TestParseExecCommand(t *testing.T) {
+	tests := []struct {
+		commandLine   string
+		wantPrefixes  string
+		wantArguments []string
+	}{
+		{`/usr/sbin/nginx -g 'daemon on; master_process on;'`, "", []string{"/usr/sbin/nginx", "-g", "daemon on; master_process on;"}},
+		{"-/usr/bin/install -d -o app /run/app", "-", []string{"/usr/bin/install", "-d", "-o", "app", "/run/app"}},
+		{"+/usr/local/bin/prepare --instance web", "+", []string{"/usr/local/bin/prepare", "--instance", "web"}},
+		{`!!/usr/bin/touch "/run/app/web ready"`, "!!", []string{"/usr/bin/touch", "/run/app/web ready"}},
+		{`-@/opt/app/bin/server app-server --motd "say \"hi\""`, "-", []string{"/opt/app/bin/server", "--motd", `say "hi"`}},
+		{`:/bin/sh -c "echo \$HOME 'single' \\"`, ":", []string{"/bin/sh", "-c", `echo $HOME 'single' \`}},
+		{"/usr/bin/env  A=1\tB=2 ", "", []string{"/usr/bin/env", "A=1", "B=2"}},
+		{`/bin/echo "" ''`, "", []string{"/bin/echo", "", ""}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.commandLine, func(t *testing.T) {
+			prefixes, arguments := ParseExecCommand(test.commandLine)
+			if prefixes != test.wantPrefixes || !slices.Equal(arguments, test.wantArguments) {
+				t.Errorf("ParseExecCommand() = %q, %q, want %q, %q", prefixes, arguments, test.wantPrefixes, test.wantArguments)
+			}
+		})
+	}
+}
+
+func TestQuoteUnitWord(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"/usr/sbin/nginx", "/usr/sbin/nginx"},
+		{"NAME=value", "NAME=value"},
+		{"two words", `"two words"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"it's", `"it's"`},
+		{`C:\path`, `"C:\\path"`},
+		{"tab\there", "\"tab\there\""},
+		{"100%", "100%%"},
+		{"50% off", `"50%% off"`},
+		{"", `""`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.word, func(t *testing.T) {
+			quoted := QuoteUnitWord(test.word)
+			if quoted != test.want {
+				t.Errorf("QuoteUnitWord(%q) = %s, want %s", test.word, quoted, test.want)
+			}
+
+			// The quoted word reads back as the original word, as in a parsed unit file
+			words := SplitUnitWords(expandUnitSpecifiers(quoted, "app.service"))
+			if !slices.Equal(words, []string{test.word}) {
+				t.Errorf("QuoteUnitWord(%q) reads back as %q", test.word, words)
+			}
+		})
+	}
+}
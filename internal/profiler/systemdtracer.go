@@ -0,0 +1,326 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// traceDropInDirectory holds runtime drop-ins, which take precedence over /usr and /lib units and vanish on reboot
+const traceDropInDirectory = "/run/systemd/system"
+
+// traceDropInName sorts after the unit's own drop-ins, so its ExecStart override wins
+const traceDropInName = "zz-vm2container-trace.conf"
+
+// traceLogDirectory holds the strace logs of traced units. The profile directory may not be
+// reachable from inside the unit (e.g. below a home directory hidden by ProtectHome=).
+const traceLogDirectory = "/run/vm2container"
+
+// systemdTracer restarts a systemd service with its main command wrapped in strace.
+// strace runs inside the unit as a detached grandchild of the application (-D), so the
+// application stays the unit's main process and the unit manager supervises the restart.
+// -I1 (see straceArguments) lets strace detach on SIGINT, which it ignores by default with -D.
+// The raw log is followed like the log of the plain strace tracer, and moved to the profile on Stop.
+type systemdTracer struct {
+	*straceTracer
+	unit           *SystemdUnit
+	profileLogPath string
+	restarting     func() // Called right before the unit is restarted, if set
+}
+
+// newSystemdTracer creates a tracer restarting the given unit. strace logs to a directory
+// of the unit below traceLogDirectory; the raw log ends up at logfilePath.
+func newSystemdTracer(unit *SystemdUnit, logfilePath string) *systemdTracer {
+	unitLogPath := filepath.Join(traceLogDirectory, unit.Name, filepath.Base(logfilePath))
+	return &systemdTracer{straceTracer: newStraceTracer(unitLogPath), unit: unit, profileLogPath: logfilePath}
+}
+
+// Start restarts the unit with a temporary drop-in that runs ExecStart under strace.
+// The drop-in is removed as soon as the unit has started, so later restarts are untraced.
+// Units whose hardening settings would keep strace from running are not restarted.
+func (tracer *systemdTracer) Start(info *ProcessInfo) error {
+	stracePath, err := exec.LookPath("strace")
+	if err != nil {
+		return fmt.Errorf("systemd units are traced with strace: %w", err)
+	}
+	logDirectory := filepath.Dir(tracer.logfilePath)
+	if blockers := tracingBlockers(tracer.unit, stracePath, logDirectory); len(blockers) > 0 {
+		return fmt.Errorf("the unit's hardening blocks tracing: %s", strings.Join(blockers, "; "))
+	}
+
+	// strace runs as the service user, so the log directory must be writable by it
+	logFile, err := createUnitTraceLog(tracer.logfilePath, info.ProcessUser)
+	if err != nil {
+		return err
+	}
+
+	// Install the drop-in
+	if err := writeTraceDropIn(tracer.unit, stracePath, tracer.logfilePath); err != nil {
+		logFile.Close()
+		return fmt.Errorf("failed to write drop-in: %w", err)
+	}
+	defer removeTraceDropIn(tracer.unit)
+	if err := runSystemctl("daemon-reload"); err != nil {
+		logFile.Close()
+		return err
+	}
+
+	// Restart the unit through the unit manager; it stops the old process with the unit's KillSignal
+	go tracer.followLog(logFile)
+	log.Info(fmt.Sprintf("Restarting systemd unit %s under strace...", tracer.unit.Name))
+	if tracer.restarting != nil {
+		tracer.restarting()
+	}
+	if err := runSystemctl("restart", tracer.unit.Name); err != nil {
+		close(tracer.stopFollowing)
+		<-tracer.followDone
+		return errors.Join(err, moveUnitTraceLog(tracer.logfilePath, tracer.profileLogPath))
+	}
+	return nil
+}
+
+// Stop interrupts the strace processes running inside the unit, which detach and leave
+// the application running, waits until the remaining log lines have been parsed and moves
+// the log to the profile. strace that does not detach in time is killed and reported as an error.
+func (tracer *systemdTracer) Stop() error {
+	var err error
+	if straceIDs := findStraceProcesses(tracer.logfilePath); len(straceIDs) > 0 {
+		err = interruptStrace(straceIDs)
+	} else {
+		err = errors.New("strace is not running in the unit")
+	}
+	close(tracer.stopFollowing)
+	<-tracer.followDone
+
+	return errors.Join(err, moveUnitTraceLog(tracer.logfilePath, tracer.profileLogPath))
+}
+
+// createUnitTraceLog creates the strace log and its directory, owned by the service user
+func createUnitTraceLog(logfilePath, username string) (*os.File, error) {
+	uid, gid := getUIDGID(username)
+	logDirectory := filepath.Dir(logfilePath)
+	if err := os.MkdirAll(logDirectory, 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.Chown(logDirectory, uid, gid); err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.Create(logfilePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chown(logfilePath, uid, gid); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	return logFile, nil
+}
+
+// moveUnitTraceLog copies the strace log of a unit to the profile and removes its directory
+func moveUnitTraceLog(logfilePath, profileLogPath string) error {
+	data, err := os.ReadFile(logfilePath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(profileLogPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Dir(logfilePath))
+}
+
+// writeTraceDropIn writes the drop-in that replaces the unit's ExecStart lines with traced ones
+func writeTraceDropIn(unit *SystemdUnit, stracePath, logfilePath string) error {
+	dropInPath := traceDropInPath(unit)
+	if err := os.MkdirAll(filepath.Dir(dropInPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dropInPath, []byte(traceDropIn(unit, stracePath, logfilePath)), 0o644)
+}
+
+// traceDropIn renders the tracing drop-in. It also makes the log directory writable
+// for units that mount the file system read-only (e.g. ProtectSystem=strict).
+func traceDropIn(unit *SystemdUnit, stracePath, logfilePath string) string {
+	var dropIn strings.Builder
+	dropIn.WriteString("# Temporary override installed by vm2container while profiling\n")
+	dropIn.WriteString("[Service]\n")
+	dropIn.WriteString(fmt.Sprintf("ReadWritePaths=%s\n", QuoteUnitWord(filepath.Dir(logfilePath))))
+	dropIn.WriteString("ExecStart=\n")
+	for _, commandLine := range unit.ExecStart {
+		// Special prefixes (e.g. "-") keep their meaning on the strace command
+		prefixes, arguments := ParseExecCommand(commandLine)
+		words := append([]string{stracePath, "-D"}, straceArguments(logfilePath)...)
+		words = append(words, arguments...)
+		for i, word := range words {
+			words[i] = QuoteUnitWord(word)
+		}
+		dropIn.WriteString(fmt.Sprintf("ExecStart=%s%s\n", prefixes, strings.Join(words, " ")))
+	}
+	return dropIn.String()
+}
+
+// tracingBlockers lists the hardening settings of a unit that would keep strace from
+// starting the service or writing its log to logDirectory
+func tracingBlockers(unit *SystemdUnit, stracePath, logDirectory string) []string {
+	ptraceAllowed, filtered := true, false
+	var protectHome string
+	var inaccessiblePaths, noExecPaths, execPaths []string
+	for _, setting := range unit.Hardening {
+		key, value, _ := strings.Cut(setting, "=")
+		switch key {
+		case "SystemCallFilter":
+			if value == "" {
+				ptraceAllowed, filtered = true, false
+				continue
+			}
+			// The first assignment decides between an allow list and a deny list ("~"),
+			// later ones add to or remove from it
+			deny := strings.HasPrefix(value, "~")
+			if !filtered {
+				ptraceAllowed, filtered = deny, true
+			}
+			if namesPtrace(strings.TrimPrefix(value, "~")) {
+				ptraceAllowed = !deny
+			}
+		case "ProtectHome":
+			protectHome = value
+		case "InaccessiblePaths":
+			inaccessiblePaths = appendUnitPaths(inaccessiblePaths, value)
+		case "NoExecPaths":
+			noExecPaths = appendUnitPaths(noExecPaths, value)
+		case "ExecPaths":
+			execPaths = appendUnitPaths(execPaths, value)
+		}
+	}
+
+	var blockers []string
+	if !ptraceAllowed {
+		blockers = append(blockers, "SystemCallFilter= does not allow ptrace (@debug)")
+	}
+	if protectHome == "yes" || protectHome == "true" || protectHome == "tmpfs" {
+		for _, homeDirectory := range []string{"/home", "/root", "/run/user"} {
+			if isWithinDirectory(stracePath, homeDirectory) {
+				blockers = append(blockers, fmt.Sprintf("ProtectHome=%s hides %s", protectHome, stracePath))
+			}
+		}
+	}
+	for _, path := range []string{stracePath, logDirectory} {
+		if directory := containingDirectory(path, inaccessiblePaths); directory != "" {
+			blockers = append(blockers, fmt.Sprintf("InaccessiblePaths=%s hides %s", directory, path))
+		}
+	}
+	if directory := containingDirectory(stracePath, noExecPaths); directory != "" && containingDirectory(stracePath, execPaths) == "" {
+		blockers = append(blockers, fmt.Sprintf("NoExecPaths=%s prevents running %s", directory, stracePath))
+	}
+	return blockers
+}
+
+// namesPtrace checks if a SystemCallFilter= list names ptrace, directly or through its @debug group
+func namesPtrace(value string) bool {
+	for _, name := range strings.Fields(value) {
+		// Entries may carry an error action, e.g. "ptrace:EPERM"
+		name, _, _ = strings.Cut(name, ":")
+		if name == "ptrace" || name == "@debug" {
+			return true
+		}
+	}
+	return false
+}
+
+// appendUnitPaths appends the paths of a path list setting, dropping the "-" and "+" prefixes.
+// Like systemd, an empty value resets the list.
+func appendUnitPaths(paths []string, value string) []string {
+	if value == "" {
+		return nil
+	}
+	for _, path := range SplitUnitWords(value) {
+		paths = append(paths, strings.TrimLeft(path, "-+"))
+	}
+	return paths
+}
+
+// containingDirectory returns the first of the directories that contains the path, if any
+func containingDirectory(path string, directories []string) string {
+	for _, directory := range directories {
+		if isWithinDirectory(path, directory) {
+			return directory
+		}
+	}
+	return ""
+}
+
+// isWithinDirectory checks if a path is the given directory or lies below it
+func isWithinDirectory(path, directory string) bool {
+	directory = strings.TrimSuffix(directory, "/")
+	return directory == "" || path == directory || strings.HasPrefix(path, directory+"/")
+}
+
+// removeTraceDropIn deletes the tracing drop-in and reloads the unit definitions
+func removeTraceDropIn(unit *SystemdUnit) {
+	err := os.Remove(traceDropInPath(unit))
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Error("Failed to remove tracing drop-in", "unit", unit.Name, "error", err)
+		return
+	}
+	if err := runSystemctl("daemon-reload"); err != nil {
+		log.Error("Failed to reload systemd units", "error", err)
+	}
+}
+
+// traceDropInPath returns the path of the tracing drop-in of a unit
+func traceDropInPath(unit *SystemdUnit) string {
+	return filepath.Join(traceDropInDirectory, unit.Name+".d", traceDropInName)
+}
+
+// runSystemctl runs a systemctl command and includes its output in the error
+func runSystemctl(arguments ...string) error {
+	output, err := exec.Command("sudo", append([]string{"systemctl"}, arguments...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", strings.Join(arguments, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// findStraceProcesses returns the strace processes writing to the given log file
+func findStraceProcesses(logfilePath string) []int {
+	procEntries, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return nil
+	}
+
+	var straceIDs []int
+	for _, procEntry := range procEntries {
+		processID, err := strconv.Atoi(filepath.Base(procEntry))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(procEntry, "cmdline"))
+		if err != nil {
+			continue
+		}
+		arguments := strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+		if filepath.Base(arguments[0]) == "strace" && containsArgumentPair(arguments, "-o", logfilePath) {
+			straceIDs = append(straceIDs, processID)
+		}
+	}
+	return straceIDs
+}
+
+// containsArgumentPair checks if a flag is directly followed by the given value
+func containsArgumentPair(arguments []string, flag, value string) bool {
+	for i := 0; i+1 < len(arguments); i++ {
+		if arguments[i] == flag && arguments[i+1] == value {
+			return true
+		}
+	}
+	return false
+}
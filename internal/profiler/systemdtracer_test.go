@@ -0,0 +1,99 @@
+package profiler
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTracingBlockers(t *testing.T) {
+	tests := []struct {
+		name      string
+		hardening []string
+		want      []string
+	}{
+		{
+			name: "no hardening",
+		},
+		{
+			name:      "allow list without ptrace",
+			hardening: []string{"SystemCallFilter=@system-service", "SystemCallFilter=~@privileged"},
+			want:      []string{"SystemCallFilter= does not allow ptrace (@debug)"},
+		},
+		{
+			name:      "allow list with @debug",
+			hardening: []string{"SystemCallFilter=@system-service @debug"},
+		},
+		{
+			name:      "deny list with ptrace",
+			hardening: []string{"SystemCallFilter=~@mount ptrace:EPERM"},
+			want:      []string{"SystemCallFilter= does not allow ptrace (@debug)"},
+		},
+		{
+			name:      "deny list reset by an empty assignment",
+			hardening: []string{"SystemCallFilter=~@debug", "SystemCallFilter="},
+		},
+		{
+			name:      "deny list with ptrace allowed again",
+			hardening: []string{"SystemCallFilter=~@debug @mount", "SystemCallFilter=ptrace"},
+		},
+		{
+			name:      "ProtectHome does not cover strace",
+			hardening: []string{"ProtectHome=yes"},
+		},
+		{
+			name:      "hidden log directory and strace",
+			hardening: []string{"InaccessiblePaths=-/run/vm2container", "InaccessiblePaths=/usr/bin"},
+			want: []string{
+				"InaccessiblePaths=/usr/bin hides /usr/bin/strace",
+				"InaccessiblePaths=/run/vm2container hides /run/vm2container/nginx.service",
+			},
+		},
+		{
+			name:      "no exec paths",
+			hardening: []string{"NoExecPaths=/", "ExecPaths=/usr/sbin /usr/lib"},
+			want:      []string{"NoExecPaths=/ prevents running /usr/bin/strace"},
+		},
+		{
+			name:      "no exec paths with strace allowed",
+			hardening: []string{"NoExecPaths=/", "ExecPaths=/usr/sbin /usr/bin"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unit := &SystemdUnit{Name: "nginx.service", Hardening: test.hardening}
+			got := tracingBlockers(unit, "/usr/bin/strace", "/run/vm2container/nginx.service")
+			if !slices.Equal(got, test.want) {
+				t.Errorf("tracingBlockers() = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	// strace installed below a home directory is hidden by ProtectHome=
+	unit := &SystemdUnit{Name: "app.service", Hardening: []string{"ProtectHome=tmpfs"}}
+	got := tracingBlockers(unit, "/root/bin/strace", "/run/vm2container/app.service")
+	if want := []string{"ProtectHome=tmpfs hides /root/bin/strace"}; !slices.Equal(got, want) {
+		t.Errorf("tracingBlockers() = %q, want %q", got, want)
+	}
+}
+
+func TestTraceDropIn(t *testing.T) {
+	unit := &SystemdUnit{
+		Name:      "app.service",
+		ExecStart: []string{`-@/opt/app/bin/server app-server --title "My App" --rate 50%`},
+	}
+	got := traceDropIn(unit, "/usr/bin/strace", "/run/vm2container/app.service/strace_raw.log")
+
+	want := strings.Join([]string{
+		"# Temporary override installed by vm2container while profiling",
+		"[Service]",
+		"ReadWritePaths=/run/vm2container/app.service",
+		"ExecStart=",
+		`ExecStart=-/usr/bin/strace -D -I1 -f -ttt -y -e trace=%%file,%%process,fchdir -o /run/vm2container/app.service/strace_raw.log /opt/app/bin/server --title "My App" --rate 50%%`,
+		"",
+	}, "\n")
+	if got != want {
+		t.Errorf("traceDropIn() =\n%s\nwant\n%s", got, want)
+	}
+}
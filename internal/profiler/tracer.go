@@ -0,0 +1,133 @@
+package profiler
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"application_profiling/internal/workload"
+
+	"github.com/charmbracelet/log"
+)
+
+// SyscallEvent represents a file-related system call observed by a tracer.
+type SyscallEvent struct {
+	PID         int       `json:"pid"`             // Process (thread) ID that issued the call
+	Timestamp   time.Time `json:"timestamp"`       // Time the call was issued
+	Syscall     string    `json:"syscall"`         // System call name, e.g. "openat"
+	Arguments   []string  `json:"args"`            // Raw arguments as printed by strace
+	Paths       []string  `json:"paths"`           // Decoded path arguments of the call
+	Flags       []string  `json:"flags,omitempty"` // Symbolic flags, e.g. ["O_RDONLY", "O_CLOEXEC"]
+	ReturnValue int64     `json:"return"`          // Return value of the call
+	Errno       string    `json:"errno,omitempty"` // Error name on failure, e.g. "ENOENT"
+}
+
+// TraceResult holds the data collected during a tracing session.
+type TraceResult struct {
+	Events             []SyscallEvent   // Observed system calls, in trace order
+	StaticPaths        []string         // Paths already mapped or open before tracing (attach mode)
+	WorkingDirectories map[int]string   // Working directories of the traced threads at attach time
+	ResourceSamples    []ResourceSample // Resource usage of the process tree during the trace window
+}
+
+// Tracer captures the file-related system calls of a process tree.
+type Tracer interface {
+	// Start launches the application described by the ProcessInfo under the tracer
+	Start(info *ProcessInfo) error
+	// Attach starts tracing already-running processes (and all of their threads)
+	Attach(processIDs []int) error
+	// Events streams the observed system calls; the channel is closed once tracing stops
+	Events() <-chan SyscallEvent
+	// Stop detaches the tracer, leaving the traced processes running
+	Stop() error
+}
+
+// TraceOptions represents the options for a tracing session
+type TraceOptions struct {
+	Duration       time.Duration     // Duration of the trace window
+	Backend        string            // Tracer backend: "strace", "ptrace" or "auto"
+	Workloads      []workload.Driver // Drivers exercising the application during the trace window
+	StopTimeout    time.Duration     // Time to wait for the original process to exit before SIGKILL
+	ReadyTimeout   time.Duration     // Time to wait for a restarted process to listen again
+	SampleInterval time.Duration     // Time between two resource samples of the process tree, 0 disables sampling
+	Restarting     func()            // Called right before the original process is stopped or its unit restarted
+}
+
+// NewTracer creates a tracer for the given backend that writes its raw log to logfilePath.
+// The "auto" backend prefers strace and falls back to the native ptrace tracer if strace is not installed.
+func NewTracer(backend, logfilePath string) (Tracer, error) {
+	if backend == "auto" || backend == "" {
+		backend = "strace"
+		if _, err := exec.LookPath("strace"); err != nil {
+			log.Warn("strace not found, falling back to the native ptrace tracer")
+			backend = "ptrace"
+		}
+	}
+
+	switch backend {
+	case "strace":
+		return newStraceTracer(logfilePath), nil
+	case "ptrace":
+		return newPtraceTracer(logfilePath)
+	default:
+		return nil, fmt.Errorf("unknown tracer backend: %s", backend)
+	}
+}
+
+// collectTraceEvents drives the trace window and gathers the events emitted by the tracer.
+// If given, waitUntilReady runs before the workload starts, while events are already collected.
+// The resource usage of the given processes and of every traced process is sampled for the whole window.
+func collectTraceEvents(tracer Tracer, info *ProcessInfo, options TraceOptions, processIDs []int, waitUntilReady func()) ([]SyscallEvent, []ResourceSample) {
+	// Sample the resource usage of the process tree in the background
+	var sampler *resourceSampler
+	if options.SampleInterval > 0 {
+		sampler = newResourceSampler(options.SampleInterval, processIDs)
+		sampler.Start()
+	}
+
+	// Drain the event stream in the background
+	var events []SyscallEvent
+	drained := make(chan struct{})
+	go func() {
+		for event := range tracer.Events() {
+			events = append(events, event)
+			if sampler != nil {
+				sampler.AddThread(event.PID)
+			}
+		}
+		close(drained)
+	}()
+
+	// Wait for the process to start
+	if waitUntilReady != nil {
+		waitUntilReady()
+	}
+
+	// Exercise the application for the whole trace window to capture lazily loaded files
+	ctx, cancel := context.WithTimeout(context.Background(), options.Duration)
+	defer cancel()
+	workload.Run(ctx, options.Workloads, workload.Target{
+		PID:         info.PID,
+		TCPPorts:    info.ListeningTCP,
+		UnixSockets: info.UnixSockets,
+	})
+	<-ctx.Done()
+
+	// Stop sampling before the tracer detaches
+	var samples []ResourceSample
+	if sampler != nil {
+		samples = sampler.Stop()
+		info.SampledUsage = SummarizeResourceSamples(samples, options.SampleInterval)
+		log.Info(fmt.Sprintf("Collected %d resource samples.", len(samples)))
+	}
+
+	// Stop the tracer after data collection
+	if err := tracer.Stop(); err != nil {
+		log.Error("Failed to stop tracer", "error", err)
+	}
+	<-drained
+
+	log.Info("Tracing complete.")
+	return events, samples
+}
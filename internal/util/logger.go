@@ -26,9 +26,18 @@ func LogProcessDetails(processInfo *profiler.ProcessInfo) {
 	logger.Debugf("Sockets: %v", processInfo.UnixSockets)
 	logger.Debugf("Listening TCP ports: %v", processInfo.ListeningTCP)
 	logger.Debugf("Listening UDP ports: %v", processInfo.ListeningUDP)
+	logger.Debugf("Connected TCP ports: %v", processInfo.ConnectedTCP)
+	logger.Debugf("Connected Unix sockets: %v", processInfo.ConnectedUnix)
 	logger.Debugf("OS Version: %s", processInfo.OSImage)
+	if processInfo.SystemdUnit != nil {
+		logger.Debugf("Systemd unit: %s", processInfo.SystemdUnit.Name)
+	}
 	logger.Debugf("Memory usage: %.2f MB", processInfo.ResourceUsage.MemoryMB)
 	logger.Debugf("CPU cores used: %.2f", processInfo.ResourceUsage.CPUCores)
 	logger.Debugf("Disk Read: %.2f MB", processInfo.ResourceUsage.DiskReadMB)
 	logger.Debugf("Disk Write: %.2f MB", processInfo.ResourceUsage.DiskWriteMB)
+	if processInfo.SampledUsage != nil {
+		logger.Debugf("Sampled CPU cores (avg/p95/max): %.2f/%.2f/%.2f", processInfo.SampledUsage.CPUCores.Avg, processInfo.SampledUsage.CPUCores.P95, processInfo.SampledUsage.CPUCores.Max)
+		logger.Debugf("Sampled RSS (avg/p95/max): %.2f/%.2f/%.2f MB", processInfo.SampledUsage.RSSMB.Avg, processInfo.SampledUsage.RSSMB.P95, processInfo.SampledUsage.RSSMB.Max)
+	}
 }
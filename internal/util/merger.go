@@ -12,7 +12,11 @@ import (
 )
 
 // MergeFilteredLogs merges the filtered logs of the given PIDs into a single file.
-func MergeFilteredLogs(processIDs []int) {
+// Paths referenced by known configuration files among them (configFiles maps each file
+// to its parser) are added as well, filtered by the same rules as the traced paths,
+// and their origin is saved to config_paths.yaml. executablePaths lists the executables
+// of the profiled processes, which the parsers may query for built-in defaults.
+func MergeFilteredLogs(processIDs []int, executablePaths []string, configFiles map[string]string, rules *profiler.FilterRules) {
 	// Create a map to store unique paths
 	mergedPaths := make(map[string]bool)
 
@@ -43,8 +47,11 @@ func MergeFilteredLogs(processIDs []int) {
 	}
 	sort.Strings(finalLines)
 
-	// Write to a new merged file
+	// Add the paths referenced by configuration files, which the trace may never have touched
 	lastPID := processIDs[len(processIDs)-1]
+	finalLines = addConfigPaths(finalLines, executablePaths, configFiles, rules, lastPID)
+
+	// Write to a new merged file
 	mergedFilePath := profiler.BuildFilePath(fmt.Sprintf("output/%d/profile", lastPID), "strace_merged.log")
 
 	mergedFile, err := os.Create(mergedFilePath)
@@ -60,3 +67,130 @@ func MergeFilteredLogs(processIDs []int) {
 
 	log.Infof("Merged strace logs have been written to: %s", mergedFilePath)
 }
+
+// addConfigPaths adds the existing paths referenced by the configuration files among the traced
+// paths, unless they are already covered, and saves every discovered path with its origin
+func addConfigPaths(tracedPaths, executablePaths []string, configFiles map[string]string, rules *profiler.FilterRules, processID int) []string {
+	configPaths := profiler.DiscoverConfigPaths(tracedPaths, configFiles, executablePaths)
+	if len(configPaths) == 0 {
+		return tracedPaths
+	}
+
+	reportPath := profiler.BuildFilePath(fmt.Sprintf("output/%d/profile", processID), "config_paths.yaml")
+	if err := profiler.SaveConfigPaths(configPaths, reportPath); err != nil {
+		log.Errorf("Failed to save configuration paths: %v", err)
+	}
+
+	return mergeConfigPaths(tracedPaths, configPaths, rules)
+}
+
+// mergeConfigPaths adds the existing configuration paths to the traced paths. Like traced paths,
+// they are dropped if the rules consider them generic or excluded, and collapsed otherwise.
+func mergeConfigPaths(tracedPaths []string, configPaths []profiler.ConfigPath, rules *profiler.FilterRules) []string {
+	paths := tracedPaths
+	for _, configPath := range configPaths {
+		if !configPath.Exists {
+			continue
+		}
+		if match := rules.Match(configPath.Path); match.Verdict == profiler.VerdictGeneric || match.Verdict == profiler.VerdictExcluded {
+			log.Debug("Skipping path from configuration", "path", configPath.Path, "origin", configPath.Origin, "rule", match.Rule)
+			continue
+		}
+		path := rules.CollapseTarget(configPath.Path)
+		if profiler.IsCoveredByPaths(path, paths) {
+			continue
+		}
+		log.Info("Adding path from configuration", "path", path, "origin", configPath.Origin)
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// MergeAccessProfiles merges the access profiles of the given PIDs into a single file.
+func MergeAccessProfiles(processIDs []int) {
+	var accessProfiles []*profiler.AccessProfile
+	for _, pid := range processIDs {
+		profilePath := profiler.BuildFilePath(fmt.Sprintf("output/%d/profile", pid), "access_profile.yaml")
+
+		accessProfile, err := profiler.LoadAccessProfile(profilePath)
+		if err != nil {
+			log.Errorf("Failed to load access profile for PID %d: %v", pid, err)
+			continue
+		}
+		accessProfiles = append(accessProfiles, accessProfile)
+	}
+
+	mergedProfile := mergeAccessProfiles(accessProfiles)
+
+	// Write to a new merged file
+	lastPID := processIDs[len(processIDs)-1]
+	mergedFilePath := profiler.BuildFilePath(fmt.Sprintf("output/%d/profile", lastPID), "access_merged.yaml")
+
+	if err := mergedProfile.SaveAsYAML(mergedFilePath); err != nil {
+		log.Errorf("Failed to write merged access profile: %v", err)
+		return
+	}
+
+	log.Infof("Merged access profiles have been written to: %s", mergedFilePath)
+}
+
+// mergeAccessProfiles combines the access kinds, PIDs and recorded entries of every path.
+// An entry without recorded entries stands for itself, so a collapsed directory that one
+// process only read or ran keeps that access next to the files another process wrote there.
+func mergeAccessProfiles(accessProfiles []*profiler.AccessProfile) *profiler.AccessProfile {
+	// Collect the access kinds and PIDs of every path, and the access of the paths recorded below it
+	accessKinds := make(map[string]map[string]bool)
+	accessPIDs := make(map[string]map[int]bool)
+	recordedKinds := make(map[string]map[string]map[string]bool)
+
+	for _, accessProfile := range accessProfiles {
+		for _, entry := range accessProfile.Paths {
+			if accessKinds[entry.Path] == nil {
+				accessKinds[entry.Path] = make(map[string]bool)
+				accessPIDs[entry.Path] = make(map[int]bool)
+				recordedKinds[entry.Path] = make(map[string]map[string]bool)
+			}
+			for _, recordedEntry := range entry.RecordedEntries() {
+				if recordedKinds[entry.Path][recordedEntry.Path] == nil {
+					recordedKinds[entry.Path][recordedEntry.Path] = make(map[string]bool)
+				}
+				for _, kind := range recordedEntry.Access {
+					recordedKinds[entry.Path][recordedEntry.Path][kind] = true
+				}
+			}
+			for _, kind := range entry.Access {
+				accessKinds[entry.Path][kind] = true
+			}
+			for _, accessPID := range entry.ProcessIDs {
+				accessPIDs[entry.Path][accessPID] = true
+			}
+		}
+	}
+
+	// Build the merged profile, sorted by path
+	paths := make([]string, 0, len(accessKinds))
+	for path := range accessKinds {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	mergedProfile := &profiler.AccessProfile{Paths: make([]profiler.PathAccess, 0, len(paths))}
+	for _, path := range paths {
+		entry := profiler.PathAccess{Path: path, Access: profiler.SortedAccessKinds(accessKinds[path])}
+		for accessPID := range accessPIDs[path] {
+			entry.ProcessIDs = append(entry.ProcessIDs, accessPID)
+		}
+		sort.Ints(entry.ProcessIDs)
+		// Like a single profile, only written entries carry their recorded paths
+		if entry.IsWritten() {
+			for recordedPath, kinds := range recordedKinds[path] {
+				entry.Entries = append(entry.Entries, profiler.PathAccess{Path: recordedPath, Access: profiler.SortedAccessKinds(kinds)})
+			}
+			sort.Slice(entry.Entries, func(i, j int) bool { return entry.Entries[i].Path < entry.Entries[j].Path })
+		}
+		mergedProfile.Paths = append(mergedProfile.Paths, entry)
+	}
+
+	return mergedProfile
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"slices"
+	"testing"
+
+	"application_profiling/internal/dockerizer"
+	"application_profiling/internal/profiler"
+)
+
+func TestMergeConfigPaths(t *testing.T) {
+	rules, err := profiler.LoadFilterRules("", []string{"debian"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracedPaths := []string{"/etc/mysql", "/usr/sbin/mysqld"}
+	configPaths := []profiler.ConfigPath{
+		{Path: "/etc/mysql/conf.d", Directive: "!includedir", Exists: true},
+		{Path: "/run/mysqld", Directive: "socket", Exists: true},
+		{Path: "/tmp/mysql.sock", Directive: "socket", Exists: true},
+		{Path: "/var/lib/mysql", Directive: "datadir", Exists: true},
+		{Path: "/var/log/mysql/error.log", Directive: "log_error", Exists: false},
+	}
+
+	got := mergeConfigPaths(tracedPaths, configPaths, rules)
+	want := []string{"/etc/mysql", "/usr/sbin/mysqld", "/var/lib/mysql"}
+	if !slices.Equal(got, want) {
+		t.Errorf("mergeConfigPaths() = %q, want %q", got, want)
+	}
+}
+
+func TestMergeAccessProfiles(t *testing.T) {
+	// PID 100 runs the binary below /opt/app, PID 200 writes a log file next to it
+	accessProfiles := []*profiler.AccessProfile{
+		{Paths: []profiler.PathAccess{
+			{Path: "/opt/app", Access: []string{profiler.AccessRead, profiler.AccessExec}, ProcessIDs: []int{100}},
+		}},
+		{Paths: []profiler.PathAccess{
+			{Path: "/opt/app", Access: []string{profiler.AccessWrite, profiler.AccessCreate}, ProcessIDs: []int{200}, Entries: []profiler.PathAccess{
+				{Path: "/opt/app/app.log", Access: []string{profiler.AccessWrite, profiler.AccessCreate}},
+			}},
+		}},
+	}
+
+	merged := mergeAccessProfiles(accessProfiles)
+	if len(merged.Paths) != 1 {
+		t.Fatalf("merged %d paths, want 1", len(merged.Paths))
+	}
+	entry := merged.Paths[0]
+	if !slices.Equal(entry.ProcessIDs, []int{100, 200}) {
+		t.Errorf("ProcessIDs = %v, want [100 200]", entry.ProcessIDs)
+	}
+	wantEntries := []profiler.PathAccess{
+		{Path: "/opt/app", Access: []string{profiler.AccessRead, profiler.AccessExec}},
+		{Path: "/opt/app/app.log", Access: []string{profiler.AccessWrite, profiler.AccessCreate}},
+	}
+	if len(entry.Entries) != len(wantEntries) {
+		t.Fatalf("Entries = %+v, want %+v", entry.Entries, wantEntries)
+	}
+	for i, want := range wantEntries {
+		if entry.Entries[i].Path != want.Path || !slices.Equal(entry.Entries[i].Access, want.Access) {
+			t.Errorf("Entries[%d] = %+v, want %+v", i, entry.Entries[i], want)
+		}
+	}
+
+	// The executed binary keeps the directory in the image instead of an empty volume
+	rules, err := profiler.LoadFilterRules("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := dockerizer.DetectStateDirectories(merged, rules)
+	if len(report.Volumes) != 0 {
+		t.Errorf("Volumes = %q, want none", report.Volumes)
+	}
+}
+
+func TestMergeAccessProfilesReadOnly(t *testing.T) {
+	accessProfiles := []*profiler.AccessProfile{
+		{Paths: []profiler.PathAccess{{Path: "/etc/app", Access: []string{profiler.AccessRead}, ProcessIDs: []int{100}}}},
+		{Paths: []profiler.PathAccess{{Path: "/etc/app", Access: []string{profiler.AccessStat}, ProcessIDs: []int{200}}}},
+	}
+
+	merged := mergeAccessProfiles(accessProfiles)
+	if len(merged.Paths) != 1 || len(merged.Paths[0].Entries) != 0 {
+		t.Fatalf("merged = %+v, want a single entry without recorded entries", merged.Paths)
+	}
+	if want := []string{profiler.AccessRead, profiler.AccessStat}; !slices.Equal(merged.Paths[0].Access, want) {
+		t.Errorf("Access = %q, want %q", merged.Paths[0].Access, want)
+	}
+}
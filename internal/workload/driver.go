@@ -0,0 +1,119 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Target describes the endpoints of the application under trace.
+type Target struct {
+	PID         int      // Main application process ID
+	TCPPorts    []int    // Listening TCP ports
+	UnixSockets []string // Unix domain sockets in use
+}
+
+// Driver exercises a running application so that lazily loaded files are accessed while tracing.
+type Driver interface {
+	// Name returns the name used to select the driver
+	Name() string
+	// Exercise runs one round of the workload against the target
+	Exercise(ctx context.Context, target Target) error
+}
+
+// Options configures the workload drivers.
+type Options struct {
+	ScriptPath   string // Script run by the "script" driver
+	RequestsPath string // Request list replayed by the "requests" driver
+}
+
+// roundInterval is the pause between two rounds of a driver
+const roundInterval = time.Second
+
+// NewDrivers creates the drivers selected by a comma-separated list of names.
+// "auto" selects the HTTP and Unix socket drivers, "none" disables the workload.
+func NewDrivers(selection string, options Options) ([]Driver, error) {
+	var drivers []Driver
+	seen := make(map[string]bool)
+
+	for _, name := range strings.Split(selection, ",") {
+		name = strings.TrimSpace(name)
+		names := []string{name}
+		if name == "auto" {
+			names = []string{"http", "unix"}
+		}
+
+		for _, name := range names {
+			if name == "" || name == "none" || seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			driver, err := newDriver(name, options)
+			if err != nil {
+				return nil, err
+			}
+			drivers = append(drivers, driver)
+		}
+	}
+
+	return drivers, nil
+}
+
+// newDriver creates a single driver by name
+func newDriver(name string, options Options) (Driver, error) {
+	switch name {
+	case "http":
+		return newHTTPDriver(), nil
+	case "tcp":
+		return &tcpDriver{}, nil
+	case "unix":
+		return &unixDriver{}, nil
+	case "script":
+		if options.ScriptPath == "" {
+			return nil, fmt.Errorf("the script workload needs a script file")
+		}
+		return &scriptDriver{scriptPath: options.ScriptPath}, nil
+	case "requests":
+		if options.RequestsPath == "" {
+			return nil, fmt.Errorf("the requests workload needs a request list file")
+		}
+		return newRequestsDriver(options.RequestsPath)
+	default:
+		return nil, fmt.Errorf("unknown workload driver: %s", name)
+	}
+}
+
+// Run drives the target with all drivers concurrently, round after round, until the context is done.
+func Run(ctx context.Context, drivers []Driver, target Target) {
+	var waitGroup sync.WaitGroup
+	for _, driver := range drivers {
+		waitGroup.Add(1)
+		go func(driver Driver) {
+			defer waitGroup.Done()
+			runDriver(ctx, driver, target)
+		}(driver)
+	}
+	waitGroup.Wait()
+}
+
+// runDriver repeats the rounds of a single driver until the context is done
+func runDriver(ctx context.Context, driver Driver, target Target) {
+	log.Info("Running workload...", "driver", driver.Name())
+	for rounds := 1; ; rounds++ {
+		if err := driver.Exercise(ctx, target); err != nil && ctx.Err() == nil {
+			log.Debug("Workload round failed", "driver", driver.Name(), "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Debug("Workload finished", "driver", driver.Name(), "rounds", rounds)
+			return
+		case <-time.After(roundInterval):
+		}
+	}
+}
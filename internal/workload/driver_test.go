@@ -0,0 +1,49 @@
+package workload
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewDrivers(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection string
+		options   Options
+		want      []string
+		wantErr   bool
+	}{
+		{name: "auto", selection: "auto", want: []string{"http", "unix"}},
+		{name: "none", selection: "none", want: nil},
+		{name: "empty", selection: "", want: nil},
+		{name: "none next to a driver", selection: "none,tcp", want: []string{"tcp"}},
+		{name: "duplicates", selection: "http, tcp,http", want: []string{"http", "tcp"}},
+		{name: "auto with one of its drivers", selection: "unix,auto", want: []string{"unix", "http"}},
+		{name: "script", selection: "script", options: Options{ScriptPath: "workload.sh"}, want: []string{"script"}},
+		{name: "script without a file", selection: "script", wantErr: true},
+		{name: "requests without a file", selection: "requests", wantErr: true},
+		{name: "unknown name", selection: "http,ftp", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			drivers, err := NewDrivers(test.selection, test.options)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("NewDrivers(%q) succeeded, want an error", test.selection)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewDrivers(%q) = %v", test.selection, err)
+			}
+			var names []string
+			for _, driver := range drivers {
+				names = append(names, driver.Name())
+			}
+			if !slices.Equal(names, test.want) {
+				t.Errorf("NewDrivers(%q) = %q, want %q", test.selection, names, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package workload
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpRequestTimeout bounds a single request, so a stalled application does not block the driver
+const httpRequestTimeout = 5 * time.Second
+
+// httpDriver sends GET requests to every listening TCP port, over HTTPS or plain HTTP.
+type httpDriver struct {
+	client  *http.Client
+	schemes map[int]string // Scheme that answered on each port
+}
+
+// newHTTPDriver creates an HTTP driver that accepts self-signed certificates
+func newHTTPDriver() *httpDriver {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	return &httpDriver{
+		client:  &http.Client{Transport: transport, Timeout: httpRequestTimeout},
+		schemes: make(map[int]string),
+	}
+}
+
+// Name returns the name of the driver
+func (driver *httpDriver) Name() string {
+	return "http"
+}
+
+// Exercise requests the root page of every port, probing HTTPS before HTTP on first contact
+func (driver *httpDriver) Exercise(ctx context.Context, target Target) error {
+	var errs []error
+	for _, port := range target.TCPPorts {
+		schemes := []string{"https", "http"}
+		if scheme, known := driver.schemes[port]; known {
+			schemes = []string{scheme}
+		}
+
+		var err error
+		for _, scheme := range schemes {
+			if err = driver.get(ctx, fmt.Sprintf("%s://localhost:%d/", scheme, port)); err == nil {
+				driver.schemes[port] = scheme
+				break
+			}
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// get sends a GET request and reads the whole response
+func (driver *httpDriver) get(ctx context.Context, url string) error {
+	return sendHTTPRequest(ctx, driver.client, http.MethodGet, url, "")
+}
+
+// sendHTTPRequest sends a request and reads the whole response, so the application serves it completely
+func sendHTTPRequest(ctx context.Context, client *http.Client, method, url, body string) error {
+	var bodyReader io.Reader
+	if body != "" {
+		bodyReader = strings.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	_, err = io.Copy(io.Discard, response.Body)
+	return err
+}
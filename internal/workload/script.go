@@ -0,0 +1,137 @@
+package workload
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// scriptDriver runs a user-supplied script against the application.
+// The script receives the target in the WORKLOAD_PID, WORKLOAD_TCP_PORTS and
+// WORKLOAD_UNIX_SOCKETS environment variables, and is stopped when the trace window ends.
+type scriptDriver struct {
+	scriptPath string
+}
+
+// Name returns the name of the driver
+func (driver *scriptDriver) Name() string {
+	return "script"
+}
+
+// Exercise runs the script once
+func (driver *scriptDriver) Exercise(ctx context.Context, target Target) error {
+	ports := make([]string, 0, len(target.TCPPorts))
+	for _, port := range target.TCPPorts {
+		ports = append(ports, strconv.Itoa(port))
+	}
+
+	// Run the script in its own process group, so the whole group is stopped with the trace window
+	command := exec.CommandContext(ctx, "sh", driver.scriptPath)
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	command.Cancel = func() error {
+		return syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+	}
+	command.WaitDelay = time.Second
+	command.Env = append(os.Environ(),
+		fmt.Sprintf("WORKLOAD_PID=%d", target.PID),
+		"WORKLOAD_TCP_PORTS="+strings.Join(ports, ","),
+		"WORKLOAD_UNIX_SOCKETS="+strings.Join(target.UnixSockets, ","),
+	)
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// request is a single entry of a request list
+type request struct {
+	kind    string // HTTP method, "tcp" or "unix"
+	address string // URL, host:port or socket path
+	payload string // Request body or raw payload
+}
+
+// requestsDriver replays a list of HTTP requests and raw socket payloads.
+// Each line of the list holds "<METHOD> <url> [body]", "tcp <host:port> [payload]"
+// or "unix <socket> [payload]"; payloads may be Go-quoted to send escape sequences.
+type requestsDriver struct {
+	requests []request
+	client   *http.Client
+}
+
+// newRequestsDriver loads a request list from a file
+func newRequestsDriver(requestsPath string) (*requestsDriver, error) {
+	requests, err := loadRequests(requestsPath)
+	if err != nil {
+		return nil, err
+	}
+	return &requestsDriver{requests: requests, client: newHTTPDriver().client}, nil
+}
+
+// Name returns the name of the driver
+func (driver *requestsDriver) Name() string {
+	return "requests"
+}
+
+// Exercise sends every request of the list once
+func (driver *requestsDriver) Exercise(ctx context.Context, target Target) error {
+	var errs []error
+	for _, request := range driver.requests {
+		switch request.kind {
+		case "tcp", "unix":
+			errs = append(errs, exchange(ctx, request.kind, request.address, request.payload))
+		default:
+			errs = append(errs, sendHTTPRequest(ctx, driver.client, request.kind, request.address, request.payload))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadRequests parses a request list, skipping blank lines and "#" comments
+func loadRequests(requestsPath string) ([]request, error) {
+	file, err := os.Open(requestsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var requests []request
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kind, rest := cutField(line)
+		address, payload := cutField(rest)
+		if address == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"<METHOD|tcp|unix> <address> [payload]\"", requestsPath, lineNumber)
+		}
+		entry := request{kind: kind, address: address, payload: payload}
+		if entry.kind != "tcp" && entry.kind != "unix" {
+			entry.kind = strings.ToUpper(entry.kind)
+		}
+		if unquoted, err := strconv.Unquote(entry.payload); err == nil {
+			entry.payload = unquoted
+		}
+		requests = append(requests, entry)
+	}
+	return requests, scanner.Err()
+}
+
+// cutField splits the first field off a line; fields are separated by spaces or tabs
+func cutField(line string) (string, string) {
+	if index := strings.IndexAny(line, " \t"); index >= 0 {
+		return line[:index], strings.TrimSpace(line[index+1:])
+	}
+	return line, ""
+}
@@ -0,0 +1,83 @@
+package workload
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []request
+		wantErr bool
+	}{
+		{
+			name:    "comments and blank lines",
+			content: "# health checks\n\nget http://localhost/health\n  # indented comment\n",
+			want:    []request{{kind: "GET", address: "http://localhost/health"}},
+		},
+		{
+			name:    "body and raw payloads",
+			content: "POST http://localhost/api {\"name\": \"test\"}\ntcp localhost:6379 PING\nunix /run/app.sock status\n",
+			want: []request{
+				{kind: "POST", address: "http://localhost/api", payload: `{"name": "test"}`},
+				{kind: "tcp", address: "localhost:6379", payload: "PING"},
+				{kind: "unix", address: "/run/app.sock", payload: "status"},
+			},
+		},
+		{
+			name:    "quoted payload with escape sequences",
+			content: "tcp localhost:6379 \"PING\\r\\n\"\n",
+			want:    []request{{kind: "tcp", address: "localhost:6379", payload: "PING\r\n"}},
+		},
+		{
+			name:    "unbalanced quote is sent literally",
+			content: "tcp localhost:11211 \"stats\n",
+			want:    []request{{kind: "tcp", address: "localhost:11211", payload: `"stats`}},
+		},
+		{
+			name:    "fields separated by several spaces and tabs",
+			content: "GET  http://localhost/\nunix\t/run/app.sock \t  hello world\n",
+			want: []request{
+				{kind: "GET", address: "http://localhost/"},
+				{kind: "unix", address: "/run/app.sock", payload: "hello world"},
+			},
+		},
+		{
+			name:    "missing address",
+			content: "GET http://localhost/\nGET\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestsPath := filepath.Join(t.TempDir(), "requests.txt")
+			if err := os.WriteFile(requestsPath, []byte(test.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadRequests(requestsPath)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("loadRequests() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadRequests() = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("loadRequests() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadRequestsMissingFile(t *testing.T) {
+	if _, err := loadRequests(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("loadRequests() of a missing file succeeded, want an error")
+	}
+}
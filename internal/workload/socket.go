@@ -0,0 +1,81 @@
+package workload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// socketTimeout bounds connecting to a socket and waiting for its banner
+const socketTimeout = 2 * time.Second
+
+// tcpDriver connects to every listening TCP port and reads the banner, if the service sends one.
+type tcpDriver struct{}
+
+// Name returns the name of the driver
+func (driver *tcpDriver) Name() string {
+	return "tcp"
+}
+
+// Exercise connects to each TCP port of the target
+func (driver *tcpDriver) Exercise(ctx context.Context, target Target) error {
+	var errs []error
+	for _, port := range target.TCPPorts {
+		errs = append(errs, exchange(ctx, "tcp", fmt.Sprintf("localhost:%d", port), ""))
+	}
+	return errors.Join(errs...)
+}
+
+// unixDriver connects to every Unix domain socket of the target and reads the banner, if any.
+type unixDriver struct{}
+
+// Name returns the name of the driver
+func (driver *unixDriver) Name() string {
+	return "unix"
+}
+
+// Exercise connects to each Unix socket of the target
+func (driver *unixDriver) Exercise(ctx context.Context, target Target) error {
+	var errs []error
+	for _, socketPath := range target.UnixSockets {
+		// Abstract sockets are listed with a leading "@"
+		if strings.HasPrefix(socketPath, "@") {
+			socketPath = "\x00" + socketPath[1:]
+		}
+		errs = append(errs, exchange(ctx, "unix", socketPath, ""))
+	}
+	return errors.Join(errs...)
+}
+
+// exchange connects to a socket, sends an optional payload and reads what the service answers
+// until it goes quiet. A missing banner is not an error.
+func exchange(ctx context.Context, network, address, payload string) error {
+	dialer := net.Dialer{Timeout: socketTimeout}
+	connection, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+
+	if payload != "" {
+		if _, err := io.WriteString(connection, payload); err != nil {
+			return err
+		}
+	}
+
+	connection.SetReadDeadline(time.Now().Add(socketTimeout))
+	buffer := make([]byte, 4096)
+	for {
+		if _, err := connection.Read(buffer); err != nil {
+			var netErr net.Error
+			if errors.Is(err, io.EOF) || (errors.As(err, &netErr) && netErr.Timeout()) {
+				return nil
+			}
+			return err
+		}
+	}
+}